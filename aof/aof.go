@@ -2,6 +2,7 @@ package aof
 
 import (
 	"context"
+	"errors"
 	"go-redis/config"
 	databaseInterface "go-redis/interface/database"
 	"go-redis/lib/logger"
@@ -11,6 +12,7 @@ import (
 	"go-redis/resp/reply"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"time"
@@ -27,10 +29,14 @@ const (
 	FsyncNo       = "no"       // FsyncNo lets operating system decides when to do fsync
 )
 
+// errAofClosed is returned by a flush requested after the aof file was closed
+var errAofClosed = errors.New("aof is closed")
+
 type payload struct {
 	commandLine databaseInterface.CommandLine
 	dbIndex     int
 	wg          *sync.WaitGroup
+	flushed     chan error // set on a flush request, receives the result once the payloads before it are written
 }
 
 // Listener will be called-back after receiving an aof payload with a listener we can forward the updates to slave nodes etc.
@@ -41,12 +47,14 @@ type Listener interface {
 // AofHandler receive messages from channel and write to AOF file
 type AofHandler struct {
 	database   databaseInterface.DatabaseEngine
+	properties *config.ServerProperties
 	currentDB  int
 	buffer     []byte // reuse commandLine buffer
 	bufferLock sync.Mutex
 
 	ctx    context.Context
 	cancel context.CancelFunc
+	done   chan struct{} // closed once Close wrote the last payloads, nothing reads aofChan after it
 
 	aofChan     chan *payload  // aofChan is the channel to receive aof payload(listenCmd will send payload to this channel)
 	aofFile     *os.File       // aofFile is the file handler of aof file
@@ -61,14 +69,21 @@ type AofHandler struct {
 }
 
 // NewAofHandler returns a new instance of AofHandler and open aof file
-func NewAofHandler(database databaseInterface.DatabaseEngine) (*AofHandler, error) {
+func NewAofHandler(database databaseInterface.DatabaseEngine, properties *config.ServerProperties) (*AofHandler, error) {
 	handler := &AofHandler{}
-	handler.aofFilename = config.Properties.AppendFilename
+	if properties.Dir != "" {
+		if err := os.MkdirAll(properties.Dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	// the aof file lives in the data directory of this server
+	handler.aofFilename = filepath.Join(properties.Dir, properties.AppendFilename)
 	handler.database = database
-	handler.aofRewriter = NewAofRewriter(database)
+	handler.properties = properties
+	handler.aofRewriter = NewAofRewriter(database, properties, handler.aofFilename)
 
 	// Redis aofFsync default is "everysec"
-	switch config.Properties.AppendFsync {
+	switch properties.AppendFsync {
 	case "always":
 		handler.aofFsync = FsyncAlways
 	case "no":
@@ -86,6 +101,7 @@ func NewAofHandler(database databaseInterface.DatabaseEngine) (*AofHandler, erro
 	handler.aofChan = make(chan *payload, aofQueueSize)
 	// run a goroutine to handle aof
 	handler.ctx, handler.cancel = context.WithCancel(context.Background())
+	handler.done = make(chan struct{})
 	handler.aofFinished.Add(1)
 	go handler.HandleAof()
 	if handler.aofFsync == FsyncEverySec {
@@ -96,10 +112,35 @@ func NewAofHandler(database databaseInterface.DatabaseEngine) (*AofHandler, erro
 
 // AddAof adds aof payload to aofChan
 func (handler *AofHandler) AddAof(databaseIndex int, commandLine databaseInterface.CommandLine) {
-	if !config.Properties.AppendOnly && handler.aofChan == nil {
+	if !handler.properties.AppendOnly && handler.aofChan == nil {
 		return
 	}
-	handler.aofChan <- &payload{commandLine: commandLine, dbIndex: databaseIndex}
+	select {
+	case handler.aofChan <- &payload{commandLine: commandLine, dbIndex: databaseIndex}:
+	case <-handler.done: // the command came after the shutdown, there is no file to write it to
+	}
+}
+
+// Flush writes and fsyncs the payloads added before it, it returns the error of the write if any
+func (handler *AofHandler) Flush() error {
+	p := &payload{flushed: make(chan error, 1)}
+	select {
+	case handler.aofChan <- p:
+	case <-handler.done:
+		return errAofClosed
+	}
+	select {
+	case err := <-p.flushed:
+		return err
+	case <-handler.done:
+		// Close answers the flushes still queued before closing done
+		select {
+		case err := <-p.flushed:
+			return err
+		default:
+			return errAofClosed
+		}
+	}
 }
 
 // HandleAof handles aof payload
@@ -124,15 +165,24 @@ func (handler *AofHandler) processAofPayload(p *payload) {
 	handler.pausingMutex.Lock()
 	defer handler.pausingMutex.Unlock()
 
+	if p.flushed != nil {
+		p.flushed <- handler.writeBuffer()
+		return
+	}
+	handler.appendPayload(p)
+	if handler.aofFsync == FsyncAlways || len(handler.buffer) >= bufferSize {
+		handler.flushBuffer()
+	}
+}
+
+// appendPayload writes the command of p to aof buffer, after a SELECT if it targets another db
+func (handler *AofHandler) appendPayload(p *payload) {
 	if p.dbIndex != handler.currentDB {
 		selectCommand := utils.ToCommandLine("SELECT", strconv.Itoa(p.dbIndex))
 		handler.bufferedWrite(selectCommand)
 		handler.currentDB = p.dbIndex
 	}
 	handler.bufferedWrite(p.commandLine)
-	if handler.aofFsync == FsyncAlways || len(handler.buffer) >= bufferSize {
-		handler.flushBuffer()
-	}
 }
 
 // LoadAof load aof when redis start
@@ -147,7 +197,7 @@ func (handler *AofHandler) LoadAof() {
 	}()
 	ch := parser.ParseStream(file)
 	fakeConnection := &connection.Connection{}
-	fakeConnection.SetPassword(config.Properties.RequirePass)
+	fakeConnection.SetPassword(handler.properties.RequirePass)
 	for payload := range ch {
 		if payload.Error != nil {
 			if payload.Error == io.EOF {
@@ -183,10 +233,20 @@ func (handler *AofHandler) bufferedWrite(commandLine databaseInterface.CommandLi
 
 // flushBuffer flushes aof buffer to disk
 func (handler *AofHandler) flushBuffer() {
+	if err := handler.writeBuffer(); err != nil {
+		return
+	}
+	fileInfo, _ := handler.aofFile.Stat()
+	currentAofSize := fileInfo.Size()
+	handler.checkAofRewrite(currentAofSize)
+}
+
+// writeBuffer writes aof buffer to the file, and fsyncs it unless the fsync policy is "no"
+func (handler *AofHandler) writeBuffer() error {
 	handler.bufferLock.Lock()
 	defer handler.bufferLock.Unlock()
 	if len(handler.buffer) == 0 {
-		return
+		return nil
 	}
 
 	// retry
@@ -200,16 +260,14 @@ func (handler *AofHandler) flushBuffer() {
 	}
 	if err != nil {
 		logger.Error("AOF write error after retries: ", err)
-		return
+		return err
 	}
 
 	handler.buffer = handler.buffer[:0] // Clear buffer
 	if handler.aofFsync != FsyncNo {
-		handler.safeSync()
+		return handler.safeSync()
 	}
-	fileInfo, _ := handler.aofFile.Stat()
-	currentAofSize := fileInfo.Size()
-	handler.checkAofRewrite(currentAofSize)
+	return nil
 }
 
 // periodicFsync flushes aof buffer to disk in a period
@@ -227,16 +285,18 @@ func (handler *AofHandler) periodicFsync() {
 }
 
 // safeSync flushes aof buffer to disk with retry attempts
-func (handler *AofHandler) safeSync() {
+func (handler *AofHandler) safeSync() error {
+	var err error
 	for i := 0; i < retryTimes; i++ {
-		if err := handler.aofFile.Sync(); err != nil {
+		if err = handler.aofFile.Sync(); err != nil {
 			logger.Error("AOF fsync failed, retrying... Attempt", i+1, "Error:", err)
 			time.Sleep(10 * time.Millisecond)
 			continue
 		}
-		return
+		return nil
 	}
 	logger.Error("AOF fsync failed after multiple attempts. Data consistency may be at risk.")
+	return err
 }
 
 // ScheduleRewrite schedule aof rewrite
@@ -277,8 +337,8 @@ func (handler *AofHandler) ScheduleRewrite() {
 
 // checkAofRewrite check aof rewrite rule when aof file size need rewrite
 func (handler *AofHandler) checkAofRewrite(fileSize int64) {
-	autoAofRewriteMinSize, _ := utils.ParseSize(config.Properties.AutoAofRewriteMinSize)
-	atoAofRewritePercentage := config.Properties.AutoAofRewritePercentage
+	autoAofRewriteMinSize, _ := utils.ParseSize(handler.properties.AutoAofRewriteMinSize)
+	atoAofRewritePercentage := handler.properties.AutoAofRewritePercentage
 	lastRewriteSize := handler.aofRewriter.lastRewriteSize
 	if fileSize >= autoAofRewriteMinSize && (fileSize-lastRewriteSize)/lastRewriteSize >= atoAofRewritePercentage {
 		handler.ScheduleRewrite()
@@ -287,8 +347,18 @@ func (handler *AofHandler) checkAofRewrite(fileSize int64) {
 
 // Close closes aof
 func (handler *AofHandler) Close() {
-	handler.cancel()            // trigger ctx.Done()，make all goroutines exit
-	handler.aofFinished.Wait()  // wait all goroutines exit
-	handler.safeSync()          // safe flush
+	handler.cancel()           // trigger ctx.Done()，make all goroutines exit
+	handler.aofFinished.Wait() // wait all goroutines exit
+	// the payloads still queued and the buffer are written before the file is closed
+	for len(handler.aofChan) > 0 {
+		if p := <-handler.aofChan; p.flushed == nil {
+			handler.appendPayload(p)
+		} else {
+			p.flushed <- handler.writeBuffer()
+		}
+	}
+	_ = handler.writeBuffer()
+	_ = handler.safeSync()      // safe flush
 	_ = handler.aofFile.Close() // close aof file
+	close(handler.done)
 }
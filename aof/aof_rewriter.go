@@ -7,6 +7,7 @@ import (
 	"go-redis/lib/utils"
 	"go-redis/resp/reply"
 	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"time"
@@ -20,14 +21,16 @@ var commandPool = sync.Pool{
 
 type AofRewriter struct {
 	database        databaseInterface.DatabaseEngine
+	properties      *config.ServerProperties
+	aofFilename     string
 	lastRewriteSize int64
 	tempFile        *os.File
 	rewriteMutex    sync.Mutex
 }
 
 // NewAofRewriter creates a new AOF rewriter instance
-func NewAofRewriter(database databaseInterface.DatabaseEngine) *AofRewriter {
-	return &AofRewriter{database: database}
+func NewAofRewriter(database databaseInterface.DatabaseEngine, properties *config.ServerProperties, aofFilename string) *AofRewriter {
+	return &AofRewriter{database: database, properties: properties, aofFilename: aofFilename}
 }
 
 func (rewriter *AofRewriter) TriggerRewrite() error {
@@ -35,7 +38,8 @@ func (rewriter *AofRewriter) TriggerRewrite() error {
 	defer rewriter.rewriteMutex.Unlock()
 
 	var err error
-	tempFile, err := os.CreateTemp("", config.Properties.AppendFilename+".rewrite")
+	// create the temp file next to the aof file, so it can be renamed over it
+	tempFile, err := os.CreateTemp(filepath.Dir(rewriter.aofFilename), filepath.Base(rewriter.aofFilename)+".rewrite")
 	if err != nil {
 		return err
 	}
@@ -48,18 +52,18 @@ func (rewriter *AofRewriter) TriggerRewrite() error {
 	if err = rewriter.dumpDatabase(); err != nil {
 		return err
 	}
-	err = os.Rename(rewriter.tempFile.Name(), config.Properties.AppendFilename)
+	err = os.Rename(rewriter.tempFile.Name(), rewriter.aofFilename)
 	if err != nil {
 		return err
 	}
-	fileInfo, _ := os.Stat(config.Properties.AppendFilename)
+	fileInfo, _ := os.Stat(rewriter.aofFilename)
 	rewriter.lastRewriteSize = fileInfo.Size()
 	logger.Info("AOF rewrite completed successfully")
 	return nil
 }
 
 func (rewriter *AofRewriter) dumpDatabase() error {
-	for dbIndex := 0; dbIndex < config.Properties.Databases; dbIndex++ {
+	for dbIndex := 0; dbIndex < rewriter.properties.Databases; dbIndex++ {
 		// select db
 		data := reply.MakeMultiBulkReply(utils.ToCommandLine("SELECT", strconv.Itoa(dbIndex))).ToBytes()
 		_, err := rewriter.tempFile.Write(data)
@@ -69,8 +73,14 @@ func (rewriter *AofRewriter) dumpDatabase() error {
 		}
 		// dump db
 		rewriter.database.ForEach(dbIndex, func(key string, entity *databaseInterface.DataEntity, expiration *time.Time) bool {
+			entityCommands := EntityToCommands(key, entity)
+			if len(entityCommands) == 0 { // unknown data type
+				return true
+			}
 			command := commandPool.Get().([]byte)[:0] // reset the buffer
-			command = append(command, EntityToCommand(key, entity).ToBytes()...)
+			for _, entityCommand := range entityCommands {
+				command = append(command, entityCommand.ToBytes()...)
+			}
 			if len(command) > 0 {
 				_, _ = rewriter.tempFile.Write(command)
 			}
@@ -1,25 +1,111 @@
 package aof
 
 import (
+	"go-redis/data_struct/list"
+	"go-redis/data_struct/sortedset"
+	"go-redis/data_struct/stream"
 	databaseInterface "go-redis/interface/database"
+	"go-redis/lib/utils"
 	"go-redis/resp/reply"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 var (
-	setCommand = []byte("SET")
+	setCommand   = []byte("SET")
+	rPushCommand = []byte("RPUSH")
+	zAddCommand  = []byte("ZADD")
+	xAddCommand  = []byte("XADD")
 )
 
-// EntityToCommand serialize data entity to redis command
-func EntityToCommand(key string, entity *databaseInterface.DataEntity) *reply.MultiBulkReply {
+// MarshalFunc serializes the data of a custom data type to the command line that rebuilds it
+type MarshalFunc func(key string, data interface{}) databaseInterface.CommandLine
+
+// DataType describes a data type registered by a module
+type DataType struct {
+	Name    string       // the name reported by the TYPE command
+	Type    reflect.Type // the go type stored in DataEntity.Data
+	Marshal MarshalFunc  // the aof serialization callback
+}
+
+var (
+	dataTypes     = make(map[reflect.Type]*DataType)
+	dataTypesLock sync.RWMutex
+)
+
+// RegisterDataType registers a custom data type, the sample decides which go type it is bound to
+func RegisterDataType(name string, sample interface{}, marshal MarshalFunc) *DataType {
+	dataType := &DataType{Name: name, Type: reflect.TypeOf(sample), Marshal: marshal}
+	dataTypesLock.Lock()
+	defer dataTypesLock.Unlock()
+	dataTypes[dataType.Type] = dataType
+	return dataType
+}
+
+// builtinTypeNames are the names TYPE replies for the data types of the server
+var builtinTypeNames = []string{"none", "string", "list", "zset", "stream"}
+
+// HasDataType returns true if a data type with the given name, or bound to the go type of sample, exists
+func HasDataType(name string, sample interface{}) bool {
+	for _, builtin := range builtinTypeNames {
+		if strings.EqualFold(builtin, name) {
+			return true
+		}
+	}
+	switch sample.(type) {
+	case []byte, *list.Deque, *sortedset.SortedSet, *stream.Stream:
+		return true
+	}
+	dataTypesLock.RLock()
+	defer dataTypesLock.RUnlock()
+	if _, ok := dataTypes[reflect.TypeOf(sample)]; ok {
+		return true
+	}
+	for _, dataType := range dataTypes {
+		if strings.EqualFold(dataType.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnregisterDataType removes a custom data type
+func UnregisterDataType(dataType *DataType) {
+	dataTypesLock.Lock()
+	defer dataTypesLock.Unlock()
+	delete(dataTypes, dataType.Type)
+}
+
+// LookupDataType returns the custom data type of the given data
+func LookupDataType(data interface{}) (*DataType, bool) {
+	dataTypesLock.RLock()
+	defer dataTypesLock.RUnlock()
+	dataType, ok := dataTypes[reflect.TypeOf(data)]
+	return dataType, ok
+}
+
+// EntityToCommands serialize data entity to the redis commands rebuilding it
+func EntityToCommands(key string, entity *databaseInterface.DataEntity) []*reply.MultiBulkReply {
 	if entity == nil {
 		return nil
 	}
-	var command *reply.MultiBulkReply
 	switch val := entity.Data.(type) {
 	case []byte:
-		command = stringToCommand(key, val)
+		return []*reply.MultiBulkReply{stringToCommand(key, val)}
+	case *list.Deque:
+		return []*reply.MultiBulkReply{listToCommand(key, val)}
+	case *sortedset.SortedSet:
+		return []*reply.MultiBulkReply{sortedSetToCommand(key, val)}
+	case *stream.Stream:
+		return streamToCommands(key, val)
+	default:
+		if dataType, ok := LookupDataType(val); ok {
+			return []*reply.MultiBulkReply{reply.MakeMultiBulkReply(dataType.Marshal(key, val))}
+		}
 	}
-	return command
+	return nil
 }
 
 // stringToCommand serialize string type data to redis command
@@ -31,3 +117,44 @@ func stringToCommand(key string, bytes []byte) *reply.MultiBulkReply {
 	}
 	return reply.MakeMultiBulkReply(args)
 }
+
+// listToCommand serialize list type data to redis command
+func listToCommand(key string, deque *list.Deque) *reply.MultiBulkReply {
+	args := make([][]byte, 0, 2+deque.Len())
+	args = append(args, rPushCommand, []byte(key))
+	args = append(args, deque.Range(0, deque.Len())...)
+	return reply.MakeMultiBulkReply(args)
+}
+
+// sortedSetToCommand serialize sorted set type data to redis command
+func sortedSetToCommand(key string, set *sortedset.SortedSet) *reply.MultiBulkReply {
+	args := make([][]byte, 0, 2+2*set.Len())
+	args = append(args, zAddCommand, []byte(key))
+	set.ForEach(func(element *sortedset.Element) bool {
+		args = append(args, []byte(strconv.FormatFloat(element.Score, 'f', -1, 64)), []byte(element.Member))
+		return true
+	})
+	return reply.MakeMultiBulkReply(args)
+}
+
+// streamToCommands serialize stream type data to one XADD per entry and one XGROUP per consumer group.
+// An empty stream is created by an entry trimmed at once, which keeps its last id.
+// The pending entries of the groups are not serialized.
+func streamToCommands(key string, s *stream.Stream) []*reply.MultiBulkReply {
+	var commands []*reply.MultiBulkReply
+	s.ForEach(func(entry *stream.Entry) bool {
+		args := make([][]byte, 0, 3+len(entry.Fields))
+		args = append(args, xAddCommand, []byte(key), []byte(entry.ID.String()))
+		commands = append(commands, reply.MakeMultiBulkReply(append(args, entry.Fields...)))
+		return true
+	})
+	if s.Len() == 0 && s.LastID() != (stream.ID{}) {
+		commands = append(commands, reply.MakeMultiBulkReply(
+			utils.ToCommandLine("XADD", key, "MAXLEN", "0", s.LastID().String(), "", "")))
+	}
+	for _, group := range s.Groups() {
+		commands = append(commands, reply.MakeMultiBulkReply(
+			utils.ToCommandLine("XGROUP", "CREATE", key, group.Name, group.LastDelivered.String(), "MKSTREAM")))
+	}
+	return commands
+}
@@ -0,0 +1,67 @@
+package command
+
+import (
+	databaseCore "go-redis/database"
+	"go-redis/interface/cluster_database"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/hash_slot"
+	"go-redis/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// blockingFunc executes a blocking command on this node if it owns the keys, a client asking another node is redirected to the owner.
+// The command is not relayed, the wait would hold a pooled peer connection whose read timeout is shorter than most blocks.
+func blockingFunc(cluster cluster_database.ClusterDatabase, conn resp.Connection, args database.CommandLine) resp.Reply {
+	if !isBlocking(args) {
+		return multiKeyFunc(cluster, conn, args)
+	}
+	keys, ok := databaseCore.CommandKeys(args)
+	if !ok || len(keys) == 0 {
+		// let the local database reply the syntax error
+		return cluster.GetDatabase().Exec(conn, args)
+	}
+	owner := cluster.GetPeerNode(keys[0])
+	for _, key := range keys[1:] {
+		if cluster.GetPeerNode(key) != owner {
+			return reply.MakeStandardErrorReply("CROSSSLOT Keys in request don't hash to the same slot")
+		}
+	}
+	if owner != cluster.GetSelf() {
+		return reply.MakeStandardErrorReply("MOVED " + strconv.Itoa(hash_slot.Slot(keys[0])) + " " + owner)
+	}
+	return cluster.GetDatabase().Exec(conn, args)
+}
+
+// isBlocking returns whether the command may block, XREAD and XREADGROUP only block with the BLOCK option
+func isBlocking(args database.CommandLine) bool {
+	name := strings.ToLower(string(args[0]))
+	if name != "xread" && name != "xreadgroup" {
+		return true
+	}
+	for i := 1; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "block":
+			return true
+		case "streams":
+			return false
+		case "group":
+			i += 2 // the group and consumer names
+		case "count":
+			i++
+		}
+	}
+	return false
+}
+
+func init() {
+	blockingCommands := []string{
+		"BLPOP", "BRPOP", "BLMOVE", "BLMPOP",
+		"BZPOPMIN", "BZPOPMAX", "BZMPOP",
+		"XREAD", "XREADGROUP",
+	}
+	for _, name := range blockingCommands {
+		RegisterCommand(name, blockingFunc)
+	}
+}
@@ -0,0 +1,26 @@
+package command
+
+import (
+	"go-redis/lib/utils"
+	"testing"
+)
+
+func TestIsBlocking(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"BLPOP", "list", "0"}, true},
+		{[]string{"BZMPOP", "0", "1", "zset", "MIN"}, true},
+		{[]string{"XREAD", "COUNT", "1", "STREAMS", "stream", "0"}, false},
+		{[]string{"XREAD", "BLOCK", "0", "STREAMS", "stream", "$"}, true},
+		{[]string{"XREAD", "STREAMS", "block", "0"}, false},
+		{[]string{"XREADGROUP", "GROUP", "block", "consumer", "STREAMS", "stream", ">"}, false},
+		{[]string{"XREADGROUP", "GROUP", "group", "consumer", "COUNT", "1", "BLOCK", "100", "STREAMS", "stream", ">"}, true},
+	}
+	for _, test := range tests {
+		if got := isBlocking(utils.ToCommandLine(test.args...)); got != test.want {
+			t.Errorf("isBlocking(%v) = %v, want %v", test.args, got, test.want)
+		}
+	}
+}
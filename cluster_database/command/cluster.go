@@ -0,0 +1,157 @@
+package command
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"go-redis/interface/cluster_database"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/hash_slot"
+	"go-redis/resp/reply"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Cluster changes the topology known by this node, or describes how the slots are spread over the nodes.
+// Nodes do not gossip, so every node of the cluster must be told about the change.
+// CLUSTER MEET host port
+// CLUSTER FORGET host:port
+// CLUSTER SLOTS
+// CLUSTER SHARDS
+// CLUSTER KEYSLOT key
+func Cluster(cluster cluster_database.ClusterDatabase, _ resp.Connection, args database.CommandLine) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeArgsNumErrorReply(string(args[0]))
+	}
+	subCommand := strings.ToLower(string(args[1]))
+	switch subCommand {
+	case "meet":
+		if len(args) != 4 {
+			return reply.MakeArgsNumErrorReply("cluster|meet")
+		}
+		peer := net.JoinHostPort(string(args[2]), string(args[3]))
+		if peer == cluster.GetSelf() {
+			return reply.MakeStandardErrorReply("ERR I can't meet myself")
+		}
+		cluster.AddPeer(peer)
+		return reply.MakeOkReply()
+	case "forget":
+		if len(args) != 3 {
+			return reply.MakeArgsNumErrorReply("cluster|forget")
+		}
+		peer := string(args[2])
+		if peer == cluster.GetSelf() {
+			return reply.MakeStandardErrorReply("ERR I tried hard but I can't forget myself...")
+		}
+		if !cluster.RemovePeer(peer) {
+			return reply.MakeStandardErrorReply("ERR Unknown node " + peer)
+		}
+		return reply.MakeOkReply()
+	case "slots":
+		if len(args) != 2 {
+			return reply.MakeArgsNumErrorReply("cluster|slots")
+		}
+		return clusterSlots(cluster)
+	case "shards":
+		if len(args) != 2 {
+			return reply.MakeArgsNumErrorReply("cluster|shards")
+		}
+		return clusterShards(cluster)
+	case "keyslot":
+		if len(args) != 3 {
+			return reply.MakeArgsNumErrorReply("cluster|keyslot")
+		}
+		return reply.MakeIntReply(int64(hash_slot.Slot(string(args[2]))))
+	}
+	return reply.MakeStandardErrorReply("ERR unknown subcommand '" + subCommand + "'. Try CLUSTER HELP.")
+}
+
+// slotRange is a run of consecutive slots owned by the same node
+type slotRange struct {
+	start, end int
+	node       string
+}
+
+// getSlotRanges returns the runs of slots in slot order
+func getSlotRanges(cluster cluster_database.ClusterDatabase) []slotRange {
+	var ranges []slotRange
+	for slot := 0; slot < hash_slot.SlotCount; slot++ {
+		node := cluster.GetSlotNode(slot)
+		if n := len(ranges); n > 0 && ranges[n-1].node == node {
+			ranges[n-1].end = slot
+			continue
+		}
+		ranges = append(ranges, slotRange{start: slot, end: slot, node: node})
+	}
+	return ranges
+}
+
+// getNodeID returns the id of a node, nodes are known by their address so the id is derived from it
+func getNodeID(node string) string {
+	sum := sha1.Sum([]byte(node))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitNodeAddr returns the host and the port of a node
+func splitNodeAddr(node string) (string, int64) {
+	host, portStr, err := net.SplitHostPort(node)
+	if err != nil {
+		return node, 0
+	}
+	port, _ := strconv.ParseInt(portStr, 10, 64)
+	return host, port
+}
+
+// clusterSlots replies each run of slots with its node, as an array of start, end and [host, port, id]
+func clusterSlots(cluster cluster_database.ClusterDatabase) resp.Reply {
+	ranges := getSlotRanges(cluster)
+	replies := make([]resp.Reply, 0, len(ranges))
+	for _, r := range ranges {
+		host, port := splitNodeAddr(r.node)
+		node := reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte(host)),
+			reply.MakeIntReply(port),
+			reply.MakeBulkReply([]byte(getNodeID(r.node))),
+		})
+		replies = append(replies, reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeIntReply(int64(r.start)),
+			reply.MakeIntReply(int64(r.end)),
+			node,
+		}))
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+// clusterShards replies each node with the runs of slots it owns, a node is a shard since there are no replicas
+func clusterShards(cluster cluster_database.ClusterDatabase) resp.Reply {
+	var nodes []string
+	slots := make(map[string][]resp.Reply)
+	for _, r := range getSlotRanges(cluster) {
+		if _, ok := slots[r.node]; !ok {
+			nodes = append(nodes, r.node)
+		}
+		slots[r.node] = append(slots[r.node], reply.MakeIntReply(int64(r.start)), reply.MakeIntReply(int64(r.end)))
+	}
+	shards := make([]resp.Reply, 0, len(nodes))
+	for _, node := range nodes {
+		host, port := splitNodeAddr(node)
+		description := reply.MakeMapReply().
+			Add(reply.MakeBulkReply([]byte("id")), reply.MakeBulkReply([]byte(getNodeID(node)))).
+			Add(reply.MakeBulkReply([]byte("port")), reply.MakeIntReply(port)).
+			Add(reply.MakeBulkReply([]byte("ip")), reply.MakeBulkReply([]byte(host))).
+			Add(reply.MakeBulkReply([]byte("endpoint")), reply.MakeBulkReply([]byte(host))).
+			Add(reply.MakeBulkReply([]byte("role")), reply.MakeBulkReply([]byte("master"))).
+			Add(reply.MakeBulkReply([]byte("replication-offset")), reply.MakeIntReply(0)).
+			Add(reply.MakeBulkReply([]byte("health")), reply.MakeBulkReply([]byte("online")))
+		shard := reply.MakeMapReply().
+			Add(reply.MakeBulkReply([]byte("slots")), reply.MakeMultiRawReply(slots[node])).
+			Add(reply.MakeBulkReply([]byte("nodes")), reply.MakeMultiRawReply([]resp.Reply{description}))
+		shards = append(shards, shard)
+	}
+	return reply.MakeMultiRawReply(shards)
+}
+
+func init() {
+	RegisterCommand("CLUSTER", Cluster)
+}
@@ -29,7 +29,25 @@ func RegisterCommands() {
 		"SETNX",
 		"GET",
 		"GETSET",
+		"GETDEL",
 		"PING",
+		"LPUSH",
+		"RPUSH",
+		"LPOP",
+		"RPOP",
+		"LLEN",
+		"LRANGE",
+		"ZADD",
+		"ZCARD",
+		"ZSCORE",
+		"ZRANGE",
+		"ZREM",
+		"ZPOPMIN",
+		"ZPOPMAX",
+		"XADD",
+		"XLEN",
+		"XRANGE",
+		"XACK",
 	}
 	// TODO more...
 	for _, command := range defaultCommands {
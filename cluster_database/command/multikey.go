@@ -0,0 +1,49 @@
+package command
+
+import (
+	databaseCore "go-redis/database"
+	"go-redis/interface/cluster_database"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+)
+
+// multiKeyFunc relays a command touching several keys to the node owning all of them.
+// Keys owned by different nodes are refused, since a command can not be split.
+func multiKeyFunc(cluster cluster_database.ClusterDatabase, conn resp.Connection, args database.CommandLine) resp.Reply {
+	keys, ok := databaseCore.CommandKeys(args)
+	if !ok || len(keys) == 0 {
+		// let the local database reply the syntax error
+		return cluster.GetDatabase().Exec(conn, args)
+	}
+	owner := cluster.GetPeerNode(keys[0])
+	for _, key := range keys[1:] {
+		if cluster.GetPeerNode(key) != owner {
+			return reply.MakeStandardErrorReply("CROSSSLOT Keys in request don't hash to the same slot")
+		}
+	}
+	return cluster.RelayToPeer(owner, conn, args)
+}
+
+// ExecModuleCommand routes a command of a module to the node owning its keys, the module must be loaded on that node.
+// A command without keys runs on the node the client is connected to.
+func ExecModuleCommand(cluster cluster_database.ClusterDatabase, conn resp.Connection, args database.CommandLine) resp.Reply {
+	return multiKeyFunc(cluster, conn, args)
+}
+
+func init() {
+	multiKeyCommands := []string{
+		"LMOVE", "LMPOP", "ZMPOP", "XGROUP",
+	}
+	for _, name := range multiKeyCommands {
+		RegisterCommand(name, multiKeyFunc)
+	}
+	// clients are managed by the node they are connected to
+	RegisterCommand("AUTH", execLocal)
+	RegisterCommand("CLIENT", execLocal)
+	RegisterCommand("HELLO", execLocal)
+	RegisterCommand("INFO", execLocal)
+	RegisterCommand("SHUTDOWN", execLocal)
+	// each node loads its own modules, so MODULE is sent to every node like CLUSTER MEET
+	RegisterCommand("MODULE", execLocal)
+}
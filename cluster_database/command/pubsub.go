@@ -0,0 +1,85 @@
+package command
+
+import (
+	"go-redis/interface/cluster_database"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/hash_slot"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+	"strconv"
+)
+
+// Publish delivers the message to the clients of this node and forwards it once to every peer,
+// it returns how many clients of the cluster received it
+func Publish(cluster cluster_database.ClusterDatabase, conn resp.Connection, args database.CommandLine) resp.Reply {
+	if len(args) != 3 {
+		return reply.MakeArgsNumErrorReply(string(args[0]))
+	}
+	results := []resp.Reply{cluster.GetDatabase().Exec(conn, args)}
+	// peers execute _PUBLISH locally, so the message is not broadcast again
+	for _, peer := range cluster.GetPeers() {
+		results = append(results, cluster.RelayToPeer(peer, conn, utils.ToCommandLine3("_PUBLISH", args[1:]...)))
+	}
+	var receivers int64 = 0
+	for _, result := range results {
+		if reply.IsErrorReply(result) {
+			return reply.MakeStandardErrorReply("error: " + result.(resp.ErrorReply).Error())
+		}
+		if intReply, ok := result.(*reply.IntReply); ok {
+			receivers += intReply.Code
+		}
+	}
+	return reply.MakeIntReply(receivers)
+}
+
+// execPeerPublish delivers a message forwarded by a peer to the clients of this node.
+// Clients can not send it, they would publish to one node only.
+func execPeerPublish(cluster cluster_database.ClusterDatabase, conn resp.Connection, args database.CommandLine) resp.Reply {
+	if !cluster.IsPeer(conn) {
+		return reply.MakeStandardErrorReply("not support command: " + string(args[0]))
+	}
+	if len(args) != 3 {
+		return reply.MakeArgsNumErrorReply(string(args[0]))
+	}
+	return cluster.GetDatabase().Exec(conn, utils.ToCommandLine3("PUBLISH", args[1:]...))
+}
+
+// SSubscribe subscribes to shard channels owned by this node.
+// The subscription can not be relayed, so a client asking the wrong node is redirected to the owner.
+func SSubscribe(cluster cluster_database.ClusterDatabase, conn resp.Connection, args database.CommandLine) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeArgsNumErrorReply(string(args[0]))
+	}
+	owner := cluster.GetPeerNode(string(args[1]))
+	for _, channel := range args[2:] {
+		if cluster.GetPeerNode(string(channel)) != owner {
+			return reply.MakeStandardErrorReply("CROSSSLOT Keys in request don't hash to the same slot")
+		}
+	}
+	if owner != cluster.GetSelf() {
+		return reply.MakeStandardErrorReply("MOVED " + strconv.Itoa(hash_slot.Slot(string(args[1]))) + " " + owner)
+	}
+	return cluster.GetDatabase().Exec(conn, args)
+}
+
+// execLocal executes the command on the node the client is connected to
+func execLocal(cluster cluster_database.ClusterDatabase, conn resp.Connection, args database.CommandLine) resp.Reply {
+	return cluster.GetDatabase().Exec(conn, args)
+}
+
+func init() {
+	RegisterCommand("PUBLISH", Publish)
+	RegisterCommand("_PUBLISH", execPeerPublish)
+	// subscriptions and their introspection belong to the node the client is connected to
+	RegisterCommand("SUBSCRIBE", execLocal)
+	RegisterCommand("UNSUBSCRIBE", execLocal)
+	RegisterCommand("PSUBSCRIBE", execLocal)
+	RegisterCommand("PUNSUBSCRIBE", execLocal)
+	RegisterCommand("PUBSUB", execLocal)
+	RegisterCommand("SSUBSCRIBE", SSubscribe)
+	RegisterCommand("SUNSUBSCRIBE", execLocal)
+	// shard messages are relayed to the node owning the shard channel, like a key
+	RegisterDefaultCommand("SPUBLISH")
+	RegisterCommand("RESET", execLocal)
+}
@@ -2,41 +2,26 @@ package core
 
 import (
 	"context"
-	"errors"
-	pool "github.com/jolestar/go-commons-pool/v2"
+	"crypto/tls"
 	"go-redis/resp/client"
+	"go-redis/tcp"
+	"net"
+	"time"
 )
 
-type ConnectionFactory struct {
-	Peer string
-}
+// peerReadTimeout bounds the wait for the reply of a peer. A relayed command may scan a whole database,
+// like KEYS or FLUSHALL, so it is much longer than the default of the client. Blocking commands are not relayed.
+const peerReadTimeout = time.Minute
 
-func (c *ConnectionFactory) MakeObject(ctx context.Context) (*pool.PooledObject, error) {
-	clientConnection, err := client.MakeClient(c.Peer)
-	if err != nil {
-		return nil, err
+// makePeerClient returns the client relaying commands to peer, it dials over tls with the latest certificates if certs is set.
+// The nodes of a cluster share requirepass, the client authenticates with it.
+func makePeerClient(peer string, certs *tcp.Certificates, password string) *client.Client {
+	opts := &client.Options{Addr: peer, ReadTimeout: peerReadTimeout, Password: password}
+	if certs != nil {
+		opts.Dialer = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialer := &tls.Dialer{Config: certs.ClientConfig()}
+			return dialer.DialContext(ctx, network, addr)
+		}
 	}
-	clientConnection.Start() // start pipeline
-	return pool.NewPooledObject(clientConnection), nil
-}
-
-func (c *ConnectionFactory) DestroyObject(ctx context.Context, object *pool.PooledObject) error {
-	clientConnection, ok := object.Object.(*client.Client)
-	if !ok {
-		return errors.New("type mismatch")
-	}
-	clientConnection.Close()
-	return nil
-}
-
-func (c *ConnectionFactory) ValidateObject(ctx context.Context, object *pool.PooledObject) bool {
-	return true
-}
-
-func (c *ConnectionFactory) ActivateObject(ctx context.Context, object *pool.PooledObject) error {
-	return nil
-}
-
-func (c *ConnectionFactory) PassivateObject(ctx context.Context, object *pool.PooledObject) error {
-	return nil
+	return client.NewClient(opts)
 }
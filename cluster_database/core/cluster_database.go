@@ -1,8 +1,6 @@
 package core
 
 import (
-	"context"
-	pool "github.com/jolestar/go-commons-pool/v2"
 	"go-redis/aof"
 	command2 "go-redis/cluster_database/command"
 	"go-redis/config"
@@ -10,41 +8,60 @@ import (
 	databaseInterface "go-redis/interface/database"
 	"go-redis/interface/resp"
 	"go-redis/lib/consistent_hash"
+	"go-redis/lib/hash_slot"
 	"go-redis/lib/logger"
+	"go-redis/lib/stats"
+	"go-redis/module"
+	"go-redis/pubsub"
+	"go-redis/resp/client"
 	"go-redis/resp/reply"
+	"go-redis/tcp"
+	"net"
 	"strings"
+	"sync"
 	"time"
 )
 
 type ClusterDatabase struct {
-	database   databaseInterface.DatabaseEngine
+	database   *database.StandaloneDatabase
 	aofHandler *aof.AofHandler
 	self       string
 
+	topologyLock    sync.RWMutex // guards nodes, peerPicker, peerConnections and peerIPs
 	nodes           []string
 	peerPicker      *consistent_hash.NodeMap
-	peerConnections map[string]*pool.ObjectPool
+	peerConnections map[string]*client.Client
+	peerIPs         map[string][]net.IP // the addresses of the peer hosts, resolved when they join the topology
+	tlsCerts        *tcp.Certificates   // the peers are dialed over tls if it is set, by tls-cluster
+	requirePass     string              // shared by the nodes, the peers authenticate with it
 }
 
 // NewClusterDatabase returns a new ClusterDatabase
-func NewClusterDatabase() *ClusterDatabase {
+func NewClusterDatabase(properties *config.ServerProperties) *ClusterDatabase {
 	clusterDatabase := &ClusterDatabase{
-		self:            config.Properties.Self,
-		database:        database.NewStandaloneDatabase(),
+		self:            properties.Self,
+		database:        database.NewStandaloneDatabase(properties),
 		peerPicker:      consistent_hash.NewNodeMap(nil),
-		peerConnections: make(map[string]*pool.ObjectPool),
+		peerConnections: make(map[string]*client.Client),
+		peerIPs:         make(map[string][]net.IP),
+		requirePass:     properties.RequirePass,
 	}
-	nodes := make([]string, 0, len(config.Properties.Peers)+1)
-	for _, peer := range config.Properties.Peers {
+	if properties.TLSCluster {
+		certs, err := tcp.LoadCertificates(tcp.MakeTLSConfig(properties))
+		if err != nil {
+			panic(err)
+		}
+		clusterDatabase.tlsCerts = certs
+	}
+	nodes := make([]string, 0, len(properties.Peers)+1)
+	for _, peer := range properties.Peers {
 		nodes = append(nodes, peer)
 	}
-	nodes = append(nodes, config.Properties.Self)
+	nodes = append(nodes, properties.Self)
 	clusterDatabase.peerPicker.AddNode(nodes...)
-	ctx := context.Background()
-	for _, peer := range config.Properties.Peers {
-		clusterDatabase.peerConnections[peer] = pool.NewObjectPoolWithDefaultConfig(ctx, &ConnectionFactory{
-			Peer: peer,
-		})
+	for _, peer := range properties.Peers {
+		clusterDatabase.peerConnections[peer] = makePeerClient(peer, clusterDatabase.tlsCerts, clusterDatabase.requirePass)
+		clusterDatabase.peerIPs[peer] = lookupPeerIPs(peer)
 	}
 	clusterDatabase.nodes = nodes
 	return clusterDatabase
@@ -58,9 +75,19 @@ func (cluster *ClusterDatabase) Exec(client resp.Connection, args [][]byte) (res
 		}
 	}()
 	command := strings.ToLower(string(args[0]))
+	// a subscribed client can only manage its subscriptions
+	if pubsub.InSubscribeMode(client) && !pubsub.IsAllowedInSubscribeMode(command) {
+		return pubsub.MakeSubscribeModeErrorReply(command)
+	}
+	// the commands relayed to a peer run with its authenticated connection, so the client is checked here
+	if command != "auth" && command != "hello" && !cluster.database.IsAuthenticated(client) {
+		return reply.MakeStandardErrorReply("NOAUTH Authentication required")
+	}
 	commands := command2.Commands.GetCommands()
 	if commandFunc, ok := commands[command]; ok {
 		result = commandFunc(cluster, client, args)
+	} else if module.IsModuleCommand(command) {
+		result = command2.ExecModuleCommand(cluster, client, args)
 	} else {
 		result = reply.MakeStandardErrorReply("not support command: " + string(args[0]))
 	}
@@ -69,6 +96,25 @@ func (cluster *ClusterDatabase) Exec(client resp.Connection, args [][]byte) (res
 
 func (cluster *ClusterDatabase) Close() {
 	cluster.database.Close()
+	cluster.topologyLock.RLock()
+	defer cluster.topologyLock.RUnlock()
+	for _, peerClient := range cluster.peerConnections {
+		_ = peerClient.Close()
+	}
+}
+
+// ShutdownRequested returns a channel closed once SHUTDOWN succeeded on this node
+func (cluster *ClusterDatabase) ShutdownRequested() <-chan struct{} {
+	return cluster.database.ShutdownRequested()
+}
+
+// Stats returns the counters of this node
+func (cluster *ClusterDatabase) Stats() *stats.Stats {
+	return cluster.database.Stats()
+}
+
+func (cluster *ClusterDatabase) AfterClientConnect(conn resp.Connection) {
+	cluster.database.AfterClientConnect(conn)
 }
 
 func (cluster *ClusterDatabase) AfterClientClose(conn resp.Connection) {
@@ -79,8 +125,91 @@ func (cluster *ClusterDatabase) AfterClientClose(conn resp.Connection) {
 func (cluster *ClusterDatabase) ForEach(_ int, _ func(key string, data *databaseInterface.DataEntity, expiration *time.Time) bool) {
 }
 
+// GetPeerNode returns the node owning the slot of key, the keys sharing a hash tag are owned by the same node
 func (cluster *ClusterDatabase) GetPeerNode(key string) string {
-	return cluster.peerPicker.GetNode(key)
+	return cluster.GetSlotNode(hash_slot.Slot(key))
+}
+
+// GetSlotNode returns the node owning slot.
+// The slots are evenly spaced over the hash ring, so each node owns runs of consecutive slots.
+func (cluster *ClusterDatabase) GetSlotNode(slot int) string {
+	cluster.topologyLock.RLock()
+	defer cluster.topologyLock.RUnlock()
+	return cluster.peerPicker.GetNodeOfHash(int(uint64(slot) << 32 / hash_slot.SlotCount))
+}
+
+// ReloadCertificates reloads the certificates dialing the peers, the next connections use them
+func (cluster *ClusterDatabase) ReloadCertificates() error {
+	if cluster.tlsCerts == nil {
+		return nil
+	}
+	return cluster.tlsCerts.Reload()
+}
+
+// GetSelf returns the address of this node
+func (cluster *ClusterDatabase) GetSelf() string {
+	return cluster.self
+}
+
+// AddPeer adds a node to the topology known by this node, returns false if it is known already
+func (cluster *ClusterDatabase) AddPeer(peer string) bool {
+	// resolved before taking the lock, a slow lookup must not stall the commands
+	ips := lookupPeerIPs(peer)
+	cluster.topologyLock.Lock()
+	for _, node := range cluster.nodes {
+		if node == peer {
+			cluster.topologyLock.Unlock()
+			return false
+		}
+	}
+	cluster.peerConnections[peer] = makePeerClient(peer, cluster.tlsCerts, cluster.requirePass)
+	cluster.peerIPs[peer] = ips
+	cluster.setNodes(append(cluster.nodes, peer))
+	cluster.topologyLock.Unlock()
+
+	cluster.evictShardChannels()
+	logger.Info("Peer node added: " + peer)
+	return true
+}
+
+// RemovePeer removes a node from the topology known by this node, returns false if it is unknown
+func (cluster *ClusterDatabase) RemovePeer(peer string) bool {
+	cluster.topologyLock.Lock()
+	peerClient, ok := cluster.peerConnections[peer]
+	if !ok {
+		cluster.topologyLock.Unlock()
+		return false
+	}
+	delete(cluster.peerConnections, peer)
+	delete(cluster.peerIPs, peer)
+	nodes := make([]string, 0, len(cluster.nodes))
+	for _, node := range cluster.nodes {
+		if node != peer {
+			nodes = append(nodes, node)
+		}
+	}
+	cluster.setNodes(nodes)
+	cluster.topologyLock.Unlock()
+
+	_ = peerClient.Close()
+	cluster.evictShardChannels()
+	logger.Info("Peer node removed: " + peer)
+	return true
+}
+
+// setNodes rebuilds the hash ring, the caller must hold topologyLock
+func (cluster *ClusterDatabase) setNodes(nodes []string) {
+	peerPicker := consistent_hash.NewNodeMap(nil)
+	peerPicker.AddNode(nodes...)
+	cluster.nodes = nodes
+	cluster.peerPicker = peerPicker
+}
+
+// evictShardChannels unsubscribes the shard channels this node stopped owning after a topology change
+func (cluster *ClusterDatabase) evictShardChannels() {
+	cluster.database.Hub().EvictShardChannels(func(channel string) bool {
+		return cluster.GetPeerNode(channel) == cluster.self
+	})
 }
 
 func (cluster *ClusterDatabase) GetDatabase() databaseInterface.DatabaseEngine {
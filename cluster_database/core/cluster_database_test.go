@@ -0,0 +1,129 @@
+package core
+
+import (
+	"go-redis/config"
+	"go-redis/lib/hash_slot"
+	"go-redis/lib/utils"
+	"go-redis/resp/connection"
+	"net"
+	"strconv"
+	"testing"
+)
+
+const (
+	testSelf = "127.0.0.1:7001"
+	testPeer = "127.0.0.1:7002" // never dialed, the tests only use the keys of self
+)
+
+func makeTestCluster(t *testing.T) *ClusterDatabase {
+	return makeTestClusterWithPassword(t, "")
+}
+
+func makeTestClusterWithPassword(t *testing.T, requirePass string) *ClusterDatabase {
+	cluster := NewClusterDatabase(&config.ServerProperties{Databases: 1, Self: testSelf, Peers: []string{testPeer}, RequirePass: requirePass})
+	t.Cleanup(cluster.Close)
+	return cluster
+}
+
+// makeLoopbackConnection returns a connection accepted from 127.0.0.1, the host of testPeer
+func makeLoopbackConnection(t *testing.T) *connection.Connection {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	dialed, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = dialed.Close()
+		_ = accepted.Close()
+	})
+	return connection.NewConnection(accepted)
+}
+
+// findKey returns a key of prefix owned by node
+func findKey(t *testing.T, cluster *ClusterDatabase, prefix string, node string) string {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		key := prefix + strconv.Itoa(i)
+		if cluster.GetPeerNode(key) == node {
+			return key
+		}
+	}
+	t.Fatalf("no key of %s is owned by %s", prefix, node)
+	return ""
+}
+
+func TestGetPeerNodeFollowsSlots(t *testing.T) {
+	cluster := makeTestCluster(t)
+	for i := 0; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		if got, want := cluster.GetPeerNode(key), cluster.GetSlotNode(hash_slot.Slot(key)); got != want {
+			t.Errorf("GetPeerNode(%q) = %s, but its slot is owned by %s", key, got, want)
+		}
+	}
+}
+
+func TestMultiKeyCommandWithHashTag(t *testing.T) {
+	cluster := makeTestCluster(t)
+	client := connection.NewConnection(nil)
+	tag := findKey(t, cluster, "user", testSelf)
+	src, dest := "{"+tag+"}.src", "{"+tag+"}.dest"
+	if got := string(cluster.Exec(client, utils.ToCommandLine("RPUSH", src, "a")).ToBytes()); got != ":1\r\n" {
+		t.Fatalf("RPUSH = %q", got)
+	}
+	if got, want := string(cluster.Exec(client, utils.ToCommandLine("LMOVE", src, dest, "LEFT", "RIGHT")).ToBytes()), "$1\r\na\r\n"; got != want {
+		t.Errorf("LMOVE = %q, want %q", got, want)
+	}
+	if got, want := string(cluster.Exec(client, utils.ToCommandLine("LPOP", dest)).ToBytes()), "$1\r\na\r\n"; got != want {
+		t.Errorf("LPOP = %q, want %q", got, want)
+	}
+}
+
+func TestMultiKeyCommandAcrossNodes(t *testing.T) {
+	cluster := makeTestCluster(t)
+	client := connection.NewConnection(nil)
+	local := findKey(t, cluster, "local", testSelf)
+	remote := findKey(t, cluster, "remote", testPeer)
+	got := string(cluster.Exec(client, utils.ToCommandLine("LMOVE", local, remote, "LEFT", "RIGHT")).ToBytes())
+	if want := "-CROSSSLOT Keys in request don't hash to the same slot\r\n"; got != want {
+		t.Errorf("LMOVE = %q, want %q", got, want)
+	}
+}
+
+func TestIsPeerRequiresPassword(t *testing.T) {
+	cluster := makeTestClusterWithPassword(t, "secret")
+	conn := makeLoopbackConnection(t)
+	if cluster.IsPeer(conn) {
+		t.Error("an unauthenticated client of a peer host is a peer")
+	}
+	conn.SetPassword("secret")
+	if !cluster.IsPeer(conn) {
+		t.Error("an authenticated client of a peer host is not a peer")
+	}
+}
+
+func TestIsPeerChecksHost(t *testing.T) {
+	cluster := makeTestCluster(t)
+	cluster.RemovePeer(testPeer)
+	cluster.AddPeer("192.0.2.1:7002")
+	if cluster.IsPeer(makeLoopbackConnection(t)) {
+		t.Error("a client of a host without peer is a peer")
+	}
+}
+
+func TestRelayRequiresAuthentication(t *testing.T) {
+	cluster := makeTestClusterWithPassword(t, "secret")
+	client := connection.NewConnection(nil)
+	remote := findKey(t, cluster, "remote", testPeer)
+	got := string(cluster.Exec(client, utils.ToCommandLine("GET", remote)).ToBytes())
+	if want := "-NOAUTH Authentication required\r\n"; got != want {
+		t.Errorf("GET = %q, want %q", got, want)
+	}
+}
@@ -5,36 +5,21 @@ import (
 	"errors"
 	"go-redis/interface/database"
 	"go-redis/interface/resp"
-	"go-redis/lib/utils"
+	"go-redis/lib/logger"
 	"go-redis/resp/client"
 	"go-redis/resp/reply"
-	"strconv"
+	"net"
 )
 
-// getPeerClient returns a peer client from the connection pool
+// getPeerClient returns the client of a peer
 func (cluster *ClusterDatabase) getPeerClient(peer string) (*client.Client, error) {
-	pool, ok := cluster.peerConnections[peer]
+	cluster.topologyLock.RLock()
+	peerClient, ok := cluster.peerConnections[peer]
+	cluster.topologyLock.RUnlock()
 	if !ok {
 		return nil, errors.New("peer not found")
 	}
-	object, err := pool.BorrowObject(context.Background())
-	if err != nil {
-		return nil, err
-	}
-	clientConnection, ok := object.(*client.Client)
-	if !ok {
-		return nil, errors.New("type mismatch")
-	}
-	return clientConnection, nil
-}
-
-// returnPeerClient returns a peer client to the connection pool
-func (cluster *ClusterDatabase) returnPeerClient(peer string, clientConnection *client.Client) error {
-	pool, ok := cluster.peerConnections[peer]
-	if !ok {
-		return errors.New("peer not found")
-	}
-	return pool.ReturnObject(context.Background(), clientConnection)
+	return peerClient, nil
 }
 
 // RelayToPeer relays a command to a peer or the local database
@@ -42,21 +27,82 @@ func (cluster *ClusterDatabase) RelayToPeer(peer string, connection resp.Connect
 	if peer == cluster.self {
 		return cluster.database.Exec(connection, args)
 	}
-	clientConnection, err := cluster.getPeerClient(peer)
+	peerClient, err := cluster.getPeerClient(peer)
 	if err != nil {
 		return reply.MakeStandardErrorReply(err.Error())
 	}
-	defer func() {
-		_ = cluster.returnPeerClient(peer, clientConnection)
-	}()
-	clientConnection.Send(utils.ToCommandLine("SELECT", strconv.Itoa(connection.GetDBIndex())))
-	return clientConnection.Send(args)
+	// the database of the client is selected in the same round trip
+	pipe := peerClient.Pipeline()
+	_ = pipe.Process(context.Background(), client.NewStatusCmd("select", connection.GetDBIndex()))
+	cmd := client.NewCmd(args)
+	_ = pipe.Process(context.Background(), cmd)
+	_, _ = pipe.Exec(context.Background())
+	if cmd.Reply() == nil {
+		return reply.MakeStandardErrorReply(cmd.Err().Error())
+	}
+	return cmd.Reply()
 }
 
 func (cluster *ClusterDatabase) Broadcast(connection resp.Connection, args database.CommandLine) map[string]resp.Reply {
+	cluster.topologyLock.RLock()
+	nodes := cluster.nodes
+	cluster.topologyLock.RUnlock()
 	results := make(map[string]resp.Reply)
-	for _, peer := range cluster.nodes {
+	for _, peer := range nodes {
 		results[peer] = cluster.RelayToPeer(peer, connection, args)
 	}
 	return results
 }
+
+// GetPeers returns the addresses of the other nodes of the cluster
+func (cluster *ClusterDatabase) GetPeers() []string {
+	cluster.topologyLock.RLock()
+	defer cluster.topologyLock.RUnlock()
+	peers := make([]string, 0, len(cluster.nodes))
+	for _, node := range cluster.nodes {
+		if node != cluster.self {
+			peers = append(peers, node)
+		}
+	}
+	return peers
+}
+
+// IsPeer returns whether the connection comes from another node: it is authenticated with requirepass,
+// and comes from the host of a peer. Without requirepass, any client running on the host of a peer passes too.
+func (cluster *ClusterDatabase) IsPeer(connection resp.Connection) bool {
+	if connection.IsUnixSocket() || !cluster.database.IsAuthenticated(connection) {
+		return false
+	}
+	host, _, err := net.SplitHostPort(connection.RemoteAddr())
+	if err != nil {
+		return false
+	}
+	remote := net.ParseIP(host)
+	if remote == nil {
+		return false
+	}
+	cluster.topologyLock.RLock()
+	defer cluster.topologyLock.RUnlock()
+	for _, ips := range cluster.peerIPs {
+		for _, ip := range ips {
+			if ip.Equal(remote) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lookupPeerIPs resolves the host of peer, a peer which can not be resolved is never recognized by IsPeer
+func lookupPeerIPs(peer string) []net.IP {
+	host, _, err := net.SplitHostPort(peer)
+	if err != nil {
+		return nil
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		logger.Warn("failed to resolve peer " + peer + ": " + err.Error())
+		return nil
+	}
+	return ips
+}
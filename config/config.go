@@ -17,6 +17,15 @@ type ServerProperties struct {
 	MaxClients  int    `cfg:"maxclients"`
 	RequirePass string `cfg:"requirepass"`
 	Databases   int    `cfg:"databases"`
+	Dir         string `cfg:"dir"`
+
+	Timeout      int `cfg:"timeout"`       // seconds a client may stay idle, 0 never closes idle clients
+	TCPKeepAlive int `cfg:"tcp-keepalive"` // seconds between tcp keepalive probes, 0 disables them
+
+	ProtoMaxBulkLen        string `cfg:"proto-max-bulk-len"`        // e.g. "512mb"
+	ClientQueryBufferLimit string `cfg:"client-query-buffer-limit"` // e.g. "1gb"
+	// e.g. "pubsub 32mb 8mb 60", one line per class of clients
+	ClientOutputBufferLimit []string `cfg:"client-output-buffer-limit"`
 
 	AppendOnly                 bool   `cfg:"appendonly"`
 	AppendFilename             string `cfg:"appendfilename"`
@@ -28,6 +37,20 @@ type ServerProperties struct {
 
 	Peers []string `cfg:"peers"`
 	Self  string   `cfg:"self"`
+
+	TLSPort        int    `cfg:"tls-port"`
+	TLSCertFile    string `cfg:"tls-cert-file"`
+	TLSKeyFile     string `cfg:"tls-key-file"`
+	TLSCACertFile  string `cfg:"tls-ca-cert-file"`
+	TLSAuthClients string `cfg:"tls-auth-clients"` // yes, optional or no
+	TLSCluster     bool   `cfg:"tls-cluster"`      // the peers are dialed over tls
+
+	UnixSocket     string `cfg:"unixsocket"`
+	UnixSocketPerm string `cfg:"unixsocketperm"` // octal permissions of the socket file, like 700
+
+	HTTPPort int `cfg:"http-port"` // port of the http/json gateway, 0 disables it
+
+	LoadModules []string `cfg:"loadmodule" split:"no"` // one "path [arg ...]" per directive, the args may hold commas
 }
 
 // Properties global config properties
@@ -36,8 +59,8 @@ var Properties *ServerProperties
 func parse(src io.Reader) *ServerProperties {
 	config := &ServerProperties{}
 
-	// read config file
-	rawMap := make(map[string]string)
+	// read config file, a directive may appear more than once
+	rawMap := make(map[string][]string)
 	scanner := bufio.NewScanner(src)
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -48,7 +71,7 @@ func parse(src io.Reader) *ServerProperties {
 		if pivot > 0 && pivot < len(line)-1 { // separator found
 			key := line[0:pivot]
 			value := strings.Trim(line[pivot+1:], " ")
-			rawMap[strings.ToLower(key)] = value
+			rawMap[strings.ToLower(key)] = append(rawMap[strings.ToLower(key)], value)
 		}
 	}
 	if err := scanner.Err(); err != nil {
@@ -66,8 +89,10 @@ func parse(src io.Reader) *ServerProperties {
 		if !ok || strings.TrimLeft(key, " ") == "" {
 			key = field.Name
 		}
-		value, ok := rawMap[strings.ToLower(key)]
+		values, ok := rawMap[strings.ToLower(key)]
 		if ok {
+			// the last occurrence wins, except for slices which collect all of them
+			value := values[len(values)-1]
 			// fill config
 			switch field.Type.Kind() {
 			case reflect.String:
@@ -82,7 +107,16 @@ func parse(src io.Reader) *ServerProperties {
 				fieldVal.SetBool(boolValue)
 			case reflect.Slice:
 				if field.Type.Elem().Kind() == reflect.String {
-					slice := strings.Split(value, ",")
+					// a value is a comma separated list, unless the field keeps each directive whole
+					split := field.Tag.Get("split") != "no"
+					slice := make([]string, 0, len(values))
+					for _, value := range values {
+						if split {
+							slice = append(slice, strings.Split(value, ",")...)
+						} else {
+							slice = append(slice, value)
+						}
+					}
 					fieldVal.Set(reflect.ValueOf(slice))
 				}
 			}
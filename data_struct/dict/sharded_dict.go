@@ -15,10 +15,9 @@ const numShards = 16
 
 // ShardedDict is a thread-safe dictionary using sharding for performance.
 type ShardedDict struct {
-	shards  []*syncMapShard
-	count   int32
-	mutexes sync.Map // the mutexes for each key
-	random  *rand.Rand
+	shards []*syncMapShard
+	count  int32
+	random *rand.Rand
 }
 
 // syncMapShard holds a single shard's sync.Map and a mutex for synchronization.
@@ -193,12 +192,6 @@ func (dict *ShardedDict) Clear() {
 	atomic.SwapInt32(&dict.count, 0)
 }
 
-// GetMutexForKey gets the mutex for a given key
-func (dict *ShardedDict) GetMutexForKey(key string) *sync.Mutex {
-	actual, _ := dict.mutexes.LoadOrStore(key, &sync.Mutex{})
-	return actual.(*sync.Mutex)
-}
-
 // incrementCount increments the count of the dictionary.
 func (dict *ShardedDict) incrementCount() {
 	atomic.AddInt32(&dict.count, 1)
@@ -0,0 +1,92 @@
+package list
+
+// minCapacity is the smallest capacity of the ring buffer.
+const minCapacity = 8
+
+// Deque is a double-ended queue backed by a ring buffer, it is not thread-safe.
+type Deque struct {
+	items [][]byte
+	head  int // index of the first item
+	size  int // number of items
+}
+
+// MakeDeque returns a new instance of Deque.
+func MakeDeque() *Deque {
+	return &Deque{items: make([][]byte, minCapacity)}
+}
+
+// Len returns the number of items.
+func (deque *Deque) Len() int {
+	return deque.size
+}
+
+// index returns the position in the ring buffer of the i-th item.
+func (deque *Deque) index(i int) int {
+	return (deque.head + i) % len(deque.items)
+}
+
+// grow doubles the ring buffer when it is full.
+func (deque *Deque) grow() {
+	if deque.size < len(deque.items) {
+		return
+	}
+	items := make([][]byte, len(deque.items)*2)
+	for i := 0; i < deque.size; i++ {
+		items[i] = deque.items[deque.index(i)]
+	}
+	deque.items = items
+	deque.head = 0
+}
+
+// PushFront inserts the value before the first item.
+func (deque *Deque) PushFront(value []byte) {
+	deque.grow()
+	deque.head = (deque.head - 1 + len(deque.items)) % len(deque.items)
+	deque.items[deque.head] = value
+	deque.size++
+}
+
+// PushBack inserts the value after the last item.
+func (deque *Deque) PushBack(value []byte) {
+	deque.grow()
+	deque.items[deque.index(deque.size)] = value
+	deque.size++
+}
+
+// PopFront removes and returns the first item, or nil if the deque is empty.
+func (deque *Deque) PopFront() []byte {
+	if deque.size == 0 {
+		return nil
+	}
+	value := deque.items[deque.head]
+	deque.items[deque.head] = nil // let the value be collected
+	deque.head = deque.index(1)
+	deque.size--
+	return value
+}
+
+// PopBack removes and returns the last item, or nil if the deque is empty.
+func (deque *Deque) PopBack() []byte {
+	if deque.size == 0 {
+		return nil
+	}
+	last := deque.index(deque.size - 1)
+	value := deque.items[last]
+	deque.items[last] = nil
+	deque.size--
+	return value
+}
+
+// Get returns the i-th item, i must be in [0, Len()).
+func (deque *Deque) Get(i int) []byte {
+	return deque.items[deque.index(i)]
+}
+
+// Range returns the items in [start, stop).
+func (deque *Deque) Range(start int, stop int) [][]byte {
+	result := make([][]byte, 0, stop-start)
+	for i := start; i < stop; i++ {
+		result = append(result, deque.Get(i))
+	}
+	return result
+}
@@ -0,0 +1,138 @@
+package lock
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// numShards is the number of shards used to spread the lock table.
+const numShards = 16
+
+// LockManager hands out read/write locks per key.
+// A key's lock only lives while some command holds or waits for it.
+type LockManager struct {
+	shards []*lockShard
+	// keyspace is shared by the commands locking some keys, and taken alone by the ones touching every key
+	keyspace sync.RWMutex
+}
+
+// lockShard holds the locks of the keys hashed into it.
+type lockShard struct {
+	mutex sync.Mutex
+	locks map[string]*keyLock
+}
+
+// keyLock is the lock of a single key, refs counts its holders and waiters.
+type keyLock struct {
+	rwMutex sync.RWMutex
+	refs    int
+}
+
+// MakeLockManager returns a new instance of LockManager.
+func MakeLockManager() *LockManager {
+	shards := make([]*lockShard, numShards)
+	for i := 0; i < numShards; i++ {
+		shards[i] = &lockShard{locks: make(map[string]*keyLock)}
+	}
+	return &LockManager{shards: shards}
+}
+
+// shardForKey returns the shard for a given key.
+func (manager *LockManager) shardForKey(key string) *lockShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return manager.shards[h.Sum32()%uint32(numShards)]
+}
+
+// acquire returns the lock of the key and counts the caller as a holder.
+func (manager *LockManager) acquire(key string) *keyLock {
+	shard := manager.shardForKey(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	lock, ok := shard.locks[key]
+	if !ok {
+		lock = &keyLock{}
+		shard.locks[key] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+// release drops the caller from the holders and removes the lock once it is unused.
+func (manager *LockManager) release(key string) *keyLock {
+	shard := manager.shardForKey(key)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	lock := shard.locks[key]
+	lock.refs--
+	if lock.refs == 0 {
+		delete(shard.locks, key)
+	}
+	return lock
+}
+
+// sortedKeys merges write and read keys into a sorted, distinct list.
+// A key appearing in both lists is locked for writing.
+func sortedKeys(writeKeys []string, readKeys []string) ([]string, map[string]bool) {
+	isWrite := make(map[string]bool, len(writeKeys)+len(readKeys))
+	for _, key := range readKeys {
+		isWrite[key] = false
+	}
+	for _, key := range writeKeys {
+		isWrite[key] = true
+	}
+	keys := make([]string, 0, len(isWrite))
+	for key := range isWrite {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, isWrite
+}
+
+// Locks locks the write keys exclusively and the read keys shared.
+// Keys are always locked in sorted order, so two commands can never deadlock.
+func (manager *LockManager) Locks(writeKeys []string, readKeys []string) {
+	if len(writeKeys) == 0 && len(readKeys) == 0 {
+		return
+	}
+	manager.keyspace.RLock()
+	keys, isWrite := sortedKeys(writeKeys, readKeys)
+	for _, key := range keys {
+		lock := manager.acquire(key)
+		if isWrite[key] {
+			lock.rwMutex.Lock()
+		} else {
+			lock.rwMutex.RLock()
+		}
+	}
+}
+
+// Unlocks releases the locks taken by Locks with the same arguments.
+func (manager *LockManager) Unlocks(writeKeys []string, readKeys []string) {
+	if len(writeKeys) == 0 && len(readKeys) == 0 {
+		return
+	}
+	keys, isWrite := sortedKeys(writeKeys, readKeys)
+	// release in reverse order of acquisition
+	for i := len(keys) - 1; i >= 0; i-- {
+		key := keys[i]
+		lock := manager.release(key)
+		if isWrite[key] {
+			lock.rwMutex.Unlock()
+		} else {
+			lock.rwMutex.RUnlock()
+		}
+	}
+	manager.keyspace.RUnlock()
+}
+
+// LockAll locks the whole keyspace, it waits for the commands holding keys and keeps out the next ones
+func (manager *LockManager) LockAll() {
+	manager.keyspace.Lock()
+}
+
+// UnlockAll releases the lock taken by LockAll
+func (manager *LockManager) UnlockAll() {
+	manager.keyspace.Unlock()
+}
@@ -0,0 +1,126 @@
+package sortedset
+
+import "sort"
+
+// Element is a member of the sorted set and its score.
+type Element struct {
+	Member string
+	Score  float64
+}
+
+// SortedSet keeps its members ordered by score then member, it is not thread-safe.
+type SortedSet struct {
+	scores   map[string]float64 // member -> score
+	elements []*Element         // sorted by (Score, Member)
+}
+
+// MakeSortedSet returns a new instance of SortedSet.
+func MakeSortedSet() *SortedSet {
+	return &SortedSet{scores: make(map[string]float64)}
+}
+
+// less returns true if the element is ordered before (score, member).
+func less(element *Element, score float64, member string) bool {
+	if element.Score != score {
+		return element.Score < score
+	}
+	return element.Member < member
+}
+
+// search returns the position of (score, member) or where it would be inserted.
+func (set *SortedSet) search(score float64, member string) int {
+	return sort.Search(len(set.elements), func(i int) bool {
+		return !less(set.elements[i], score, member)
+	})
+}
+
+// Len returns the number of members.
+func (set *SortedSet) Len() int {
+	return len(set.elements)
+}
+
+// Get returns the score of the member.
+func (set *SortedSet) Get(member string) (float64, bool) {
+	score, ok := set.scores[member]
+	return score, ok
+}
+
+// Add adds the member or updates its score, returns true if the member is new.
+func (set *SortedSet) Add(member string, score float64) bool {
+	oldScore, exists := set.scores[member]
+	if exists {
+		if oldScore == score {
+			return false
+		}
+		set.removeElement(oldScore, member)
+	}
+	set.scores[member] = score
+	i := set.search(score, member)
+	set.elements = append(set.elements, nil)
+	copy(set.elements[i+1:], set.elements[i:])
+	set.elements[i] = &Element{Member: member, Score: score}
+	return !exists
+}
+
+// Remove removes the member, returns true if it existed.
+func (set *SortedSet) Remove(member string) bool {
+	score, exists := set.scores[member]
+	if !exists {
+		return false
+	}
+	delete(set.scores, member)
+	set.removeElement(score, member)
+	return true
+}
+
+// removeElement removes (score, member) from the ordered elements.
+func (set *SortedSet) removeElement(score float64, member string) {
+	i := set.search(score, member)
+	copy(set.elements[i:], set.elements[i+1:])
+	set.elements[len(set.elements)-1] = nil
+	set.elements = set.elements[:len(set.elements)-1]
+}
+
+// PopMin removes and returns up to count members with the lowest scores.
+func (set *SortedSet) PopMin(count int) []*Element {
+	if count > len(set.elements) {
+		count = len(set.elements)
+	}
+	result := make([]*Element, count)
+	copy(result, set.elements[:count])
+	for _, element := range result {
+		delete(set.scores, element.Member)
+	}
+	set.elements = append(set.elements[:0], set.elements[count:]...)
+	return result
+}
+
+// PopMax removes and returns up to count members with the highest scores, highest first.
+func (set *SortedSet) PopMax(count int) []*Element {
+	if count > len(set.elements) {
+		count = len(set.elements)
+	}
+	result := make([]*Element, count)
+	for i := 0; i < count; i++ {
+		result[i] = set.elements[len(set.elements)-1-i]
+		delete(set.scores, result[i].Member)
+	}
+	set.elements = set.elements[:len(set.elements)-count]
+	return result
+}
+
+// Range returns the elements ranked in [start, stop) by ascending order.
+func (set *SortedSet) Range(start int, stop int) []*Element {
+	result := make([]*Element, stop-start)
+	copy(result, set.elements[start:stop])
+	return result
+}
+
+// ForEach iterates over the elements by ascending order until consumer returns false.
+func (set *SortedSet) ForEach(consumer func(element *Element) bool) {
+	for _, element := range set.elements {
+		if !consumer(element) {
+			return
+		}
+	}
+}
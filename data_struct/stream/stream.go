@@ -0,0 +1,257 @@
+package stream
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ID identifies an entry of the stream, it is formatted as <ms>-<seq>.
+type ID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MaxID is greater than any other ID.
+var MaxID = ID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+// ErrInvalidID is returned when an ID can not be parsed.
+var ErrInvalidID = errors.New("ERR Invalid stream ID specified as stream command argument")
+
+// ParseID parses <ms>-<seq> or <ms>, a missing sequence is replaced by missingSeq.
+func ParseID(src string, missingSeq uint64) (ID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(src, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return ID{}, ErrInvalidID
+	}
+	if !hasSeq {
+		return ID{Ms: ms, Seq: missingSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return ID{}, ErrInvalidID
+	}
+	return ID{Ms: ms, Seq: seq}, nil
+}
+
+// String formats the ID as <ms>-<seq>.
+func (id ID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Less returns true if id is ordered before other.
+func (id ID) Less(other ID) bool {
+	if id.Ms != other.Ms {
+		return id.Ms < other.Ms
+	}
+	return id.Seq < other.Seq
+}
+
+// Next returns the smallest ID greater than id.
+func (id ID) Next() ID {
+	if id.Seq == math.MaxUint64 {
+		return ID{Ms: id.Ms + 1}
+	}
+	return ID{Ms: id.Ms, Seq: id.Seq + 1}
+}
+
+// Entry is an entry of the stream.
+type Entry struct {
+	ID     ID
+	Fields [][]byte // field value [field value ...]
+}
+
+// PendingEntry is an entry delivered to a consumer but not acknowledged yet.
+type PendingEntry struct {
+	Consumer      string
+	DeliveryCount int64
+}
+
+// Group is a consumer group of the stream.
+type Group struct {
+	Name          string
+	LastDelivered ID
+	Pending       map[ID]*PendingEntry
+}
+
+// Stream is an append-only log of entries, it is not thread-safe.
+type Stream struct {
+	entries []*Entry // sorted by ID
+	lastID  ID
+	groups  map[string]*Group
+}
+
+// MakeStream returns a new instance of Stream.
+func MakeStream() *Stream {
+	return &Stream{groups: make(map[string]*Group)}
+}
+
+// Len returns the number of entries.
+func (stream *Stream) Len() int {
+	return len(stream.entries)
+}
+
+// LastID returns the ID of the last entry ever added.
+func (stream *Stream) LastID() ID {
+	return stream.lastID
+}
+
+// Add appends an entry, the id must be greater than the last ID.
+func (stream *Stream) Add(id ID, fields [][]byte) bool {
+	if !stream.lastID.Less(id) {
+		return false
+	}
+	stream.entries = append(stream.entries, &Entry{ID: id, Fields: fields})
+	stream.lastID = id
+	return true
+}
+
+// NextID returns the ID an auto-generated entry gets at the given millisecond.
+func (stream *Stream) NextID(ms uint64) ID {
+	if ms > stream.lastID.Ms {
+		return ID{Ms: ms}
+	}
+	return stream.lastID.Next()
+}
+
+// Trim removes the oldest entries until at most maxLen are left, returns the number removed.
+func (stream *Stream) Trim(maxLen int) int {
+	removed := len(stream.entries) - maxLen
+	if removed <= 0 {
+		return 0
+	}
+	for i := 0; i < removed; i++ {
+		stream.entries[i] = nil
+	}
+	stream.entries = stream.entries[removed:]
+	return removed
+}
+
+// search returns the position of the first entry whose ID is not less than id.
+func (stream *Stream) search(id ID) int {
+	return sort.Search(len(stream.entries), func(i int) bool {
+		return !stream.entries[i].ID.Less(id)
+	})
+}
+
+// Range returns the entries whose ID is in [start, end], at most count entries if count > 0.
+func (stream *Stream) Range(start ID, end ID, count int) []*Entry {
+	var result []*Entry
+	for i := stream.search(start); i < len(stream.entries); i++ {
+		entry := stream.entries[i]
+		if end.Less(entry.ID) || (count > 0 && len(result) >= count) {
+			break
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// Get returns the entry with the given ID.
+func (stream *Stream) Get(id ID) (*Entry, bool) {
+	i := stream.search(id)
+	if i < len(stream.entries) && stream.entries[i].ID == id {
+		return stream.entries[i], true
+	}
+	return nil, false
+}
+
+// ForEach iterates over the entries until consumer returns false.
+func (stream *Stream) ForEach(consumer func(entry *Entry) bool) {
+	for _, entry := range stream.entries {
+		if !consumer(entry) {
+			return
+		}
+	}
+}
+
+// CreateGroup creates a consumer group, returns false if it exists.
+func (stream *Stream) CreateGroup(name string, lastDelivered ID) bool {
+	if _, exists := stream.groups[name]; exists {
+		return false
+	}
+	stream.groups[name] = &Group{Name: name, LastDelivered: lastDelivered, Pending: make(map[ID]*PendingEntry)}
+	return true
+}
+
+// GetGroup returns the consumer group with the given name.
+func (stream *Stream) GetGroup(name string) (*Group, bool) {
+	group, ok := stream.groups[name]
+	return group, ok
+}
+
+// Groups returns the consumer groups ordered by name.
+func (stream *Stream) Groups() []*Group {
+	groups := make([]*Group, 0, len(stream.groups))
+	for _, group := range stream.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
+
+// ReadNew delivers the entries after the last delivered one to the consumer.
+// The entries are added to the pending list unless noAck is set.
+func (stream *Stream) ReadNew(group *Group, consumer string, count int, noAck bool) []*Entry {
+	entries := stream.Range(group.LastDelivered.Next(), MaxID, count)
+	for _, entry := range entries {
+		group.LastDelivered = entry.ID
+		if !noAck {
+			group.Pending[entry.ID] = &PendingEntry{Consumer: consumer, DeliveryCount: 1}
+		}
+	}
+	return entries
+}
+
+// ReadPending returns the entries pending for the consumer whose ID is greater than start.
+// A pending entry which was trimmed from the stream is returned with nil fields.
+func (stream *Stream) ReadPending(group *Group, consumer string, start ID, count int) []*Entry {
+	ids := make([]ID, 0)
+	for id, pending := range group.Pending {
+		if pending.Consumer == consumer && start.Less(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Less(ids[j])
+	})
+	if count > 0 && len(ids) > count {
+		ids = ids[:count]
+	}
+	result := make([]*Entry, len(ids))
+	for i, id := range ids {
+		group.Pending[id].DeliveryCount++
+		if entry, ok := stream.Get(id); ok {
+			result[i] = entry
+		} else {
+			result[i] = &Entry{ID: id}
+		}
+	}
+	return result
+}
+
+// Ack removes the entries from the pending list of the group, returns the number removed.
+func (group *Group) Ack(ids ...ID) int {
+	acked := 0
+	for _, id := range ids {
+		if _, ok := group.Pending[id]; ok {
+			delete(group.Pending, id)
+			acked++
+		}
+	}
+	return acked
+}
+
+// DestroyGroup removes the consumer group, returns false if it does not exist.
+func (stream *Stream) DestroyGroup(name string) bool {
+	if _, exists := stream.groups[name]; !exists {
+		return false
+	}
+	delete(stream.groups, name)
+	return true
+}
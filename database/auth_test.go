@@ -0,0 +1,38 @@
+package database
+
+import (
+	"go-redis/config"
+	"go-redis/resp/connection"
+	"testing"
+)
+
+func TestFailedAuthKeepsClientAuthenticated(t *testing.T) {
+	database := NewStandaloneDatabase(&config.ServerProperties{Databases: 1, RequirePass: "secret"})
+	t.Cleanup(database.Close)
+	client := connection.NewConnection(nil)
+	if got := execString(database, client, "AUTH", "secret"); got != "+OK\r\n" {
+		t.Fatalf("AUTH = %q", got)
+	}
+	tests := [][]string{
+		{"AUTH", "wrong"},
+		{"AUTH", "default", "wrong"},
+		{"AUTH", "someone", "secret"},
+		{"HELLO", "3", "AUTH", "default", "wrong"},
+	}
+	for _, args := range tests {
+		if got := execString(database, client, args...); got[0] != '-' {
+			t.Errorf("%v = %q, want an error", args, got)
+		}
+		if got := execString(database, client, "SET", "key", "value"); got != "+OK\r\n" {
+			t.Errorf("SET after %v = %q, the client was logged out", args, got)
+		}
+	}
+}
+
+func TestHelloAuthWithoutPassword(t *testing.T) {
+	database := makeTestDatabase(t)
+	client := connection.NewConnection(nil)
+	if got := execString(database, client, "HELLO", "2", "AUTH", "default", "anything"); got[0] != '*' {
+		t.Errorf("HELLO AUTH = %q, want the server properties", got)
+	}
+}
@@ -0,0 +1,262 @@
+package database
+
+import (
+	"container/list"
+	"go-redis/interface/resp"
+	"go-redis/lib/timewheel"
+	"go-redis/resp/reply"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// blockedReply is returned by a blocking command which found nothing to serve,
+// the client waits until a write command makes try succeed or the timeout expires.
+type blockedReply struct {
+	keys         []string      // the keys the client waits on
+	writeKeys    []string      // the keys locked for writing when trying again
+	readKeys     []string      // the keys locked for reading when trying again
+	timeout      time.Duration // zero blocks forever
+	try          func(dict *DictEntity) (resp.Reply, bool)
+	timeoutReply resp.Reply
+	result       chan resp.Reply
+}
+
+// makeBlockedReply returns a blocked reply, try is called with the keys locked and returns false while there is nothing to serve
+func makeBlockedReply(keys []string, writeKeys []string, readKeys []string, timeout time.Duration,
+	try func(dict *DictEntity) (resp.Reply, bool)) *blockedReply {
+	return &blockedReply{
+		keys:         keys,
+		writeKeys:    writeKeys,
+		readKeys:     readKeys,
+		timeout:      timeout,
+		try:          try,
+		timeoutReply: reply.MakeNullMultiBulkReply(),
+		result:       make(chan resp.Reply, 1),
+	}
+}
+
+// ToBytes returns nothing, the handler writes the reply received from Wait
+func (r *blockedReply) ToBytes() []byte {
+	return nil
+}
+
+// Wait returns the channel delivering the final reply
+func (r *blockedReply) Wait() <-chan resp.Reply {
+	return r.result
+}
+
+// blockKey identifies a key of a database
+type blockKey struct {
+	dbIndex int
+	key     string
+}
+
+// waiter is a client blocked on some keys
+type waiter struct {
+	client   resp.Connection
+	dict     *DictEntity
+	reply    *blockedReply
+	elements map[blockKey]*list.Element // the position of the waiter in each queue
+	mutex    sync.Mutex                 // serializes serving with timeout and cancellation
+	finished bool
+}
+
+// blockingManager keeps a FIFO queue of waiters per key, and serves them after write commands
+type blockingManager struct {
+	mutex     sync.Mutex
+	queues    map[blockKey]*list.List     // key -> queue of *waiter
+	clients   map[resp.Connection]*waiter // a client blocks on one command at a time
+	count     int32                       // the number of waiters, read without the lock
+	timeWheel *timewheel.TimeWheel
+}
+
+// makeBlockingManager creates a blocking manager, the timeouts have a precision of 10ms
+func makeBlockingManager() *blockingManager {
+	timeWheel := timewheel.New(10*time.Millisecond, 3600)
+	timeWheel.Start()
+	return &blockingManager{
+		queues:    make(map[blockKey]*list.List),
+		clients:   make(map[resp.Connection]*waiter),
+		timeWheel: timeWheel,
+	}
+}
+
+// block enqueues the client on the keys of the blocked reply, it is called with the keys locked
+func (manager *blockingManager) block(client resp.Connection, dict *DictEntity, blocked *blockedReply) {
+	w := &waiter{
+		client:   client,
+		dict:     dict,
+		reply:    blocked,
+		elements: make(map[blockKey]*list.Element),
+	}
+	manager.mutex.Lock()
+	for _, key := range blocked.keys {
+		bk := blockKey{dbIndex: dict.index, key: key}
+		if _, ok := w.elements[bk]; ok {
+			continue
+		}
+		queue, ok := manager.queues[bk]
+		if !ok {
+			queue = list.New()
+			manager.queues[bk] = queue
+		}
+		w.elements[bk] = queue.PushBack(w)
+	}
+	manager.clients[client] = w
+	atomic.AddInt32(&manager.count, 1)
+	manager.mutex.Unlock()
+
+	client.SetBlocked(true)
+	if blocked.timeout > 0 {
+		manager.timeWheel.AddJob(blocked.timeout, manager.timerKey(w), func() {
+			manager.finish(w, blocked.timeoutReply)
+		})
+	}
+}
+
+// timerKey returns the key of the timeout job of the waiter
+func (manager *blockingManager) timerKey(w *waiter) string {
+	return "blocking:" + strconv.FormatInt(w.client.GetID(), 10)
+}
+
+// remove takes the waiter out of every queue
+func (manager *blockingManager) remove(w *waiter) {
+	manager.mutex.Lock()
+	for bk, element := range w.elements {
+		queue := manager.queues[bk]
+		queue.Remove(element)
+		if queue.Len() == 0 {
+			delete(manager.queues, bk)
+		}
+	}
+	if manager.clients[w.client] == w {
+		delete(manager.clients, w.client)
+	}
+	atomic.AddInt32(&manager.count, -1)
+	manager.mutex.Unlock()
+
+	manager.timeWheel.RemoveJob(manager.timerKey(w))
+	w.client.SetBlocked(false)
+}
+
+// finish unblocks the waiter with the given reply, nil delivers nothing.
+// It returns false if the waiter was unblocked already.
+func (manager *blockingManager) finish(w *waiter, result resp.Reply) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.finished {
+		return false
+	}
+	w.finished = true
+	manager.remove(w)
+	if result != nil {
+		w.reply.result <- result
+	}
+	return true
+}
+
+// serve tries to serve the waiter, returns true if it is unblocked
+func (manager *blockingManager) serve(w *waiter) bool {
+	dict := w.dict
+	dict.locker.Locks(w.reply.writeKeys, w.reply.readKeys)
+	defer dict.locker.Unlocks(w.reply.writeKeys, w.reply.readKeys)
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.finished {
+		return false
+	}
+	result, ok := w.reply.try(dict)
+	if !ok {
+		return false
+	}
+	w.finished = true
+	manager.remove(w)
+	w.reply.result <- result
+	return true
+}
+
+// waitersOf returns a snapshot of the queue of the key
+func (manager *blockingManager) waitersOf(bk blockKey) []*waiter {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	queue, ok := manager.queues[bk]
+	if !ok {
+		return nil
+	}
+	waiters := make([]*waiter, 0, queue.Len())
+	for element := queue.Front(); element != nil; element = element.Next() {
+		waiters = append(waiters, element.Value.(*waiter))
+	}
+	return waiters
+}
+
+// signal serves the waiters of the keys written by a command in FIFO order,
+// the keys written while serving, like the destination of BLMOVE, are signalled in turn
+func (manager *blockingManager) signal(dbIndex int, keys []string) {
+	if atomic.LoadInt32(&manager.count) == 0 {
+		return
+	}
+	pending := append([]string(nil), keys...)
+	for len(pending) > 0 {
+		key := pending[0]
+		pending = pending[1:]
+		for _, w := range manager.waitersOf(blockKey{dbIndex: dbIndex, key: key}) {
+			if manager.serve(w) {
+				w.dict.tracking.invalidate(w.client, w.reply.writeKeys)
+				pending = append(pending, w.reply.writeKeys...)
+			}
+		}
+	}
+}
+
+// unblock unblocks the client with the given reply, nil means the reply of a timeout.
+// It returns false if the client is not blocked.
+func (manager *blockingManager) unblock(client resp.Connection, result resp.Reply) bool {
+	manager.mutex.Lock()
+	w, ok := manager.clients[client]
+	manager.mutex.Unlock()
+	if !ok {
+		return false
+	}
+	if result == nil {
+		result = w.reply.timeoutReply
+	}
+	return manager.finish(w, result)
+}
+
+// unblockClient drops the waiter of a closed client
+func (manager *blockingManager) unblockClient(client resp.Connection) {
+	manager.mutex.Lock()
+	w, ok := manager.clients[client]
+	manager.mutex.Unlock()
+	if ok {
+		manager.finish(w, nil)
+	}
+}
+
+// blockedCount returns the number of blocked clients
+func (manager *blockingManager) blockedCount() int {
+	if manager == nil {
+		return 0
+	}
+	return int(atomic.LoadInt32(&manager.count))
+}
+
+// close stops the timeouts
+func (manager *blockingManager) close() {
+	manager.timeWheel.Stop()
+}
+
+// parseTimeout parses the timeout of a blocking command given in seconds
+func parseTimeout(arg []byte) (time.Duration, resp.ErrorReply) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil {
+		return 0, reply.MakeStandardErrorReply("ERR timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, reply.MakeStandardErrorReply("ERR timeout is negative")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
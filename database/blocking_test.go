@@ -0,0 +1,160 @@
+package database
+
+import (
+	"go-redis/config"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/connection"
+	"testing"
+	"time"
+)
+
+func makeTestDatabase(t *testing.T) *StandaloneDatabase {
+	database := NewStandaloneDatabase(&config.ServerProperties{Databases: 1})
+	t.Cleanup(database.Close)
+	return database
+}
+
+// execString executes a command and returns the bytes of its reply
+func execString(database *StandaloneDatabase, client resp.Connection, args ...string) string {
+	return string(database.Exec(client, utils.ToCommandLine(args...)).ToBytes())
+}
+
+// waitReply returns the final reply of a blocked command, or fails after a second
+func waitReply(t *testing.T, result resp.Reply) string {
+	t.Helper()
+	blocking, ok := result.(resp.BlockingReply)
+	if !ok {
+		t.Fatalf("expected a blocked reply, got %q", result.ToBytes())
+	}
+	select {
+	case final := <-blocking.Wait():
+		return string(final.ToBytes())
+	case <-time.After(time.Second):
+		t.Fatal("the blocked command was not served")
+		return ""
+	}
+}
+
+// assertBlocked fails if the blocked command was served already
+func assertBlocked(t *testing.T, result resp.Reply) {
+	t.Helper()
+	select {
+	case final := <-result.(resp.BlockingReply).Wait():
+		t.Fatalf("expected the command to block, got %q", final.ToBytes())
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestBLPopServesAvailableElement(t *testing.T) {
+	database := makeTestDatabase(t)
+	client := connection.NewConnection(nil)
+	execString(database, client, "RPUSH", "list", "a", "b")
+	if got, want := execString(database, client, "BLPOP", "empty", "list", "0"), "*2\r\n$4\r\nlist\r\n$1\r\na\r\n"; got != want {
+		t.Errorf("BLPOP = %q, want %q", got, want)
+	}
+}
+
+func TestBLPopIsServedByPush(t *testing.T) {
+	database := makeTestDatabase(t)
+	blocked := connection.NewConnection(nil)
+	result := database.Exec(blocked, utils.ToCommandLine("BLPOP", "list", "0"))
+	assertBlocked(t, result)
+	if !blocked.IsBlocked() {
+		t.Error("the client is not flagged as blocked")
+	}
+
+	execString(database, connection.NewConnection(nil), "RPUSH", "list", "a")
+	if got, want := waitReply(t, result), "*2\r\n$4\r\nlist\r\n$1\r\na\r\n"; got != want {
+		t.Errorf("BLPOP = %q, want %q", got, want)
+	}
+	if blocked.IsBlocked() {
+		t.Error("the client is still flagged as blocked")
+	}
+	if got := execString(database, blocked, "LLEN", "list"); got != ":0\r\n" {
+		t.Errorf("LLEN = %q, the element was not popped", got)
+	}
+}
+
+func TestBlockedClientsAreServedInOrder(t *testing.T) {
+	database := makeTestDatabase(t)
+	first := database.Exec(connection.NewConnection(nil), utils.ToCommandLine("BRPOP", "list", "0"))
+	second := database.Exec(connection.NewConnection(nil), utils.ToCommandLine("BRPOP", "list", "0"))
+	assertBlocked(t, first)
+	assertBlocked(t, second)
+
+	pusher := connection.NewConnection(nil)
+	execString(database, pusher, "LPUSH", "list", "a")
+	if got, want := waitReply(t, first), "*2\r\n$4\r\nlist\r\n$1\r\na\r\n"; got != want {
+		t.Errorf("first BRPOP = %q, want %q", got, want)
+	}
+	assertBlocked(t, second)
+	execString(database, pusher, "LPUSH", "list", "b")
+	if got, want := waitReply(t, second), "*2\r\n$4\r\nlist\r\n$1\r\nb\r\n"; got != want {
+		t.Errorf("second BRPOP = %q, want %q", got, want)
+	}
+}
+
+func TestBLPopTimesOut(t *testing.T) {
+	database := makeTestDatabase(t)
+	blocked := connection.NewConnection(nil)
+	result := database.Exec(blocked, utils.ToCommandLine("BLPOP", "list", "0.05"))
+	if got, want := waitReply(t, result), "*-1\r\n"; got != want {
+		t.Errorf("BLPOP = %q, want %q", got, want)
+	}
+	if blocked.IsBlocked() {
+		t.Error("the client is still flagged as blocked")
+	}
+}
+
+func TestBLMoveWakesClientBlockedOnDestination(t *testing.T) {
+	database := makeTestDatabase(t)
+	second := database.Exec(connection.NewConnection(nil), utils.ToCommandLine("BLPOP", "destination", "0"))
+	first := database.Exec(connection.NewConnection(nil), utils.ToCommandLine("BLMOVE", "source", "destination", "LEFT", "RIGHT", "0"))
+	assertBlocked(t, first)
+	assertBlocked(t, second)
+
+	execString(database, connection.NewConnection(nil), "RPUSH", "source", "a")
+	if got, want := waitReply(t, first), "$1\r\na\r\n"; got != want {
+		t.Errorf("BLMOVE = %q, want %q", got, want)
+	}
+	if got, want := waitReply(t, second), "*2\r\n$11\r\ndestination\r\n$1\r\na\r\n"; got != want {
+		t.Errorf("BLPOP = %q, want %q", got, want)
+	}
+}
+
+func TestBZPopMinIsServedByZAdd(t *testing.T) {
+	database := makeTestDatabase(t)
+	result := database.Exec(connection.NewConnection(nil), utils.ToCommandLine("BZPOPMIN", "zset", "0"))
+	assertBlocked(t, result)
+
+	execString(database, connection.NewConnection(nil), "ZADD", "zset", "2", "b", "1", "a")
+	if got, want := waitReply(t, result), "*3\r\n$4\r\nzset\r\n$1\r\na\r\n$1\r\n1\r\n"; got != want {
+		t.Errorf("BZPOPMIN = %q, want %q", got, want)
+	}
+}
+
+func TestUnblockedClientLeavesQueue(t *testing.T) {
+	database := makeTestDatabase(t)
+	closed := connection.NewConnection(nil)
+	database.Exec(closed, utils.ToCommandLine("BLPOP", "list", "0"))
+	database.AfterClientClose(closed)
+	waiting := database.Exec(connection.NewConnection(nil), utils.ToCommandLine("BLPOP", "list", "0"))
+
+	execString(database, connection.NewConnection(nil), "RPUSH", "list", "a")
+	if got, want := waitReply(t, waiting), "*2\r\n$4\r\nlist\r\n$1\r\na\r\n"; got != want {
+		t.Errorf("BLPOP = %q, want %q", got, want)
+	}
+}
+
+func TestXReadBlockIsServedByXAdd(t *testing.T) {
+	database := makeTestDatabase(t)
+	result := database.Exec(connection.NewConnection(nil), utils.ToCommandLine("XREAD", "BLOCK", "0", "STREAMS", "stream", "$"))
+	assertBlocked(t, result)
+
+	execString(database, connection.NewConnection(nil), "XADD", "stream", "1-1", "field", "value")
+	want := "*1\r\n*2\r\n$6\r\nstream\r\n*1\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$5\r\nfield\r\n$5\r\nvalue\r\n"
+	if got := waitReply(t, result); got != want {
+		t.Errorf("XREAD = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// execClient executes the client commands.
+// CLIENT LIST | ID | GETNAME | SETNAME name | UNBLOCK id [TIMEOUT|ERROR]
+// CLIENT TRACKING ON|OFF [options] | CACHING YES|NO | GETREDIR | TRACKINGINFO
+func execClient(db *StandaloneDatabase, c resp.Connection, args database.CommandLine) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgsNumErrorReply("client")
+	}
+	subCommand := strings.ToLower(string(args[0]))
+	switch subCommand {
+	case "list":
+		if len(args) != 1 {
+			return reply.MakeSyntaxErrorReply()
+		}
+		return db.clientList()
+	case "id":
+		return reply.MakeIntReply(c.GetID())
+	case "getname":
+		if c.GetName() == "" {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeBulkReply([]byte(c.GetName()))
+	case "setname":
+		if len(args) != 2 {
+			return reply.MakeArgsNumErrorReply("client|setname")
+		}
+		name := string(args[1])
+		if !isValidClientName(name) {
+			return makeInvalidClientNameReply()
+		}
+		c.SetName(name)
+		return reply.MakeOkReply()
+	case "unblock":
+		return db.clientUnblock(args[1:])
+	case "tracking":
+		return execClientTracking(db, c, args[1:])
+	case "caching":
+		return execClientCaching(db, c, args[1:])
+	case "getredir":
+		return execClientGetRedir(db, c)
+	case "trackinginfo":
+		return execClientTrackingInfo(db, c)
+	}
+	return reply.MakeStandardErrorReply("ERR unknown subcommand '" + string(args[0]) + "'. Try CLIENT HELP.")
+}
+
+// clientList formats one line per connected client
+func (db *StandaloneDatabase) clientList() resp.Reply {
+	clients := make([]resp.Connection, 0)
+	db.clients.Range(func(_, value interface{}) bool {
+		clients = append(clients, value.(resp.Connection))
+		return true
+	})
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].GetID() < clients[j].GetID()
+	})
+	now := time.Now()
+	var builder strings.Builder
+	for _, client := range clients {
+		builder.WriteString("id=" + strconv.FormatInt(client.GetID(), 10))
+		builder.WriteString(" addr=" + client.RemoteAddr())
+		builder.WriteString(" name=" + client.GetName())
+		builder.WriteString(" age=" + strconv.Itoa(int(now.Sub(client.GetCreatedAt()).Seconds())))
+		builder.WriteString(" idle=" + strconv.Itoa(int(now.Sub(client.GetLastInteraction()).Seconds())))
+		builder.WriteString(" flags=" + db.clientFlags(client))
+		builder.WriteString(" db=" + strconv.Itoa(client.GetDBIndex()))
+		builder.WriteString(" sub=" + strconv.Itoa(len(client.GetChannels())))
+		builder.WriteString(" psub=" + strconv.Itoa(len(client.GetPatterns())))
+		builder.WriteString(" ssub=" + strconv.Itoa(client.ShardSubsCount()))
+		builder.WriteString(" cmd=" + client.GetLastCommand())
+		builder.WriteString("\n")
+	}
+	return reply.MakeVerbatimReply("txt", []byte(builder.String()))
+}
+
+// clientFlags returns the flags of the client reported by CLIENT LIST
+func (db *StandaloneDatabase) clientFlags(client resp.Connection) string {
+	flags := ""
+	if client.IsBlocked() {
+		flags += "b"
+	}
+	if tc, ok := db.tracking.get(client); ok {
+		flags += "t"
+		if tc.bcast {
+			flags += "B"
+		}
+	}
+	if client.SubsCount() > 0 || client.ShardSubsCount() > 0 {
+		flags += "P"
+	}
+	if client.IsUnixSocket() {
+		flags += "U"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+	return flags
+}
+
+// clientUnblock unblocks a client waiting in a blocking command
+// CLIENT UNBLOCK id [TIMEOUT|ERROR]
+func (db *StandaloneDatabase) clientUnblock(args database.CommandLine) resp.Reply {
+	if len(args) != 1 && len(args) != 2 {
+		return reply.MakeArgsNumErrorReply("client|unblock")
+	}
+	id, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil {
+		return reply.MakeStandardErrorReply("ERR value is not an integer or out of range")
+	}
+	withError := false
+	if len(args) == 2 {
+		switch strings.ToLower(string(args[1])) {
+		case "timeout":
+		case "error":
+			withError = true
+		default:
+			return reply.MakeStandardErrorReply("ERR CLIENT UNBLOCK reason should be TIMEOUT or ERROR")
+		}
+	}
+	value, ok := db.clients.Load(id)
+	if !ok {
+		return reply.MakeIntReply(0)
+	}
+	var result resp.Reply
+	if withError {
+		result = reply.MakeStandardErrorReply("UNBLOCKED client unblocked via CLIENT UNBLOCK")
+	}
+	if db.blocking.unblock(value.(resp.Connection), result) {
+		return reply.MakeIntReply(1)
+	}
+	return reply.MakeIntReply(0)
+}
+
+// isValidClientName returns false if the name contains spaces or newlines
+func isValidClientName(name string) bool {
+	return !strings.ContainsAny(name, " \n")
+}
+
+// makeInvalidClientNameReply returns the error replied to an invalid client name
+func makeInvalidClientNameReply() resp.Reply {
+	return reply.MakeStandardErrorReply("ERR Client names cannot contain spaces, newlines or special characters.")
+}
@@ -3,9 +3,11 @@ package database
 import (
 	"go-redis/interface/resp"
 	"strings"
+	"sync"
 )
 
-var commandTable = make(map[string]*command)
+// commandTable maps the lower-case command name to *command, modules may change it at runtime
+var commandTable sync.Map
 
 // ExecFunc is a function that executes a commands in a database
 type ExecFunc func(dict *DictEntity, args [][]byte) resp.Reply
@@ -13,20 +15,98 @@ type ExecFunc func(dict *DictEntity, args [][]byte) resp.Reply
 // ExecSysFunc is a function that executes a commands in a connection
 type ExecSysFunc func(dict *resp.Connection, args [][]byte) resp.Reply
 
+// PrepareFunc analyses the command line and returns the keys to lock for writing and reading
+type PrepareFunc func(args [][]byte) (writeKeys []string, readKeys []string)
+
 type command struct {
 	connExecutor ExecSysFunc // the function to execute the command when connection
 	executor     ExecFunc    // the function to execute the command
+	prepare      PrepareFunc // the function to get the keys the command touches
+	keyspace     bool        // the command touches every key, so it locks the whole database
 	arity        int         // the number of arguments required by the command
 }
 
 // RegisterCommand registers a new commands
-func RegisterCommand(name string, executor ExecFunc, arity int) {
+func RegisterCommand(name string, executor ExecFunc, prepare PrepareFunc, arity int) {
+	name = strings.ToLower(name)
+	commandTable.Store(name, &command{executor: executor, prepare: prepare, arity: arity})
+}
+
+// RegisterKeyspaceCommand registers a command touching every key of the database, e.g. FLUSHDB.
+// No other command of the database runs meanwhile.
+func RegisterKeyspaceCommand(name string, executor ExecFunc, arity int) {
 	name = strings.ToLower(name)
-	commandTable[name] = &command{executor: executor, arity: arity}
+	commandTable.Store(name, &command{executor: executor, keyspace: true, arity: arity})
 }
 
-// RegisterSysCommand registers a new system commands
+// RegisterSysCommand registers a new system commands, they run without locks so they must not touch the keys
 func RegisterSysCommand(name string, connExecutor ExecSysFunc, arity int) {
 	name = strings.ToLower(name)
-	commandTable[name] = &command{connExecutor: connExecutor, arity: arity}
+	commandTable.Store(name, &command{connExecutor: connExecutor, arity: arity})
+}
+
+// UnregisterCommand removes a command, it is used when a module is unloaded
+func UnregisterCommand(name string) {
+	commandTable.Delete(strings.ToLower(name))
+}
+
+// HasCommand returns true if a command with the given name is registered, or is one the server executes itself
+func HasCommand(name string) bool {
+	name = strings.ToLower(name)
+	if _, ok := serverCommands[name]; ok {
+		return true
+	}
+	_, ok := commandTable.Load(name)
+	return ok
+}
+
+// getCommand returns the command with the given lower-case name
+func getCommand(name string) (*command, bool) {
+	value, ok := commandTable.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return value.(*command), true
+}
+
+// CommandKeys returns the keys the command line touches, it returns false if the command is unknown or has a wrong arity
+func CommandKeys(args [][]byte) ([]string, bool) {
+	command, ok := getCommand(strings.ToLower(string(args[0])))
+	if !ok || command.prepare == nil {
+		return nil, false
+	}
+	arity := command.arity
+	if (arity >= 0 && len(args) != arity) || (arity < 0 && len(args) < -arity) {
+		return nil, false
+	}
+	writeKeys, readKeys := command.prepare(args[1:])
+	return append(writeKeys, readKeys...), true
+}
+
+// readFirstKey locks the first argument for reading
+func readFirstKey(args [][]byte) ([]string, []string) {
+	return nil, []string{string(args[0])}
+}
+
+// writeFirstKey locks the first argument for writing
+func writeFirstKey(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, nil
+}
+
+// readAllKeys locks every argument for reading
+func readAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
+	}
+	return nil, keys
+}
+
+// writeAllKeys locks every argument for writing
+func writeAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
+	}
+	return keys, nil
 }
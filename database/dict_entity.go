@@ -2,6 +2,7 @@ package database
 
 import (
 	"go-redis/data_struct/dict"
+	"go-redis/data_struct/lock"
 	"go-redis/interface/database"
 	dictInterface "go-redis/interface/dict"
 	"go-redis/interface/resp"
@@ -13,17 +14,25 @@ import (
 type DictEntity struct {
 	index      int // the index of the database
 	dict       dictInterface.Dict
+	locker     *lock.LockManager // locks the keys of a command while it executes
 	addAofFunc func(database.CommandLine)
+	blocking   *blockingManager // serves the clients blocked on the keys of this database
+	tracking   *trackingTable   // invalidates the keys cached by clients
 }
 
 // MakeDatabase creates a new database
 func MakeDatabase() *DictEntity {
-	return &DictEntity{index: 0, dict: dict.MakeShardedDict(), addAofFunc: func(commandLine database.CommandLine) {}}
+	return &DictEntity{
+		index:      0,
+		dict:       dict.MakeShardedDict(),
+		locker:     lock.MakeLockManager(),
+		addAofFunc: func(commandLine database.CommandLine) {},
+	}
 }
 
 func (dict *DictEntity) Exec(c resp.Connection, commandLine database.CommandLine) resp.Reply {
 	commandName := strings.ToLower(string(commandLine[0]))
-	command, ok := commandTable[commandName]
+	command, ok := getCommand(commandName)
 	if !ok {
 		return reply.MakeStandardErrorReply("ERR unknown commands '" + commandName + "'")
 	}
@@ -35,7 +44,44 @@ func (dict *DictEntity) Exec(c resp.Connection, commandLine database.CommandLine
 	if connFn != nil {
 		return connFn(&c, commandLine[1:])
 	}
-	return fn(dict, commandLine[1:]) // Set key value -> key value
+	// lock the keys so the read-modify-write steps of a command can not interleave with others
+	var writeKeys, readKeys []string
+	if command.prepare != nil {
+		writeKeys, readKeys = command.prepare(commandLine[1:])
+	}
+	result := func() resp.Reply {
+		if command.keyspace {
+			dict.locker.LockAll()
+			defer dict.locker.UnlockAll()
+		} else {
+			dict.locker.Locks(writeKeys, readKeys)
+			defer dict.locker.Unlocks(writeKeys, readKeys)
+		}
+		result := fn(dict, commandLine[1:]) // Set key value -> key value
+		// the client is enqueued or tracked before the keys are unlocked, so no write can slip in unnoticed
+		if blocked, ok := result.(*blockedReply); ok {
+			if dict.blocking == nil {
+				return blocked.timeoutReply
+			}
+			dict.blocking.block(c, dict, blocked)
+		} else if len(writeKeys) == 0 {
+			dict.tracking.trackRead(c, readKeys)
+		}
+		return result
+	}()
+	if len(writeKeys) > 0 {
+		dict.tracking.invalidate(c, writeKeys)
+		// wake up the clients blocked on the keys just written
+		if dict.blocking != nil {
+			dict.blocking.signal(dict.index, writeKeys)
+		}
+	}
+	return result
+}
+
+// AddAof appends a command line of this database to the aof file
+func (dict *DictEntity) AddAof(commandLine database.CommandLine) {
+	dict.addAofFunc(commandLine)
 }
 
 // validateArity checks if the arity of the commands is valid.
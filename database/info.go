@@ -0,0 +1,90 @@
+package database
+
+import (
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// infoSections are the sections replied by INFO, in order
+var infoSections = []string{"server", "clients", "stats", "keyspace"}
+
+// execInfo executes the info commands.
+// INFO [section [section ...]]
+func execInfo(db *StandaloneDatabase, args [][]byte) resp.Reply {
+	// nil selects every section
+	var selected map[string]bool
+	if len(args) > 0 {
+		selected = make(map[string]bool)
+	}
+	for _, arg := range args {
+		section := strings.ToLower(string(arg))
+		if section == "all" || section == "default" || section == "everything" {
+			selected = nil
+			break
+		}
+		selected[section] = true
+	}
+	var builder strings.Builder
+	for _, section := range infoSections {
+		if selected != nil && !selected[section] {
+			continue
+		}
+		if builder.Len() > 0 {
+			builder.WriteString("\r\n")
+		}
+		builder.WriteString("# " + strings.ToUpper(section[:1]) + section[1:] + "\r\n")
+		for _, field := range db.infoSection(section) {
+			builder.WriteString(field[0] + ":" + field[1] + "\r\n")
+		}
+	}
+	return reply.MakeVerbatimReply("txt", []byte(builder.String()))
+}
+
+// infoSection returns the fields of a section of INFO
+func (db *StandaloneDatabase) infoSection(section string) [][2]string {
+	switch section {
+	case "server":
+		mode := "standalone"
+		if db.properties.Self != "" && len(db.properties.Peers) > 0 {
+			mode = "cluster"
+		}
+		return [][2]string{
+			{"redis_version", serverVersion},
+			{"redis_mode", mode},
+			{"process_id", strconv.Itoa(os.Getpid())},
+			{"tcp_port", strconv.Itoa(db.properties.Port)},
+			{"uptime_in_seconds", strconv.FormatInt(int64(time.Since(db.stats.StartTime)/time.Second), 10)},
+		}
+	case "clients":
+		connected := 0
+		db.clients.Range(func(_, _ interface{}) bool {
+			connected++
+			return true
+		})
+		return [][2]string{
+			{"connected_clients", strconv.Itoa(connected)},
+			{"blocked_clients", strconv.Itoa(db.blocking.blockedCount())},
+			{"tracking_clients", strconv.Itoa(db.tracking.clientCount())},
+		}
+	case "stats":
+		return [][2]string{
+			{"total_connections_received", strconv.FormatInt(db.stats.ConnectionsReceived(), 10)},
+			{"total_commands_processed", strconv.FormatInt(db.stats.CommandsProcessed(), 10)},
+			{"rejected_connections", strconv.FormatInt(db.stats.RejectedConnections(), 10)},
+			{"client_output_buffer_limit_disconnections", strconv.FormatInt(db.stats.OutputBufferLimitDisconnections(), 10)},
+		}
+	case "keyspace":
+		var fields [][2]string
+		for i, dict := range db.dictEntity {
+			if keys := dict.dict.Length(); keys > 0 {
+				fields = append(fields, [2]string{"db" + strconv.Itoa(i), "keys=" + strconv.Itoa(keys) + ",expires=0"})
+			}
+		}
+		return fields
+	}
+	return nil
+}
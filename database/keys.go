@@ -1,6 +1,10 @@
 package database
 
 import (
+	"go-redis/aof"
+	"go-redis/data_struct/list"
+	"go-redis/data_struct/sortedset"
+	"go-redis/data_struct/stream"
 	databaseInterface "go-redis/interface/database"
 	"go-redis/interface/resp"
 	"go-redis/lib/utils"
@@ -9,13 +13,13 @@ import (
 )
 
 func init() {
-	RegisterCommand("DEL", execDel, -2)
-	RegisterCommand("EXISTS", execExists, -2)
-	RegisterCommand("FLUSHDB", execFlushDB, -1)
-	RegisterCommand("TYPE", execType, 2)
-	RegisterCommand("RENAME", execRename, 3)
-	RegisterCommand("RENAMENX", execRenameNx, 3)
-	RegisterCommand("KEYS", execKeys, 2)
+	RegisterCommand("DEL", execDel, writeAllKeys, -2)
+	RegisterCommand("EXISTS", execExists, readAllKeys, -2)
+	RegisterKeyspaceCommand("FLUSHDB", execFlushDB, -1)
+	RegisterCommand("TYPE", execType, readFirstKey, 2)
+	RegisterCommand("RENAME", execRename, prepareRename, 3)
+	RegisterCommand("RENAMENX", execRenameNx, prepareRename, 3)
+	RegisterKeyspaceCommand("KEYS", execKeys, 2)
 }
 
 // execDel executes the del commands.
@@ -49,6 +53,7 @@ func execExists(dictEntity *DictEntity, args databaseInterface.CommandLine) resp
 // FLUSHDB
 func execFlushDB(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
 	dictEntity.Flush()
+	dictEntity.tracking.invalidateAll()
 	dictEntity.addAofFunc(utils.ToCommandLine3("FLUSHDB", args...))
 	return reply.MakeOkReply()
 }
@@ -62,13 +67,26 @@ func execType(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.R
 	}
 
 	switch entity.Data.(type) {
-	case [][]byte:
-		reply.MakeStatusReply("string")
-		// TODO add more types
+	case []byte:
+		return reply.MakeStatusReply("string")
+	case *list.Deque:
+		return reply.MakeStatusReply("list")
+	case *sortedset.SortedSet:
+		return reply.MakeStatusReply("zset")
+	case *stream.Stream:
+		return reply.MakeStatusReply("stream")
+	}
+	if dataType, ok := aof.LookupDataType(entity.Data); ok {
+		return reply.MakeStatusReply(dataType.Name)
 	}
 	return reply.MakeUnknownErrorReply()
 }
 
+// prepareRename locks both the source and the destination key for writing
+func prepareRename(args databaseInterface.CommandLine) ([]string, []string) {
+	return []string{string(args[0]), string(args[1])}, nil
+}
+
 // execRename executes the rename commands.
 // RENAME key new_key
 func execRename(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
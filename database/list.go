@@ -0,0 +1,445 @@
+package database
+
+import (
+	"go-redis/data_struct/list"
+	databaseInterface "go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// init registers all list commands.
+func init() {
+	RegisterCommand("LPUSH", execLPush, writeFirstKey, -3)
+	RegisterCommand("RPUSH", execRPush, writeFirstKey, -3)
+	RegisterCommand("LPOP", execLPop, writeFirstKey, -2)
+	RegisterCommand("RPOP", execRPop, writeFirstKey, -2)
+	RegisterCommand("LLEN", execLLen, readFirstKey, 2)
+	RegisterCommand("LRANGE", execLRange, readFirstKey, 4)
+	RegisterCommand("LMOVE", execLMove, prepareRename, 5)
+	RegisterCommand("LMPOP", execLMPop, prepareMPop, -4)
+	RegisterCommand("BLPOP", execBLPop, prepareBlockingPop, -3)
+	RegisterCommand("BRPOP", execBRPop, prepareBlockingPop, -3)
+	RegisterCommand("BLMOVE", execBLMove, prepareRename, 6)
+	RegisterCommand("BLMPOP", execBLMPop, prepareBlockingMPop, -5)
+}
+
+// prepareMPop locks the keys of numkeys key [key ...] for writing
+func prepareMPop(args databaseInterface.CommandLine) ([]string, []string) {
+	return writeNumKeys(args), nil
+}
+
+// prepareBlockingPop locks every key but the trailing timeout for writing
+func prepareBlockingPop(args databaseInterface.CommandLine) ([]string, []string) {
+	return writeAllKeys(args[:len(args)-1])
+}
+
+// prepareBlockingMPop locks the keys of timeout numkeys key [key ...] for writing
+func prepareBlockingMPop(args databaseInterface.CommandLine) ([]string, []string) {
+	return writeNumKeys(args[1:]), nil
+}
+
+// writeNumKeys returns the keys of numkeys key [key ...], or nil if numkeys is invalid
+func writeNumKeys(args databaseInterface.CommandLine) []string {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 || numKeys >= len(args) {
+		return nil
+	}
+	keys, _ := writeAllKeys(args[1 : 1+numKeys])
+	return keys
+}
+
+// getAsList returns the list of the key, or nil if the key does not exist
+func (dict *DictEntity) getAsList(key string) (*list.Deque, resp.ErrorReply) {
+	entity, exists := dict.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	deque, ok := entity.Data.(*list.Deque)
+	if !ok {
+		return nil, reply.MakeWrongTypeErrorReply()
+	}
+	return deque, nil
+}
+
+// getOrInitList returns the list of the key, it is created if the key does not exist
+func (dict *DictEntity) getOrInitList(key string) (*list.Deque, resp.ErrorReply) {
+	deque, errReply := dict.getAsList(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if deque == nil {
+		deque = list.MakeDeque()
+		dict.SetEntity(key, &databaseInterface.DataEntity{Data: deque})
+	}
+	return deque, nil
+}
+
+// popList pops up to count values from one end of the list, the key is deleted once the list is empty
+func (dict *DictEntity) popList(key string, deque *list.Deque, left bool, count int) [][]byte {
+	if count > deque.Len() {
+		count = deque.Len()
+	}
+	values := make([][]byte, count)
+	for i := range values {
+		if left {
+			values[i] = deque.PopFront()
+		} else {
+			values[i] = deque.PopBack()
+		}
+	}
+	if deque.Len() == 0 {
+		dict.DeleteEntity(key)
+	}
+	command := "RPOP"
+	if left {
+		command = "LPOP"
+	}
+	dict.addAofFunc(utils.ToCommandLine(command, key, strconv.Itoa(count)))
+	return values
+}
+
+// parseDirection parses LEFT or RIGHT, returns true for LEFT
+func parseDirection(arg []byte) (bool, bool) {
+	switch strings.ToLower(string(arg)) {
+	case "left":
+		return true, true
+	case "right":
+		return false, true
+	}
+	return false, false
+}
+
+// execLPush executes the lpush commands.
+// LPUSH key element [element ...]
+func execLPush(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	return push(dictEntity, "LPUSH", args)
+}
+
+// execRPush executes the rpush commands.
+// RPUSH key element [element ...]
+func execRPush(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	return push(dictEntity, "RPUSH", args)
+}
+
+// push inserts the elements at the head or the tail of the list
+func push(dictEntity *DictEntity, command string, args databaseInterface.CommandLine) resp.Reply {
+	deque, errReply := dictEntity.getOrInitList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	for _, value := range args[1:] {
+		if command == "LPUSH" {
+			deque.PushFront(value)
+		} else {
+			deque.PushBack(value)
+		}
+	}
+	dictEntity.addAofFunc(utils.ToCommandLine3(command, args...))
+	return reply.MakeIntReply(int64(deque.Len()))
+}
+
+// execLPop executes the lpop commands.
+// LPOP key [count]
+func execLPop(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	return pop(dictEntity, true, args)
+}
+
+// execRPop executes the rpop commands.
+// RPOP key [count]
+func execRPop(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	return pop(dictEntity, false, args)
+}
+
+// pop removes the elements at the head or the tail of the list
+func pop(dictEntity *DictEntity, left bool, args databaseInterface.CommandLine) resp.Reply {
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrorReply()
+	}
+	count := 1
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.Atoi(string(args[1]))
+		if err != nil || count < 0 {
+			return reply.MakeStandardErrorReply("ERR value is out of range, must be positive")
+		}
+	}
+	key := string(args[0])
+	deque, errReply := dictEntity.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if deque == nil {
+		if len(args) == 2 {
+			return reply.MakeNullMultiBulkReply()
+		}
+		return reply.MakeNullBulkReply()
+	}
+	values := dictEntity.popList(key, deque, left, count)
+	if len(args) == 2 {
+		return reply.MakeMultiBulkReply(values)
+	}
+	return reply.MakeBulkReply(values[0])
+}
+
+// execLLen executes the llen commands.
+// LLEN key
+func execLLen(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	deque, errReply := dictEntity.getAsList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if deque == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(deque.Len()))
+}
+
+// execLRange executes the lrange commands.
+// LRANGE key start stop
+func execLRange(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	start, err1 := strconv.Atoi(string(args[1]))
+	stop, err2 := strconv.Atoi(string(args[2]))
+	if err1 != nil || err2 != nil {
+		return reply.MakeStandardErrorReply("ERR value is not an integer or out of range")
+	}
+	deque, errReply := dictEntity.getAsList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if deque == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	start, stop, ok := normalizeRange(start, stop, deque.Len())
+	if !ok {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	return reply.MakeMultiBulkReply(deque.Range(start, stop))
+}
+
+// normalizeRange converts the inclusive, possibly negative, indexes start and stop to [start, stop)
+func normalizeRange(start int, stop int, size int) (int, int, bool) {
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop {
+		return 0, 0, false
+	}
+	return start, stop + 1, true
+}
+
+// execLMove executes the lmove commands.
+// LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func execLMove(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	fromLeft, ok1 := parseDirection(args[2])
+	toLeft, ok2 := parseDirection(args[3])
+	if !ok1 || !ok2 {
+		return reply.MakeSyntaxErrorReply()
+	}
+	result, served := move(dictEntity, string(args[0]), string(args[1]), fromLeft, toLeft)
+	if !served {
+		return reply.MakeNullBulkReply()
+	}
+	return result
+}
+
+// move pops an element of the source list and pushes it to the destination list,
+// it returns false if the source list does not exist
+func move(dictEntity *DictEntity, source string, destination string, fromLeft bool, toLeft bool) (resp.Reply, bool) {
+	sourceList, errReply := dictEntity.getAsList(source)
+	if errReply != nil {
+		return errReply, true
+	}
+	if sourceList == nil {
+		return nil, false
+	}
+	if _, errReply = dictEntity.getAsList(destination); errReply != nil {
+		return errReply, true
+	}
+	var value []byte
+	if fromLeft {
+		value = sourceList.PopFront()
+	} else {
+		value = sourceList.PopBack()
+	}
+	if sourceList.Len() == 0 {
+		dictEntity.DeleteEntity(source)
+	}
+	destinationList, _ := dictEntity.getOrInitList(destination)
+	if toLeft {
+		destinationList.PushFront(value)
+	} else {
+		destinationList.PushBack(value)
+	}
+	dictEntity.addAofFunc(utils.ToCommandLine("LMOVE", source, destination,
+		directionName(fromLeft), directionName(toLeft)))
+	return reply.MakeBulkReply(value), true
+}
+
+// directionName returns LEFT or RIGHT
+func directionName(left bool) string {
+	if left {
+		return "LEFT"
+	}
+	return "RIGHT"
+}
+
+// parseMPopArgs parses numkeys key [key ...] <where> [COUNT count], where is one of the two given words
+func parseMPopArgs(args databaseInterface.CommandLine, first string, second string) ([]string, bool, int, resp.ErrorReply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 {
+		return nil, false, 0, reply.MakeStandardErrorReply("ERR numkeys should be greater than 0")
+	}
+	if len(args) < numKeys+2 {
+		return nil, false, 0, reply.MakeSyntaxErrorReply()
+	}
+	keys := make([]string, numKeys)
+	for i := range keys {
+		keys[i] = string(args[1+i])
+	}
+	var isFirst bool
+	switch where := string(args[numKeys+1]); {
+	case strings.EqualFold(where, first):
+		isFirst = true
+	case strings.EqualFold(where, second):
+	default:
+		return nil, false, 0, reply.MakeSyntaxErrorReply()
+	}
+	count := 1
+	rest := args[numKeys+2:]
+	if len(rest) > 0 {
+		if len(rest) != 2 || !strings.EqualFold(string(rest[0]), "count") {
+			return nil, false, 0, reply.MakeSyntaxErrorReply()
+		}
+		count, err = strconv.Atoi(string(rest[1]))
+		if err != nil || count <= 0 {
+			return nil, false, 0, reply.MakeStandardErrorReply("ERR count should be greater than 0")
+		}
+	}
+	return keys, isFirst, count, nil
+}
+
+// execLMPop executes the lmpop commands.
+// LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func execLMPop(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	keys, left, count, errReply := parseMPopArgs(args, "left", "right")
+	if errReply != nil {
+		return errReply
+	}
+	result, served := mpopList(dictEntity, keys, left, count)
+	if !served {
+		return reply.MakeNullMultiBulkReply()
+	}
+	return result
+}
+
+// mpopList pops from the first non-empty list of keys, it returns false if no list exists
+func mpopList(dictEntity *DictEntity, keys []string, left bool, count int) (resp.Reply, bool) {
+	for _, key := range keys {
+		deque, errReply := dictEntity.getAsList(key)
+		if errReply != nil {
+			return errReply, true
+		}
+		if deque == nil {
+			continue
+		}
+		values := dictEntity.popList(key, deque, left, count)
+		return reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte(key)),
+			reply.MakeMultiBulkReply(values),
+		}), true
+	}
+	return nil, false
+}
+
+// execBLPop executes the blpop commands.
+// BLPOP key [key ...] timeout
+func execBLPop(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	return blockingPop(dictEntity, true, args)
+}
+
+// execBRPop executes the brpop commands.
+// BRPOP key [key ...] timeout
+func execBRPop(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	return blockingPop(dictEntity, false, args)
+}
+
+// blockingPop pops an element from the first non-empty list, or blocks until one is pushed
+func blockingPop(dictEntity *DictEntity, left bool, args databaseInterface.CommandLine) resp.Reply {
+	timeout, errReply := parseTimeout(args[len(args)-1])
+	if errReply != nil {
+		return errReply
+	}
+	keys, _ := writeAllKeys(args[:len(args)-1])
+	try := func(dict *DictEntity) (resp.Reply, bool) {
+		for _, key := range keys {
+			deque, errReply := dict.getAsList(key)
+			if errReply != nil {
+				return errReply, true
+			}
+			if deque == nil {
+				continue
+			}
+			values := dict.popList(key, deque, left, 1)
+			return reply.MakeMultiBulkReply([][]byte{[]byte(key), values[0]}), true
+		}
+		return nil, false
+	}
+	if result, served := try(dictEntity); served {
+		return result
+	}
+	return makeBlockedReply(keys, keys, nil, timeout, try)
+}
+
+// execBLMove executes the blmove commands.
+// BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+func execBLMove(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	fromLeft, ok1 := parseDirection(args[2])
+	toLeft, ok2 := parseDirection(args[3])
+	if !ok1 || !ok2 {
+		return reply.MakeSyntaxErrorReply()
+	}
+	timeout, errReply := parseTimeout(args[4])
+	if errReply != nil {
+		return errReply
+	}
+	source, destination := string(args[0]), string(args[1])
+	try := func(dict *DictEntity) (resp.Reply, bool) {
+		return move(dict, source, destination, fromLeft, toLeft)
+	}
+	if result, served := try(dictEntity); served {
+		return result
+	}
+	return makeBlockedReply([]string{source}, []string{source, destination}, nil, timeout, try)
+}
+
+// execBLMPop executes the blmpop commands.
+// BLMPOP timeout numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func execBLMPop(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	timeout, errReply := parseTimeout(args[0])
+	if errReply != nil {
+		return errReply
+	}
+	keys, left, count, errReply := parseMPopArgs(args[1:], "left", "right")
+	if errReply != nil {
+		return errReply
+	}
+	try := func(dict *DictEntity) (resp.Reply, bool) {
+		return mpopList(dict, keys, left, count)
+	}
+	if result, served := try(dictEntity); served {
+		return result
+	}
+	return makeBlockedReply(keys, keys, nil, timeout, try)
+}
@@ -8,7 +8,7 @@ import (
 
 // init registers ping command.
 func init() {
-	RegisterCommand("ping", execPing, 1)
+	RegisterCommand("ping", execPing, nil, 1)
 }
 
 // Ping is used to reply ping commands.
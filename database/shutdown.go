@@ -0,0 +1,59 @@
+package database
+
+import (
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/logger"
+	"go-redis/resp/reply"
+	"strings"
+)
+
+// execShutdown flushes the aof file and asks the server to shut down, nothing is replied on success
+// SHUTDOWN [NOSAVE|SAVE] [NOW] [FORCE] [ABORT]
+// There are no snapshots and no replicas to wait for, so SAVE, NOSAVE and NOW are accepted for compatibility only,
+// the aof file is flushed either way like redis does.
+func execShutdown(db *StandaloneDatabase, args database.CommandLine) resp.Reply {
+	var save, noSave, force, abort bool
+	for _, arg := range args {
+		switch strings.ToLower(string(arg)) {
+		case "save":
+			save = true
+		case "nosave":
+			noSave = true
+		case "now":
+		case "force":
+			force = true
+		case "abort":
+			abort = true
+		default:
+			return reply.MakeSyntaxErrorReply()
+		}
+	}
+	if (save && noSave) || (abort && len(args) > 1) {
+		return reply.MakeSyntaxErrorReply()
+	}
+	if abort {
+		// the shutdown does not wait for anything, there is never one in progress to abort
+		return reply.MakeStandardErrorReply("ERR No shutdown in progress.")
+	}
+
+	logger.Info("User requested shutdown...")
+	if db.aofHandler != nil {
+		if err := db.aofHandler.Flush(); err != nil {
+			if !force {
+				logger.Error("Error trying to flush the aof file, can't exit: " + err.Error())
+				return reply.MakeStandardErrorReply("ERR Errors trying to SHUTDOWN. Check logs.")
+			}
+			logger.Warn("Error trying to flush the aof file, exiting anyway: " + err.Error())
+		}
+	}
+	db.shutdownOnce.Do(func() {
+		close(db.shutdown)
+	})
+	return reply.MakeNoReply()
+}
+
+// ShutdownRequested returns a channel closed once SHUTDOWN succeeded, the server is expected to close then
+func (db *StandaloneDatabase) ShutdownRequested() <-chan struct{} {
+	return db.shutdown
+}
@@ -0,0 +1,352 @@
+package database
+
+import (
+	"go-redis/data_struct/sortedset"
+	databaseInterface "go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// init registers all sorted set commands.
+func init() {
+	RegisterCommand("ZADD", execZAdd, writeFirstKey, -4)
+	RegisterCommand("ZCARD", execZCard, readFirstKey, 2)
+	RegisterCommand("ZSCORE", execZScore, readFirstKey, 3)
+	RegisterCommand("ZRANGE", execZRange, readFirstKey, -4)
+	RegisterCommand("ZREM", execZRem, writeFirstKey, -3)
+	RegisterCommand("ZPOPMIN", execZPopMin, writeFirstKey, -2)
+	RegisterCommand("ZPOPMAX", execZPopMax, writeFirstKey, -2)
+	RegisterCommand("ZMPOP", execZMPop, prepareMPop, -4)
+	RegisterCommand("BZPOPMIN", execBZPopMin, prepareBlockingPop, -3)
+	RegisterCommand("BZPOPMAX", execBZPopMax, prepareBlockingPop, -3)
+	RegisterCommand("BZMPOP", execBZMPop, prepareBlockingMPop, -5)
+}
+
+// getAsSortedSet returns the sorted set of the key, or nil if the key does not exist
+func (dict *DictEntity) getAsSortedSet(key string) (*sortedset.SortedSet, resp.ErrorReply) {
+	entity, exists := dict.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	set, ok := entity.Data.(*sortedset.SortedSet)
+	if !ok {
+		return nil, reply.MakeWrongTypeErrorReply()
+	}
+	return set, nil
+}
+
+// popSortedSet pops up to count members with the lowest or highest scores, the key is deleted once the set is empty
+func (dict *DictEntity) popSortedSet(key string, set *sortedset.SortedSet, min bool, count int) []*sortedset.Element {
+	var elements []*sortedset.Element
+	command := "ZPOPMAX"
+	if min {
+		elements = set.PopMin(count)
+		command = "ZPOPMIN"
+	} else {
+		elements = set.PopMax(count)
+	}
+	if set.Len() == 0 {
+		dict.DeleteEntity(key)
+	}
+	dict.addAofFunc(utils.ToCommandLine(command, key, strconv.Itoa(count)))
+	return elements
+}
+
+// parseScore parses a score, it accepts inf, +inf and -inf
+func parseScore(arg []byte) (float64, bool) {
+	score, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false
+	}
+	return score, true
+}
+
+// execZAdd executes the zadd commands.
+// ZADD key score member [score member ...]
+func execZAdd(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	if len(args)%2 != 1 {
+		return reply.MakeSyntaxErrorReply()
+	}
+	elements := make([]*sortedset.Element, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		score, ok := parseScore(args[i])
+		if !ok {
+			return reply.MakeStandardErrorReply("ERR value is not a valid float")
+		}
+		elements = append(elements, &sortedset.Element{Member: string(args[i+1]), Score: score})
+	}
+	key := string(args[0])
+	set, errReply := dictEntity.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		set = sortedset.MakeSortedSet()
+		dictEntity.SetEntity(key, &databaseInterface.DataEntity{Data: set})
+	}
+	added := 0
+	for _, element := range elements {
+		if set.Add(element.Member, element.Score) {
+			added++
+		}
+	}
+	dictEntity.addAofFunc(utils.ToCommandLine3("ZADD", args...))
+	return reply.MakeIntReply(int64(added))
+}
+
+// execZCard executes the zcard commands.
+// ZCARD key
+func execZCard(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	set, errReply := dictEntity.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(set.Len()))
+}
+
+// execZScore executes the zscore commands.
+// ZSCORE key member
+func execZScore(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	set, errReply := dictEntity.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeNullBulkReply()
+	}
+	score, ok := set.Get(string(args[1]))
+	if !ok {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeDoubleReply(score)
+}
+
+// execZRange executes the zrange commands.
+// ZRANGE key start stop [WITHSCORES]
+func execZRange(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	withScores := false
+	if len(args) == 4 && strings.EqualFold(string(args[3]), "withscores") {
+		withScores = true
+	} else if len(args) != 3 {
+		return reply.MakeSyntaxErrorReply()
+	}
+	start, err1 := strconv.Atoi(string(args[1]))
+	stop, err2 := strconv.Atoi(string(args[2]))
+	if err1 != nil || err2 != nil {
+		return reply.MakeStandardErrorReply("ERR value is not an integer or out of range")
+	}
+	set, errReply := dictEntity.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	start, stop, ok := normalizeRange(start, stop, set.Len())
+	if !ok {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	return elementsToReply(set.Range(start, stop), withScores)
+}
+
+// elementsToReply returns the members, followed by their scores if withScores is set.
+// Under RESP3 every member is paired with its score.
+func elementsToReply(elements []*sortedset.Element, withScores bool) resp.Reply {
+	result := make([][]byte, 0, len(elements)*2)
+	for _, element := range elements {
+		result = append(result, []byte(element.Member))
+		if withScores {
+			result = append(result, []byte(reply.FormatDouble(element.Score)))
+		}
+	}
+	if !withScores {
+		return reply.MakeMultiBulkReply(result)
+	}
+	pairs := make([]resp.Reply, len(elements))
+	for i, element := range elements {
+		pairs[i] = elementToReply(element)
+	}
+	return reply.MakeVersionedReply(reply.MakeMultiBulkReply(result), reply.MakeMultiRawReply(pairs))
+}
+
+// elementToReply returns the member and its score
+func elementToReply(element *sortedset.Element) resp.Reply {
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(element.Member)),
+		reply.MakeDoubleReply(element.Score),
+	})
+}
+
+// execZRem executes the zrem commands.
+// ZREM key member [member ...]
+func execZRem(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	key := string(args[0])
+	set, errReply := dictEntity.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeIntReply(0)
+	}
+	removed := 0
+	for _, member := range args[1:] {
+		if set.Remove(string(member)) {
+			removed++
+		}
+	}
+	if set.Len() == 0 {
+		dictEntity.DeleteEntity(key)
+	}
+	if removed > 0 {
+		dictEntity.addAofFunc(utils.ToCommandLine3("ZREM", args...))
+	}
+	return reply.MakeIntReply(int64(removed))
+}
+
+// execZPopMin executes the zpopmin commands.
+// ZPOPMIN key [count]
+func execZPopMin(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	return zpop(dictEntity, true, args)
+}
+
+// execZPopMax executes the zpopmax commands.
+// ZPOPMAX key [count]
+func execZPopMax(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	return zpop(dictEntity, false, args)
+}
+
+// zpop removes the members with the lowest or highest scores
+func zpop(dictEntity *DictEntity, min bool, args databaseInterface.CommandLine) resp.Reply {
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrorReply()
+	}
+	count := 1
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.Atoi(string(args[1]))
+		if err != nil || count < 0 {
+			return reply.MakeStandardErrorReply("ERR value is out of range, must be positive")
+		}
+	}
+	key := string(args[0])
+	set, errReply := dictEntity.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	elements := dictEntity.popSortedSet(key, set, min, count)
+	if len(args) == 1 && len(elements) == 1 {
+		// without count, a single member and its score are replied
+		return elementToReply(elements[0])
+	}
+	return elementsToReply(elements, true)
+}
+
+// execZMPop executes the zmpop commands.
+// ZMPOP numkeys key [key ...] MIN|MAX [COUNT count]
+func execZMPop(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	keys, min, count, errReply := parseMPopArgs(args, "min", "max")
+	if errReply != nil {
+		return errReply
+	}
+	result, served := mpopSortedSet(dictEntity, keys, min, count)
+	if !served {
+		return reply.MakeNullMultiBulkReply()
+	}
+	return result
+}
+
+// mpopSortedSet pops from the first non-empty sorted set of keys, it returns false if no sorted set exists
+func mpopSortedSet(dictEntity *DictEntity, keys []string, min bool, count int) (resp.Reply, bool) {
+	for _, key := range keys {
+		set, errReply := dictEntity.getAsSortedSet(key)
+		if errReply != nil {
+			return errReply, true
+		}
+		if set == nil {
+			continue
+		}
+		elements := dictEntity.popSortedSet(key, set, min, count)
+		pairs := make([]resp.Reply, len(elements))
+		for i, element := range elements {
+			pairs[i] = elementToReply(element)
+		}
+		return reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte(key)),
+			reply.MakeMultiRawReply(pairs),
+		}), true
+	}
+	return nil, false
+}
+
+// execBZPopMin executes the bzpopmin commands.
+// BZPOPMIN key [key ...] timeout
+func execBZPopMin(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	return blockingZPop(dictEntity, true, args)
+}
+
+// execBZPopMax executes the bzpopmax commands.
+// BZPOPMAX key [key ...] timeout
+func execBZPopMax(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	return blockingZPop(dictEntity, false, args)
+}
+
+// blockingZPop pops a member from the first non-empty sorted set, or blocks until one is added
+func blockingZPop(dictEntity *DictEntity, min bool, args databaseInterface.CommandLine) resp.Reply {
+	timeout, errReply := parseTimeout(args[len(args)-1])
+	if errReply != nil {
+		return errReply
+	}
+	keys, _ := writeAllKeys(args[:len(args)-1])
+	try := func(dict *DictEntity) (resp.Reply, bool) {
+		for _, key := range keys {
+			set, errReply := dict.getAsSortedSet(key)
+			if errReply != nil {
+				return errReply, true
+			}
+			if set == nil {
+				continue
+			}
+			element := dict.popSortedSet(key, set, min, 1)[0]
+			return reply.MakeMultiRawReply([]resp.Reply{
+				reply.MakeBulkReply([]byte(key)),
+				reply.MakeBulkReply([]byte(element.Member)),
+				reply.MakeDoubleReply(element.Score),
+			}), true
+		}
+		return nil, false
+	}
+	if result, served := try(dictEntity); served {
+		return result
+	}
+	return makeBlockedReply(keys, keys, nil, timeout, try)
+}
+
+// execBZMPop executes the bzmpop commands.
+// BZMPOP timeout numkeys key [key ...] MIN|MAX [COUNT count]
+func execBZMPop(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	timeout, errReply := parseTimeout(args[0])
+	if errReply != nil {
+		return errReply
+	}
+	keys, min, count, errReply := parseMPopArgs(args[1:], "min", "max")
+	if errReply != nil {
+		return errReply
+	}
+	try := func(dict *DictEntity) (resp.Reply, bool) {
+		return mpopSortedSet(dict, keys, min, count)
+	}
+	if result, served := try(dictEntity); served {
+		return result
+	}
+	return makeBlockedReply(keys, keys, nil, timeout, try)
+}
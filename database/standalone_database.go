@@ -6,32 +6,53 @@ import (
 	databaseInterface "go-redis/interface/database"
 	"go-redis/interface/resp"
 	"go-redis/lib/logger"
+	"go-redis/lib/stats"
+	"go-redis/pubsub"
 	"go-redis/resp/reply"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type StandaloneDatabase struct {
 	dictEntity []*DictEntity
 	aofHandler *aof.AofHandler
+	properties *config.ServerProperties
+	hub        *pubsub.Hub      // pub/sub channels of this server
+	blocking   *blockingManager // clients waiting in blocking commands
+	tracking   *trackingTable   // keys cached by the clients with CLIENT TRACKING on
+	clients    sync.Map         // client id -> resp.Connection
+	stats      *stats.Stats     // counters reported by INFO
+
+	shutdown     chan struct{} // closed by SHUTDOWN
+	shutdownOnce sync.Once
 }
 
 // NewStandaloneDatabase returns a new instance of StandaloneDatabase
-func NewStandaloneDatabase() *StandaloneDatabase {
-	databaseEngine := &StandaloneDatabase{}
-	if config.Properties.Databases <= 0 {
-		config.Properties.Databases = 16
+func NewStandaloneDatabase(properties *config.ServerProperties) *StandaloneDatabase {
+	databaseEngine := &StandaloneDatabase{
+		properties: properties,
+		hub:        pubsub.MakeHub(),
+		stats:      stats.MakeStats(),
+		blocking:   makeBlockingManager(),
+		shutdown:   make(chan struct{}),
+	}
+	databaseEngine.tracking = makeTrackingTable(databaseEngine.lookupClient)
+	if properties.Databases <= 0 {
+		properties.Databases = 16
 	}
-	dictEntity := make([]*DictEntity, config.Properties.Databases)
+	dictEntity := make([]*DictEntity, properties.Databases)
 	for i := range dictEntity {
 		database := MakeDatabase()
 		database.index = i
+		database.blocking = databaseEngine.blocking
+		database.tracking = databaseEngine.tracking
 		dictEntity[i] = database
 	}
 	databaseEngine.dictEntity = dictEntity
-	if config.Properties.AppendOnly {
-		aofHandler, err := aof.NewAofHandler(databaseEngine)
+	if properties.AppendOnly {
+		aofHandler, err := aof.NewAofHandler(databaseEngine, properties)
 		if err != nil {
 			panic(err)
 		}
@@ -46,6 +67,13 @@ func NewStandaloneDatabase() *StandaloneDatabase {
 	return databaseEngine
 }
 
+// serverCommands are executed by Exec itself, or by the handler like QUIT, they are not in the command table
+var serverCommands = map[string]struct{}{
+	"auth": {}, "hello": {}, "quit": {}, "select": {}, "client": {}, "info": {}, "reset": {}, "shutdown": {},
+	"subscribe": {}, "unsubscribe": {}, "psubscribe": {}, "punsubscribe": {}, "ssubscribe": {}, "sunsubscribe": {},
+	"publish": {}, "spublish": {}, "pubsub": {},
+}
+
 func (database *StandaloneDatabase) Exec(client resp.Connection, args databaseInterface.CommandLine) resp.Reply {
 	defer func() {
 		if err := recover(); err != nil {
@@ -53,16 +81,71 @@ func (database *StandaloneDatabase) Exec(client resp.Connection, args databaseIn
 		}
 	}()
 	commandName := strings.ToLower(string(args[0]))
+	defer database.tracking.afterCommand(client, commandName)
+	if commandName == "auth" {
+		return execAuth(database, client, args[1:])
+	}
+	if commandName == "hello" {
+		return execHello(database, client, args[1:])
+	}
 	// authenticate
-	if !isAuthenticated(client) {
+	if !database.IsAuthenticated(client) {
 		return reply.MakeStandardErrorReply("NOAUTH Authentication required")
 	}
 
-	if commandName == "select" {
+	// a subscribed client can only manage its subscriptions
+	if pubsub.InSubscribeMode(client) && !pubsub.IsAllowedInSubscribeMode(commandName) {
+		return pubsub.MakeSubscribeModeErrorReply(commandName)
+	}
+
+	switch commandName {
+	case "select":
 		if len(args) != 2 {
 			return reply.MakeArgsNumErrorReply(commandName)
 		}
 		return execSelect(client, database, args[1:])
+	case "subscribe":
+		if len(args) < 2 {
+			return reply.MakeArgsNumErrorReply(commandName)
+		}
+		return database.hub.Subscribe(client, args[1:])
+	case "unsubscribe":
+		return database.hub.UnSubscribe(client, args[1:])
+	case "psubscribe":
+		if len(args) < 2 {
+			return reply.MakeArgsNumErrorReply(commandName)
+		}
+		return database.hub.PSubscribe(client, args[1:])
+	case "punsubscribe":
+		return database.hub.PUnSubscribe(client, args[1:])
+	case "publish":
+		return database.hub.Publish(args[1:])
+	case "ssubscribe":
+		if len(args) < 2 {
+			return reply.MakeArgsNumErrorReply(commandName)
+		}
+		return database.hub.SSubscribe(client, args[1:])
+	case "sunsubscribe":
+		return database.hub.SUnSubscribe(client, args[1:])
+	case "spublish":
+		return database.hub.SPublish(args[1:])
+	case "pubsub":
+		return database.hub.PubSub(args[1:])
+	case "client":
+		return execClient(database, client, args[1:])
+	case "info":
+		return execInfo(database, args[1:])
+	case "reset":
+		return execReset(client, database)
+	case "shutdown":
+		return execShutdown(database, args[1:])
+	case "ping":
+		if pubsub.InSubscribeMode(client) {
+			if len(args) > 2 {
+				return reply.MakeArgsNumErrorReply(commandName)
+			}
+			return pubsub.Ping(args[1:])
+		}
 	}
 
 	dbIndex := client.GetDBIndex()
@@ -91,13 +174,54 @@ func execSelect(connection resp.Connection, database *StandaloneDatabase, args d
 	return reply.MakeOkReply()
 }
 
+// execReset resets the connection to the state it had after connecting
+// RESET
+func execReset(connection resp.Connection, database *StandaloneDatabase) resp.Reply {
+	database.hub.UnsubscribeAll(connection)
+	connection.SelectDB(0)
+	connection.SetPassword("")
+	connection.SetProtocol(reply.Resp2)
+	database.tracking.disable(connection)
+	return reply.MakeStatusReply("RESET")
+}
+
+// Stats returns the counters of the server
+func (database *StandaloneDatabase) Stats() *stats.Stats {
+	return database.stats
+}
+
+// Hub returns the pub/sub hub of the database
+func (database *StandaloneDatabase) Hub() *pubsub.Hub {
+	return database.hub
+}
+
 // Close closes the aof handler gracefully
 func (database *StandaloneDatabase) Close() {
 	// graceful shutdown
+	database.blocking.close()
 	if database.aofHandler != nil {
 		database.aofHandler.Close()
 	}
 }
 
-func (database *StandaloneDatabase) AfterClientClose(_ resp.Connection) {
+// AfterClientConnect registers the client, so CLIENT LIST can report it
+func (database *StandaloneDatabase) AfterClientConnect(client resp.Connection) {
+	database.clients.Store(client.GetID(), client)
+}
+
+// lookupClient returns the connected client with the given id
+func (database *StandaloneDatabase) lookupClient(id int64) (resp.Connection, bool) {
+	value, ok := database.clients.Load(id)
+	if !ok {
+		return nil, false
+	}
+	return value.(resp.Connection), true
+}
+
+// AfterClientClose releases what the client holds on the server
+func (database *StandaloneDatabase) AfterClientClose(client resp.Connection) {
+	database.clients.Delete(client.GetID())
+	database.tracking.disable(client)
+	database.blocking.unblockClient(client)
+	database.hub.UnsubscribeAll(client)
 }
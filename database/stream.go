@@ -0,0 +1,510 @@
+package database
+
+import (
+	"go-redis/data_struct/stream"
+	databaseInterface "go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// init registers all stream commands.
+func init() {
+	RegisterCommand("XADD", execXAdd, writeFirstKey, -5)
+	RegisterCommand("XLEN", execXLen, readFirstKey, 2)
+	RegisterCommand("XRANGE", execXRange, readFirstKey, -4)
+	RegisterCommand("XREAD", execXRead, prepareXRead, -4)
+	RegisterCommand("XREADGROUP", execXReadGroup, prepareXReadGroup, -7)
+	RegisterCommand("XGROUP", execXGroup, prepareXGroup, -2)
+	RegisterCommand("XACK", execXAck, writeFirstKey, -4)
+}
+
+// getAsStream returns the stream of the key, or nil if the key does not exist
+func (dict *DictEntity) getAsStream(key string) (*stream.Stream, resp.ErrorReply) {
+	entity, exists := dict.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	s, ok := entity.Data.(*stream.Stream)
+	if !ok {
+		return nil, reply.MakeWrongTypeErrorReply()
+	}
+	return s, nil
+}
+
+// entryToReply returns [id, [field value ...]], the fields of a trimmed pending entry are null
+func entryToReply(entry *stream.Entry) resp.Reply {
+	var fields resp.Reply = reply.MakeNullMultiBulkReply()
+	if entry.Fields != nil {
+		fields = reply.MakeMultiBulkReply(entry.Fields)
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{reply.MakeBulkReply([]byte(entry.ID.String())), fields})
+}
+
+// entriesToReply returns the replies of the entries
+func entriesToReply(entries []*stream.Entry) resp.Reply {
+	replies := make([]resp.Reply, len(entries))
+	for i, entry := range entries {
+		replies[i] = entryToReply(entry)
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+// execXAdd executes the xadd commands.
+// XADD key [NOMKSTREAM] [MAXLEN [=|~] threshold] id|* field value [field value ...]
+func execXAdd(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	key := string(args[0])
+	noMkStream := false
+	maxLen := -1
+	i := 1
+	for ; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		if option == "nomkstream" {
+			noMkStream = true
+		} else if option == "maxlen" {
+			i++
+			if i < len(args) && (string(args[i]) == "=" || string(args[i]) == "~") {
+				i++
+			}
+			if i >= len(args) {
+				return reply.MakeSyntaxErrorReply()
+			}
+			var err error
+			maxLen, err = strconv.Atoi(string(args[i]))
+			if err != nil || maxLen < 0 {
+				return reply.MakeStandardErrorReply("ERR The MAXLEN argument must be >= 0.")
+			}
+		} else {
+			break
+		}
+	}
+	fields := args[i+1:]
+	if i >= len(args) || len(fields) == 0 || len(fields)%2 != 0 {
+		return reply.MakeArgsNumErrorReply("xadd")
+	}
+	s, errReply := dictEntity.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		if noMkStream {
+			return reply.MakeNullBulkReply()
+		}
+		s = stream.MakeStream()
+	}
+	id, errReply := nextStreamID(s, string(args[i]))
+	if errReply != nil {
+		return errReply
+	}
+	s.Add(id, fields)
+	if maxLen >= 0 {
+		s.Trim(maxLen)
+	}
+	dictEntity.SetEntityIfAbsent(key, &databaseInterface.DataEntity{Data: s})
+
+	// the generated id is written to the aof file, so the entries are replayed with the same ids
+	commandLine := utils.ToCommandLine("XADD", key)
+	if maxLen >= 0 {
+		commandLine = append(commandLine, []byte("MAXLEN"), []byte(strconv.Itoa(maxLen)))
+	}
+	commandLine = append(commandLine, []byte(id.String()))
+	dictEntity.addAofFunc(append(commandLine, fields...))
+	return reply.MakeBulkReply([]byte(id.String()))
+}
+
+// nextStreamID returns the id of a new entry, given as *, <ms>-*, <ms> or <ms>-<seq>
+func nextStreamID(s *stream.Stream, arg string) (stream.ID, resp.ErrorReply) {
+	var id stream.ID
+	if arg == "*" {
+		id = s.NextID(uint64(time.Now().UnixMilli()))
+	} else if ms, ok := strings.CutSuffix(arg, "-*"); ok {
+		parsed, err := stream.ParseID(ms, 0)
+		if err != nil {
+			return id, reply.MakeStandardErrorReply(err.Error())
+		}
+		id = parsed
+		if id.Ms == s.LastID().Ms {
+			id = s.LastID().Next()
+		}
+	} else {
+		parsed, err := stream.ParseID(arg, 0)
+		if err != nil {
+			return id, reply.MakeStandardErrorReply(err.Error())
+		}
+		id = parsed
+	}
+	if id == (stream.ID{}) {
+		return id, reply.MakeStandardErrorReply("ERR The ID specified in XADD must be greater than 0-0")
+	}
+	if !s.LastID().Less(id) {
+		return id, reply.MakeStandardErrorReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	}
+	return id, nil
+}
+
+// execXLen executes the xlen commands.
+// XLEN key
+func execXLen(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	s, errReply := dictEntity.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(s.Len()))
+}
+
+// execXRange executes the xrange commands.
+// XRANGE key start end [COUNT count]
+func execXRange(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	start, err := parseRangeID(string(args[1]), 0)
+	if err != nil {
+		return reply.MakeStandardErrorReply(err.Error())
+	}
+	end, err := parseRangeID(string(args[2]), stream.MaxID.Seq)
+	if err != nil {
+		return reply.MakeStandardErrorReply(err.Error())
+	}
+	count := 0
+	if len(args) > 3 {
+		if len(args) != 5 || !strings.EqualFold(string(args[3]), "count") {
+			return reply.MakeSyntaxErrorReply()
+		}
+		count, err = strconv.Atoi(string(args[4]))
+		if err != nil {
+			return reply.MakeStandardErrorReply("ERR value is not an integer or out of range")
+		}
+		if count <= 0 {
+			return reply.MakeEmptyMultiBulkReply()
+		}
+	}
+	s, errReply := dictEntity.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	return entriesToReply(s.Range(start, end, count))
+}
+
+// parseRangeID parses an id of XRANGE, - and + are the smallest and the greatest id
+func parseRangeID(arg string, missingSeq uint64) (stream.ID, error) {
+	switch arg {
+	case "-":
+		return stream.ID{}, nil
+	case "+":
+		return stream.MaxID, nil
+	}
+	return stream.ParseID(arg, missingSeq)
+}
+
+// streamReadArgs is the parsed arguments of XREAD and XREADGROUP
+type streamReadArgs struct {
+	group    string
+	consumer string
+	count    int
+	block    bool
+	timeout  time.Duration
+	noAck    bool
+	keys     []string
+	ids      []string
+}
+
+// parseStreamReadArgs parses [GROUP group consumer] [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func parseStreamReadArgs(args databaseInterface.CommandLine, withGroup bool) (*streamReadArgs, resp.ErrorReply) {
+	readArgs := &streamReadArgs{}
+	i := 0
+	if withGroup {
+		if len(args) < 3 || !strings.EqualFold(string(args[0]), "group") {
+			return nil, reply.MakeSyntaxErrorReply()
+		}
+		readArgs.group, readArgs.consumer = string(args[1]), string(args[2])
+		i = 3
+	}
+	for ; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		if option == "streams" {
+			break
+		}
+		switch {
+		case option == "count" && i+1 < len(args):
+			i++
+			count, err := strconv.Atoi(string(args[i]))
+			if err != nil {
+				return nil, reply.MakeStandardErrorReply("ERR value is not an integer or out of range")
+			}
+			readArgs.count = count
+		case option == "block" && i+1 < len(args):
+			i++
+			ms, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeStandardErrorReply("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return nil, reply.MakeStandardErrorReply("ERR timeout is negative")
+			}
+			readArgs.block = true
+			readArgs.timeout = time.Duration(ms) * time.Millisecond
+		case option == "noack" && withGroup:
+			readArgs.noAck = true
+		default:
+			return nil, reply.MakeSyntaxErrorReply()
+		}
+	}
+	rest := args[min(i+1, len(args)):]
+	if i >= len(args) || len(rest) == 0 || len(rest)%2 != 0 {
+		return nil, reply.MakeStandardErrorReply("ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.")
+	}
+	half := len(rest) / 2
+	for j := 0; j < half; j++ {
+		readArgs.keys = append(readArgs.keys, string(rest[j]))
+		readArgs.ids = append(readArgs.ids, string(rest[half+j]))
+	}
+	return readArgs, nil
+}
+
+// prepareXRead locks the streams of XREAD for reading
+func prepareXRead(args databaseInterface.CommandLine) ([]string, []string) {
+	readArgs, errReply := parseStreamReadArgs(args, false)
+	if errReply != nil {
+		return nil, nil
+	}
+	return nil, readArgs.keys
+}
+
+// prepareXReadGroup locks the streams of XREADGROUP for writing, since the consumer group changes
+func prepareXReadGroup(args databaseInterface.CommandLine) ([]string, []string) {
+	readArgs, errReply := parseStreamReadArgs(args, true)
+	if errReply != nil {
+		return nil, nil
+	}
+	return readArgs.keys, nil
+}
+
+// streamsToReply returns [[key, [entry ...]] ...]
+func streamsToReply(keys []string, entries [][]*stream.Entry) resp.Reply {
+	replies := make([]resp.Reply, len(keys))
+	streams := reply.MakeMapReply()
+	for i, key := range keys {
+		replies[i] = reply.MakeMultiRawReply([]resp.Reply{reply.MakeBulkReply([]byte(key)), entriesToReply(entries[i])})
+		streams.Add(reply.MakeBulkReply([]byte(key)), entriesToReply(entries[i]))
+	}
+	// RESP2 replies an array of [key, entries] pairs, RESP3 a map of key to entries
+	return reply.MakeVersionedReply(reply.MakeMultiRawReply(replies), streams)
+}
+
+// execXRead executes the xread commands.
+// XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func execXRead(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	readArgs, errReply := parseStreamReadArgs(args, false)
+	if errReply != nil {
+		return errReply
+	}
+	// $ is resolved now, so the client only receives the entries added after it blocked
+	ids := make([]stream.ID, len(readArgs.keys))
+	for i, key := range readArgs.keys {
+		s, errReply := dictEntity.getAsStream(key)
+		if errReply != nil {
+			return errReply
+		}
+		if readArgs.ids[i] == "$" {
+			if s != nil {
+				ids[i] = s.LastID()
+			}
+			continue
+		}
+		id, err := stream.ParseID(readArgs.ids[i], 0)
+		if err != nil {
+			return reply.MakeStandardErrorReply(err.Error())
+		}
+		ids[i] = id
+	}
+	try := func(dict *DictEntity) (resp.Reply, bool) {
+		var keys []string
+		var entries [][]*stream.Entry
+		for i, key := range readArgs.keys {
+			s, errReply := dict.getAsStream(key)
+			if errReply != nil {
+				return errReply, true
+			}
+			if s == nil {
+				continue
+			}
+			if found := s.Range(ids[i].Next(), stream.MaxID, readArgs.count); len(found) > 0 {
+				keys = append(keys, key)
+				entries = append(entries, found)
+			}
+		}
+		if len(keys) == 0 {
+			return nil, false
+		}
+		return streamsToReply(keys, entries), true
+	}
+	if result, served := try(dictEntity); served {
+		return result
+	}
+	if !readArgs.block {
+		return reply.MakeNullMultiBulkReply()
+	}
+	return makeBlockedReply(readArgs.keys, nil, readArgs.keys, readArgs.timeout, try)
+}
+
+// execXReadGroup executes the xreadgroup commands.
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+// The id > reads the entries never delivered to the group, other ids read the history of the consumer.
+// The pending entries are not written to the aof file, only the last delivered id of the group is.
+func execXReadGroup(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	readArgs, errReply := parseStreamReadArgs(args, true)
+	if errReply != nil {
+		return errReply
+	}
+	onlyNew := true
+	history := make([]stream.ID, len(readArgs.keys))
+	for i, arg := range readArgs.ids {
+		if arg == ">" {
+			continue
+		}
+		onlyNew = false
+		id, err := stream.ParseID(arg, 0)
+		if err != nil {
+			return reply.MakeStandardErrorReply(err.Error())
+		}
+		history[i] = id
+	}
+	try := func(dict *DictEntity) (resp.Reply, bool) {
+		var keys []string
+		var entries [][]*stream.Entry
+		for i, key := range readArgs.keys {
+			s, errReply := dict.getAsStream(key)
+			if errReply != nil {
+				return errReply, true
+			}
+			var group *stream.Group
+			if s != nil {
+				group, _ = s.GetGroup(readArgs.group)
+			}
+			if group == nil {
+				return reply.MakeStandardErrorReply("NOGROUP No such key '" + key + "' or consumer group '" +
+					readArgs.group + "' in XREADGROUP with GROUP option"), true
+			}
+			if readArgs.ids[i] != ">" {
+				keys = append(keys, key)
+				entries = append(entries, s.ReadPending(group, readArgs.consumer, history[i], readArgs.count))
+				continue
+			}
+			if found := s.ReadNew(group, readArgs.consumer, readArgs.count, readArgs.noAck); len(found) > 0 {
+				keys = append(keys, key)
+				entries = append(entries, found)
+				dict.addAofFunc(utils.ToCommandLine("XGROUP", "SETID", key, group.Name, group.LastDelivered.String()))
+			}
+		}
+		if len(keys) == 0 {
+			return nil, false
+		}
+		return streamsToReply(keys, entries), true
+	}
+	if result, served := try(dictEntity); served {
+		return result
+	}
+	if !readArgs.block || !onlyNew {
+		return reply.MakeNullMultiBulkReply()
+	}
+	return makeBlockedReply(readArgs.keys, readArgs.keys, nil, readArgs.timeout, try)
+}
+
+// prepareXGroup locks the stream of XGROUP for writing
+func prepareXGroup(args databaseInterface.CommandLine) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return []string{string(args[1])}, nil
+}
+
+// execXGroup executes the xgroup commands.
+// XGROUP CREATE key group id|$ [MKSTREAM] | SETID key group id|$ | DESTROY key group
+func execXGroup(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	subCommand := strings.ToLower(string(args[0]))
+	switch {
+	case subCommand == "create" && (len(args) == 4 || len(args) == 5):
+	case subCommand == "setid" && len(args) == 4:
+	case subCommand == "destroy" && len(args) == 3:
+	default:
+		return reply.MakeStandardErrorReply("ERR unknown subcommand or wrong number of arguments for '" + string(args[0]) + "'")
+	}
+	key, name := string(args[1]), string(args[2])
+	s, errReply := dictEntity.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		if subCommand != "create" || len(args) != 5 || !strings.EqualFold(string(args[4]), "mkstream") {
+			return reply.MakeStandardErrorReply("ERR The XGROUP subcommand requires the key to exist. " +
+				"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+		}
+		s = stream.MakeStream()
+		dictEntity.SetEntity(key, &databaseInterface.DataEntity{Data: s})
+	}
+	if subCommand == "destroy" {
+		if !s.DestroyGroup(name) {
+			return reply.MakeIntReply(0)
+		}
+		dictEntity.addAofFunc(utils.ToCommandLine("XGROUP", "DESTROY", key, name))
+		return reply.MakeIntReply(1)
+	}
+	id := s.LastID()
+	if arg := string(args[3]); arg != "$" {
+		parsed, err := stream.ParseID(arg, 0)
+		if err != nil {
+			return reply.MakeStandardErrorReply(err.Error())
+		}
+		id = parsed
+	}
+	if subCommand == "create" {
+		if !s.CreateGroup(name, id) {
+			return reply.MakeStandardErrorReply("BUSYGROUP Consumer Group name already exists")
+		}
+		dictEntity.addAofFunc(utils.ToCommandLine("XGROUP", "CREATE", key, name, id.String(), "MKSTREAM"))
+		return reply.MakeOkReply()
+	}
+	group, ok := s.GetGroup(name)
+	if !ok {
+		return reply.MakeStandardErrorReply("NOGROUP No such consumer group '" + name + "' for key name '" + key + "'")
+	}
+	group.LastDelivered = id
+	dictEntity.addAofFunc(utils.ToCommandLine("XGROUP", "SETID", key, name, id.String()))
+	return reply.MakeOkReply()
+}
+
+// execXAck executes the xack commands.
+// XACK key group id [id ...]
+func execXAck(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
+	ids := make([]stream.ID, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		id, err := stream.ParseID(string(arg), 0)
+		if err != nil {
+			return reply.MakeStandardErrorReply(err.Error())
+		}
+		ids = append(ids, id)
+	}
+	s, errReply := dictEntity.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeIntReply(0)
+	}
+	group, ok := s.GetGroup(string(args[1]))
+	if !ok {
+		return reply.MakeIntReply(0)
+	}
+	acked := group.Ack(ids...)
+	if acked > 0 {
+		dictEntity.addAofFunc(utils.ToCommandLine3("XACK", args...))
+	}
+	return reply.MakeIntReply(int64(acked))
+}
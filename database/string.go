@@ -9,23 +9,38 @@ import (
 
 // init registers all string commands.
 func init() {
-	RegisterCommand("GET", execGet, 2)
-	RegisterCommand("SET", execSet, 3)
-	RegisterCommand("SETNX", execSetNx, 3)
-	RegisterCommand("GETSET", execGetSet, 3)
-	RegisterCommand("GETDEL", execGetDel, 2)
-	RegisterCommand("STRLEN", execStrLen, 2)
+	RegisterCommand("GET", execGet, readFirstKey, 2)
+	RegisterCommand("SET", execSet, writeFirstKey, 3)
+	RegisterCommand("SETNX", execSetNx, writeFirstKey, 3)
+	RegisterCommand("GETSET", execGetSet, writeFirstKey, 3)
+	RegisterCommand("GETDEL", execGetDel, writeFirstKey, 2)
+	RegisterCommand("STRLEN", execStrLen, readFirstKey, 2)
+}
+
+// getAsString returns the string of the key, or nil if the key does not exist
+func (dict *DictEntity) getAsString(key string) ([]byte, resp.ErrorReply) {
+	entity, exists := dict.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	bytes, ok := entity.Data.([]byte)
+	if !ok {
+		return nil, reply.MakeWrongTypeErrorReply()
+	}
+	return bytes, nil
 }
 
 // execGet executes the get commands.
 // GET key
 func execGet(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
-	entity, exists := dictEntity.GetEntity(string(args[0]))
-	if !exists {
+	bytes, errReply := dictEntity.getAsString(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if bytes == nil {
 		return reply.MakeNullBulkReply()
 	}
-	// TODO if there are different types, entity.Data.([]byte) need to check
-	return reply.MakeBulkReply(entity.Data.([]byte))
+	return reply.MakeBulkReply(bytes)
 }
 
 // execSet executes the set commands.
@@ -46,32 +61,39 @@ func execSetNx(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.
 // execGetSet executes the getset commands.
 // GETSET key value
 func execGetSet(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
-	oldEntity, exists := dictEntity.GetEntity(string(args[0]))
+	old, errReply := dictEntity.getAsString(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
 	dictEntity.SetEntity(string(args[0]), &databaseInterface.DataEntity{Data: args[1]})
-	if !exists {
+	if old == nil {
 		return reply.MakeNullBulkReply()
 	}
 	dictEntity.addAofFunc(utils.ToCommandLine3("GETSET", args...))
-	return reply.MakeBulkReply(oldEntity.Data.([]byte))
+	return reply.MakeBulkReply(old)
 }
 
 // execGetDel executes the getdel commands.
 // GETDEL key
 func execGetDel(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
-	oldEntity, exists := dictEntity.GetAndDeleteEntity(string(args[0]))
-	if oldEntity == nil || !exists {
+	old, errReply := dictEntity.getAsString(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if old == nil {
 		return reply.MakeNullBulkReply()
 	}
+	dictEntity.DeleteEntity(string(args[0]))
 	dictEntity.addAofFunc(utils.ToCommandLine3("GETDEL", args...))
-	return reply.MakeBulkReply(oldEntity.Data.([]byte))
+	return reply.MakeBulkReply(old)
 }
 
 // execStrLen executes the strlen commands.
 // STRLEN key
 func execStrLen(dictEntity *DictEntity, args databaseInterface.CommandLine) resp.Reply {
-	entity, exists := dictEntity.GetEntity(string(args[0]))
-	if !exists {
-		return reply.MakeNullBulkReply()
+	bytes, errReply := dictEntity.getAsString(string(args[0]))
+	if errReply != nil {
+		return errReply
 	}
-	return reply.MakeIntReply(int64(len(entity.Data.([]byte))))
+	return reply.MakeIntReply(int64(len(bytes)))
 }
@@ -1,35 +1,131 @@
 package database
 
 import (
-	"go-redis/config"
 	"go-redis/interface/database"
 	"go-redis/interface/resp"
 	"go-redis/resp/reply"
+	"strconv"
+	"strings"
 )
 
-func init() {
-	RegisterSysCommand("AUTH", execAuth, -2)
-}
+// serverVersion is the redis version the server is compatible with, reported by HELLO
+const serverVersion = "7.0.0"
+
+// defaultUser is the only user known by the server, AUTH and HELLO accept it with requirepass
+const defaultUser = "default"
 
-// Auth validate client's password
-func execAuth(c *resp.Connection, args database.CommandLine) resp.Reply {
-	if len(args) != 1 {
+// execAuth validate client's password
+// AUTH [username] password
+func execAuth(db *StandaloneDatabase, c resp.Connection, args database.CommandLine) resp.Reply {
+	if len(args) != 1 && len(args) != 2 {
 		return reply.MakeStandardErrorReply("ERR wrong number of arguments for 'auth' command")
 	}
-	if config.Properties.RequirePass == "" {
+	if db.properties.RequirePass == "" {
 		return reply.MakeStandardErrorReply("ERR Client sent AUTH, but no password is set")
 	}
+	if len(args) == 2 {
+		if !db.login(c, string(args[0]), string(args[1])) {
+			return makeWrongPassReply()
+		}
+		return &reply.OkReply{}
+	}
 	password := string(args[0])
-	(*c).SetPassword(password)
-	if config.Properties.RequirePass != password {
+	// a wrong password keeps the client authenticated as before, like redis does
+	if db.properties.RequirePass != password {
 		return reply.MakeStandardErrorReply("ERR invalid password")
 	}
+	c.SetPassword(password)
 	return &reply.OkReply{}
 }
 
-func isAuthenticated(c resp.Connection) bool {
-	if config.Properties.RequirePass == "" {
+// login authenticates the client as the given user, only the default user exists.
+// The client is left as it was if the credentials are wrong.
+func (db *StandaloneDatabase) login(c resp.Connection, username string, password string) bool {
+	if username != defaultUser {
+		return false
+	}
+	if db.properties.RequirePass == "" {
+		// the default user needs no password
 		return true
 	}
-	return c.GetPassword() == config.Properties.RequirePass
+	if password != db.properties.RequirePass {
+		return false
+	}
+	c.SetPassword(password)
+	return true
+}
+
+// makeWrongPassReply returns the error replied to a wrong username or password
+func makeWrongPassReply() resp.Reply {
+	return reply.MakeStandardErrorReply("WRONGPASS invalid username-password pair or user is disabled.")
+}
+
+// IsAuthenticated returns true if the client has sent the right password or no password is required
+func (db *StandaloneDatabase) IsAuthenticated(c resp.Connection) bool {
+	if db.properties.RequirePass == "" {
+		return true
+	}
+	return c.GetPassword() == db.properties.RequirePass
+}
+
+// execHello switches the protocol of the client and replies the server properties
+// HELLO [protover [AUTH username password] [SETNAME clientname]]
+func execHello(db *StandaloneDatabase, c resp.Connection, args database.CommandLine) resp.Reply {
+	protocol := c.GetProtocol()
+	if len(args) > 0 {
+		version, err := strconv.Atoi(string(args[0]))
+		if err != nil {
+			return reply.MakeStandardErrorReply("ERR Protocol version is not an integer or out of range")
+		}
+		if version != reply.Resp2 && version != reply.Resp3 {
+			return reply.MakeStandardErrorReply("NOPROTO unsupported protocol version")
+		}
+		protocol = version
+	}
+	var username, password, name string
+	auth, setName := false, false
+	for i := 1; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		switch {
+		case option == "auth" && i+2 < len(args):
+			username, password = string(args[i+1]), string(args[i+2])
+			auth = true
+			i += 2
+		case option == "setname" && i+1 < len(args):
+			name = string(args[i+1])
+			if !isValidClientName(name) {
+				return makeInvalidClientNameReply()
+			}
+			setName = true
+			i++
+		default:
+			return reply.MakeStandardErrorReply("ERR Syntax error in HELLO option '" + string(args[i]) + "'")
+		}
+	}
+	if auth {
+		if !db.login(c, username, password) {
+			return makeWrongPassReply()
+		}
+	} else if !db.IsAuthenticated(c) {
+		return reply.MakeStandardErrorReply("NOAUTH HELLO must be called with the client already authenticated, " +
+			"otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client " +
+			"and select the RESP protocol version at the same time")
+	}
+	if setName {
+		c.SetName(name)
+	}
+	c.SetProtocol(protocol)
+
+	mode := "standalone"
+	if db.properties.Self != "" && len(db.properties.Peers) > 0 {
+		mode = "cluster"
+	}
+	return reply.MakeMapReply().
+		Add(reply.MakeBulkReply([]byte("server")), reply.MakeBulkReply([]byte("redis"))).
+		Add(reply.MakeBulkReply([]byte("version")), reply.MakeBulkReply([]byte(serverVersion))).
+		Add(reply.MakeBulkReply([]byte("proto")), reply.MakeIntReply(int64(protocol))).
+		Add(reply.MakeBulkReply([]byte("id")), reply.MakeIntReply(c.GetID())).
+		Add(reply.MakeBulkReply([]byte("mode")), reply.MakeBulkReply([]byte(mode))).
+		Add(reply.MakeBulkReply([]byte("role")), reply.MakeBulkReply([]byte("master"))).
+		Add(reply.MakeBulkReply([]byte("modules")), reply.MakeEmptyMultiBulkReply())
 }
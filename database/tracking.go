@@ -0,0 +1,391 @@
+package database
+
+import (
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// invalidateChannel is the channel a RESP2 redirect client subscribes to
+const invalidateChannel = "__redis__:invalidate"
+
+// the caching decision of an OPTIN or OPTOUT client, set by CLIENT CACHING for the next command
+const (
+	cachingUnset = iota
+	cachingYes
+	cachingNo
+)
+
+// trackingClient is the tracking state of a client
+type trackingClient struct {
+	client   resp.Connection
+	redirect int64 // the id of the client receiving the invalidations, 0 for the client itself
+	bcast    bool
+	optIn    bool
+	optOut   bool
+	noLoop   bool
+	prefixes []string // the prefixes of BCAST mode, empty means every key
+	caching  int32
+}
+
+// trackingTable remembers which clients cache which keys, and sends them invalidation messages.
+// Keys are tracked by name, regardless of the database they belong to.
+type trackingTable struct {
+	mutex    sync.Mutex
+	clients  map[int64]*trackingClient
+	keys     map[string]map[int64]struct{} // default mode: key -> ids of the clients which read it
+	prefixes map[string]map[int64]struct{} // BCAST mode: prefix -> ids of the clients
+	count    int32                         // the number of tracking clients, read without the lock
+	lookup   func(id int64) (resp.Connection, bool)
+}
+
+// makeTrackingTable creates a tracking table, lookup finds the redirect clients
+func makeTrackingTable(lookup func(id int64) (resp.Connection, bool)) *trackingTable {
+	return &trackingTable{
+		clients:  make(map[int64]*trackingClient),
+		keys:     make(map[string]map[int64]struct{}),
+		prefixes: make(map[string]map[int64]struct{}),
+		lookup:   lookup,
+	}
+}
+
+// enable turns tracking on for the client, or updates the prefixes of a BCAST client
+func (table *trackingTable) enable(tc *trackingClient) resp.Reply {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	id := tc.client.GetID()
+	if old, ok := table.clients[id]; ok {
+		if old.bcast != tc.bcast {
+			return reply.MakeStandardErrorReply("ERR You can't switch BCAST mode on/off before disabling tracking " +
+				"for this client, and then re-enabling it with a different mode.")
+		}
+		if old.optIn != tc.optIn || old.optOut != tc.optOut {
+			return reply.MakeStandardErrorReply("ERR You can't switch OPTIN/OPTOUT mode before disabling tracking " +
+				"for this client, and then re-enabling it with a different mode.")
+		}
+		tc.prefixes = append(old.prefixes, tc.prefixes...)
+	}
+	if tc.bcast {
+		if errReply := checkPrefixes(tc.prefixes); errReply != nil {
+			return errReply
+		}
+		if len(tc.prefixes) == 0 {
+			tc.prefixes = []string{""}
+		}
+	}
+	if _, ok := table.clients[id]; !ok {
+		atomic.AddInt32(&table.count, 1)
+	}
+	table.clients[id] = tc
+	for _, prefix := range tc.prefixes {
+		ids, ok := table.prefixes[prefix]
+		if !ok {
+			ids = make(map[int64]struct{})
+			table.prefixes[prefix] = ids
+		}
+		ids[id] = struct{}{}
+	}
+	return reply.MakeOkReply()
+}
+
+// checkPrefixes refuses prefixes of a client which overlap, so a key is not invalidated twice
+func checkPrefixes(prefixes []string) resp.Reply {
+	for i, a := range prefixes {
+		for _, b := range prefixes[i+1:] {
+			if a != b && (strings.HasPrefix(a, b) || strings.HasPrefix(b, a)) {
+				return reply.MakeStandardErrorReply("ERR Prefix '" + b + "' overlaps with an existing prefix '" + a +
+					"'. Prefixes for a single client must not overlap.")
+			}
+		}
+	}
+	return nil
+}
+
+// clientCount returns the number of tracking clients
+func (table *trackingTable) clientCount() int {
+	if table == nil {
+		return 0
+	}
+	return int(atomic.LoadInt32(&table.count))
+}
+
+// disable turns tracking off for the client, the keys it read are forgotten lazily
+func (table *trackingTable) disable(client resp.Connection) {
+	if table == nil {
+		return
+	}
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	id := client.GetID()
+	tc, ok := table.clients[id]
+	if !ok {
+		return
+	}
+	for _, prefix := range tc.prefixes {
+		delete(table.prefixes[prefix], id)
+		if len(table.prefixes[prefix]) == 0 {
+			delete(table.prefixes, prefix)
+		}
+	}
+	delete(table.clients, id)
+	atomic.AddInt32(&table.count, -1)
+}
+
+// get returns the tracking state of the client
+func (table *trackingTable) get(client resp.Connection) (*trackingClient, bool) {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	tc, ok := table.clients[client.GetID()]
+	return tc, ok
+}
+
+// trackRead remembers the keys read by a client in default mode, it is called with the keys locked
+func (table *trackingTable) trackRead(client resp.Connection, keys []string) {
+	if table == nil || atomic.LoadInt32(&table.count) == 0 {
+		return
+	}
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	id := client.GetID()
+	tc, ok := table.clients[id]
+	if !ok || tc.bcast {
+		return
+	}
+	caching := atomic.LoadInt32(&tc.caching)
+	if (tc.optIn && caching != cachingYes) || (tc.optOut && caching == cachingNo) {
+		return
+	}
+	for _, key := range keys {
+		ids, ok := table.keys[key]
+		if !ok {
+			ids = make(map[int64]struct{})
+			table.keys[key] = ids
+		}
+		ids[id] = struct{}{}
+	}
+}
+
+// afterCommand forgets the CLIENT CACHING decision, it only applies to the command following it
+func (table *trackingTable) afterCommand(client resp.Connection, commandName string) {
+	if table == nil || atomic.LoadInt32(&table.count) == 0 || commandName == "client" {
+		return
+	}
+	if tc, ok := table.get(client); ok {
+		atomic.StoreInt32(&tc.caching, cachingUnset)
+	}
+}
+
+// invalidate notifies the clients caching the keys written by the writer
+func (table *trackingTable) invalidate(writer resp.Connection, keys []string) {
+	if table == nil || atomic.LoadInt32(&table.count) == 0 {
+		return
+	}
+	targets := make(map[*trackingClient][]string)
+	table.mutex.Lock()
+	for _, key := range keys {
+		for id := range table.keys[key] {
+			if tc, ok := table.clients[id]; ok {
+				targets[tc] = append(targets[tc], key)
+			}
+		}
+		delete(table.keys, key)
+		for prefix, ids := range table.prefixes {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			for id := range ids {
+				tc := table.clients[id]
+				targets[tc] = append(targets[tc], key)
+			}
+		}
+	}
+	table.mutex.Unlock()
+	for tc, tcKeys := range targets {
+		if tc.noLoop && writer != nil && tc.client.GetID() == writer.GetID() {
+			continue
+		}
+		table.send(tc, reply.MakeMultiBulkReply(stringsToBytes(tcKeys)))
+	}
+}
+
+// invalidateAll notifies every tracking client that all keys changed, after FLUSHDB
+func (table *trackingTable) invalidateAll() {
+	if table == nil || atomic.LoadInt32(&table.count) == 0 {
+		return
+	}
+	table.mutex.Lock()
+	table.keys = make(map[string]map[int64]struct{})
+	clients := make([]*trackingClient, 0, len(table.clients))
+	for _, tc := range table.clients {
+		clients = append(clients, tc)
+	}
+	table.mutex.Unlock()
+	for _, tc := range clients {
+		table.send(tc, reply.MakeNullMultiBulkReply())
+	}
+}
+
+// send writes an invalidation message of the keys, which are null when every key is invalidated.
+// A RESP3 client receives them as a push, on its own connection or on the redirect one.
+// A RESP2 client receives them through a redirect client subscribed to __redis__:invalidate.
+func (table *trackingTable) send(tc *trackingClient, keys resp.Reply) {
+	target := tc.client
+	if tc.redirect != 0 {
+		var ok bool
+		if target, ok = table.lookup(tc.redirect); !ok {
+			return
+		}
+	}
+	if target.GetProtocol() >= reply.Resp3 {
+		push := reply.MakePushReply([]resp.Reply{reply.MakeBulkReply([]byte("invalidate")), keys})
+		_ = target.Write(push.ToResp3Bytes())
+		return
+	}
+	if tc.redirect == 0 || target.SubsCount() == 0 {
+		return
+	}
+	message := reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("message")),
+		reply.MakeBulkReply([]byte(invalidateChannel)),
+		keys,
+	})
+	_ = target.Write(message.ToBytes())
+}
+
+// stringsToBytes converts the strings to [][]byte
+func stringsToBytes(values []string) [][]byte {
+	result := make([][]byte, len(values))
+	for i, value := range values {
+		result[i] = []byte(value)
+	}
+	return result
+}
+
+// execClientTracking executes the client tracking commands.
+// CLIENT TRACKING ON|OFF [REDIRECT client-id] [PREFIX prefix [PREFIX prefix ...]] [BCAST] [OPTIN] [OPTOUT] [NOLOOP]
+func execClientTracking(db *StandaloneDatabase, c resp.Connection, args database.CommandLine) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgsNumErrorReply("client|tracking")
+	}
+	tc := &trackingClient{client: c}
+	for i := 1; i < len(args); i++ {
+		switch option := strings.ToLower(string(args[i])); {
+		case option == "redirect" && i+1 < len(args):
+			i++
+			id, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return reply.MakeStandardErrorReply("ERR value is not an integer or out of range")
+			}
+			if _, ok := db.clients.Load(id); !ok {
+				return reply.MakeStandardErrorReply("ERR The client ID you want redirect to does not exist")
+			}
+			tc.redirect = id
+		case option == "prefix" && i+1 < len(args):
+			i++
+			tc.prefixes = append(tc.prefixes, string(args[i]))
+		case option == "bcast":
+			tc.bcast = true
+		case option == "optin":
+			tc.optIn = true
+		case option == "optout":
+			tc.optOut = true
+		case option == "noloop":
+			tc.noLoop = true
+		default:
+			return reply.MakeSyntaxErrorReply()
+		}
+	}
+	switch strings.ToLower(string(args[0])) {
+	case "on":
+	case "off":
+		db.tracking.disable(c)
+		return reply.MakeOkReply()
+	default:
+		return reply.MakeSyntaxErrorReply()
+	}
+	if len(tc.prefixes) > 0 && !tc.bcast {
+		return reply.MakeStandardErrorReply("ERR PREFIX option requires BCAST mode to be enabled")
+	}
+	if tc.optIn && tc.optOut {
+		return reply.MakeStandardErrorReply("ERR You can't use both OPTIN and OPTOUT")
+	}
+	if tc.bcast && (tc.optIn || tc.optOut) {
+		return reply.MakeStandardErrorReply("ERR OPTIN and OPTOUT are not compatible with BCAST")
+	}
+	return db.tracking.enable(tc)
+}
+
+// execClientCaching executes the client caching commands.
+// CLIENT CACHING YES|NO
+func execClientCaching(db *StandaloneDatabase, c resp.Connection, args database.CommandLine) resp.Reply {
+	if len(args) != 1 {
+		return reply.MakeArgsNumErrorReply("client|caching")
+	}
+	tc, ok := db.tracking.get(c)
+	if !ok || (!tc.optIn && !tc.optOut) {
+		return reply.MakeStandardErrorReply("ERR CLIENT CACHING can be called only when the client is in " +
+			"tracking mode with OPTIN or OPTOUT mode enabled")
+	}
+	switch strings.ToLower(string(args[0])) {
+	case "yes":
+		if !tc.optIn {
+			return reply.MakeStandardErrorReply("ERR CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode.")
+		}
+		atomic.StoreInt32(&tc.caching, cachingYes)
+	case "no":
+		if !tc.optOut {
+			return reply.MakeStandardErrorReply("ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode.")
+		}
+		atomic.StoreInt32(&tc.caching, cachingNo)
+	default:
+		return reply.MakeSyntaxErrorReply()
+	}
+	return reply.MakeOkReply()
+}
+
+// execClientGetRedir executes the client getredir commands, it replies -1 if tracking is off.
+// CLIENT GETREDIR
+func execClientGetRedir(db *StandaloneDatabase, c resp.Connection) resp.Reply {
+	tc, ok := db.tracking.get(c)
+	if !ok {
+		return reply.MakeIntReply(-1)
+	}
+	return reply.MakeIntReply(tc.redirect)
+}
+
+// execClientTrackingInfo executes the client trackinginfo commands.
+// CLIENT TRACKINGINFO
+func execClientTrackingInfo(db *StandaloneDatabase, c resp.Connection) resp.Reply {
+	tc, ok := db.tracking.get(c)
+	var flags []string
+	redirect := int64(-1)
+	var prefixes []string
+	if !ok {
+		flags = []string{"off"}
+	} else {
+		flags = []string{"on"}
+		redirect = tc.redirect
+		for flag, set := range map[string]bool{"bcast": tc.bcast, "optin": tc.optIn, "optout": tc.optOut, "noloop": tc.noLoop} {
+			if set {
+				flags = append(flags, flag)
+			}
+		}
+		if tc.bcast {
+			prefixes = tc.prefixes
+		}
+	}
+	sort.Strings(flags[1:])
+	flagReplies := make([]resp.Reply, len(flags))
+	for i, flag := range flags {
+		flagReplies[i] = reply.MakeBulkReply([]byte(flag))
+	}
+	return reply.MakeMapReply().
+		Add(reply.MakeBulkReply([]byte("flags")), reply.MakeSetReply(flagReplies)).
+		Add(reply.MakeBulkReply([]byte("redirect")), reply.MakeIntReply(redirect)).
+		Add(reply.MakeBulkReply([]byte("prefixes")), reply.MakeMultiBulkReply(stringsToBytes(prefixes)))
+}
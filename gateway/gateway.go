@@ -0,0 +1,283 @@
+// Package gateway serves the database over http, the commands and their replies are carried as json.
+//
+//	GET /GET/key                        one command, each path segment is an argument
+//	POST / ["SET", "key", "value"]      one command
+//	POST / [["INCR", "n"], ["GET", "n"]] a pipeline, executed in order on one connection
+//
+// A command replies {"result": ...} or {"error": "..."}, a pipeline replies an array of them.
+// Strings which are not valid utf-8 are sent as {"base64": "..."}, in the replies and in the arguments.
+// The password is sent in the Authorization header, as a bearer token or with basic authentication.
+// SUBSCRIBE, PSUBSCRIBE and SSUBSCRIBE stream their messages as Server-Sent Events.
+package gateway
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/logger"
+	"go-redis/lib/sync/atomic"
+	"go-redis/resp/reply"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// ClientSlots bounds the clients served at once, each request is a client like a resp connection is
+type ClientSlots interface {
+	TakeClientSlot() bool // false if every slot is taken
+	ReleaseClientSlot()
+}
+
+// Gateway is the http handler of the gateway
+type Gateway struct {
+	database    database.Database
+	slots       ClientSlots
+	maxBodySize int64 // the largest request body, like the largest command of a resp client
+	closing     atomic.Boolean
+	closeOnce   sync.Once
+	done        chan struct{} // closed with the gateway, ends the streams
+}
+
+// MakeGateway returns a gateway executing the commands on db, each request holds one of slots while it is served
+func MakeGateway(db database.Database, slots ClientSlots, maxBodySize int64) *Gateway {
+	return &Gateway{
+		database:    db,
+		slots:       slots,
+		maxBodySize: maxBodySize,
+		done:        make(chan struct{}),
+	}
+}
+
+// Close ends the streams, the requests received afterwards are refused
+func (gateway *Gateway) Close() {
+	gateway.closeOnce.Do(func() {
+		gateway.closing.Set(true)
+		close(gateway.done)
+	})
+}
+
+// ServeHTTP executes the command or the pipeline of the request
+func (gateway *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if gateway.closing.Get() {
+		writeError(w, http.StatusServiceUnavailable, "ERR server is shutting down")
+		return
+	}
+	if !gateway.slots.TakeClientSlot() {
+		gateway.database.Stats().IncrRejectedConnections()
+		writeError(w, http.StatusServiceUnavailable, "ERR max number of clients reached")
+		return
+	}
+	defer gateway.slots.ReleaseClientSlot()
+	gateway.database.Stats().IncrConnectionsReceived()
+	var commands [][][]byte
+	var pipeline bool
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		commands, err = parsePath(r.URL)
+	case http.MethodPost:
+		if r.URL.Path != "/" {
+			writeError(w, http.StatusNotFound, "ERR commands are posted to /")
+			return
+		}
+		commands, pipeline, err = parseBody(http.MaxBytesReader(w, r.Body, gateway.maxBodySize))
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "ERR only GET and POST are allowed")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "ERR "+err.Error())
+		return
+	}
+
+	conn := makeConnection()
+	gateway.database.AfterClientConnect(conn)
+	defer gateway.database.AfterClientClose(conn)
+	if errorReply := gateway.authenticate(conn, r); errorReply != nil {
+		writeError(w, http.StatusUnauthorized, errorReply.Error())
+		return
+	}
+
+	if !pipeline && isSubscribe(commands[0]) {
+		gateway.stream(w, r, conn, commands[0])
+		return
+	}
+	results := make([]interface{}, len(commands))
+	for i, args := range commands {
+		if isSubscribe(args) {
+			results[i] = &errorJSON{Error: "ERR " + strings.ToUpper(string(args[0])) + " is only allowed alone, its messages are streamed"}
+			continue
+		}
+		result := gateway.exec(r, conn, args)
+		if result == nil {
+			// the client went away while the command was blocked
+			return
+		}
+		results[i] = makeReplyJSON(result)
+	}
+	if pipeline {
+		writeJSON(w, http.StatusOK, results)
+		return
+	}
+	writeJSON(w, statusOf(results[0]), results[0])
+}
+
+// authenticate sends AUTH with the credentials of the Authorization header, it returns the error replied if any
+func (gateway *Gateway) authenticate(conn *httpConnection, r *http.Request) resp.ErrorReply {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil
+	}
+	var args [][]byte
+	if user, password, ok := r.BasicAuth(); ok {
+		args = [][]byte{[]byte("AUTH"), []byte(user), []byte(password)}
+	} else if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+		args = [][]byte{[]byte("AUTH"), []byte(token)}
+	} else {
+		return reply.MakeStandardErrorReply("ERR the Authorization header must be Bearer or Basic")
+	}
+	if errorReply, ok := gateway.database.Exec(conn, args).(resp.ErrorReply); ok {
+		return errorReply
+	}
+	return nil
+}
+
+// exec executes a command and waits for the reply of a blocking one, it returns nil if the request ends first
+func (gateway *Gateway) exec(r *http.Request, conn *httpConnection, args [][]byte) resp.Reply {
+	conn.MarkCommand(strings.ToLower(string(args[0])))
+	gateway.database.Stats().IncrCommandsProcessed()
+	result := gateway.database.Exec(conn, args)
+	if result == nil {
+		return reply.MakeUnknownErrorReply()
+	}
+	if blocking, ok := result.(resp.BlockingReply); ok {
+		// the client is unblocked by AfterClientClose if the request ends first
+		select {
+		case result = <-blocking.Wait():
+		case <-r.Context().Done():
+			return nil
+		case <-gateway.done:
+			return nil
+		}
+	}
+	return result
+}
+
+// parsePath returns the command of a GET request, e.g. /GET/key, the segments are unescaped so they may hold a '/'
+func parsePath(u *url.URL) ([][][]byte, error) {
+	path := strings.Trim(u.EscapedPath(), "/")
+	if path == "" {
+		return nil, errors.New("no command, the path is /COMMAND/arg/...")
+	}
+	segments := strings.Split(path, "/")
+	args := make([][]byte, len(segments))
+	for i, segment := range segments {
+		arg, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = []byte(arg)
+	}
+	return [][][]byte{args}, nil
+}
+
+// parseBody returns the commands of a POST request, a json array of arguments or an array of such arrays
+func parseBody(body io.Reader) (commands [][][]byte, pipeline bool, err error) {
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	var values []interface{}
+	if err := decoder.Decode(&values); err != nil {
+		return nil, false, errors.New("the body must be a json array: " + err.Error())
+	}
+	if len(values) == 0 {
+		return nil, false, errors.New("no command")
+	}
+	if _, ok := values[0].([]interface{}); !ok {
+		args, err := toArgs(values)
+		if err != nil {
+			return nil, false, err
+		}
+		return [][][]byte{args}, false, nil
+	}
+	commands = make([][][]byte, len(values))
+	for i, value := range values {
+		array, ok := value.([]interface{})
+		if !ok || len(array) == 0 {
+			return nil, false, errors.New("every command of a pipeline must be a non empty array")
+		}
+		if commands[i], err = toArgs(array); err != nil {
+			return nil, false, err
+		}
+	}
+	return commands, true, nil
+}
+
+// toArgs returns the arguments of a command, they are strings, numbers or {"base64": "..."} for binary strings
+func toArgs(values []interface{}) ([][]byte, error) {
+	args := make([][]byte, len(values))
+	for i, value := range values {
+		switch value := value.(type) {
+		case string:
+			args[i] = []byte(value)
+		case json.Number:
+			args[i] = []byte(value.String())
+		case map[string]interface{}:
+			encoded, ok := value["base64"].(string)
+			if !ok || len(value) != 1 {
+				return nil, errors.New(`an object argument must be {"base64": "..."}`)
+			}
+			arg, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, errors.New("invalid base64 argument: " + err.Error())
+			}
+			args[i] = arg
+		default:
+			return nil, errors.New(`the arguments must be strings, numbers or {"base64": "..."}`)
+		}
+	}
+	return args, nil
+}
+
+// isSubscribe returns true for the commands whose messages are streamed
+func isSubscribe(args [][]byte) bool {
+	switch strings.ToLower(string(args[0])) {
+	case "subscribe", "psubscribe", "ssubscribe":
+		return true
+	}
+	return false
+}
+
+// statusOf returns the http status of a single command, an error reply is a bad request unless it is about authentication
+func statusOf(result interface{}) int {
+	errorResult, ok := result.(*errorJSON)
+	if !ok {
+		return http.StatusOK
+	}
+	if strings.HasPrefix(errorResult.Error, "NOAUTH") || strings.HasPrefix(errorResult.Error, "WRONGPASS") {
+		return http.StatusUnauthorized
+	}
+	return http.StatusBadRequest
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, &errorJSON{Error: message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(value); err != nil {
+		logger.Error("failed to encode a reply as json: " + err.Error())
+		status = http.StatusInternalServerError
+		buf.Reset()
+		buf.WriteString(`{"error":"ERR the reply can not be encoded as json"}` + "\n")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+}
@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"go-redis/config"
+	"go-redis/database"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// unlimitedSlots admits every request
+type unlimitedSlots struct{}
+
+func (unlimitedSlots) TakeClientSlot() bool { return true }
+func (unlimitedSlots) ReleaseClientSlot()   {}
+
+func makeTestGateway(t *testing.T) *Gateway {
+	db := database.NewStandaloneDatabase(&config.ServerProperties{Databases: 1})
+	gateway := MakeGateway(db, unlimitedSlots{}, 1024*1024)
+	t.Cleanup(func() {
+		gateway.Close()
+		db.Close()
+	})
+	return gateway
+}
+
+// serve sends a request to the gateway and returns the body of the response
+func serve(t *testing.T, gateway *Gateway, method string, target string, body string) string {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	gateway.ServeHTTP(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+	result, _ := io.ReadAll(recorder.Result().Body)
+	return strings.TrimSpace(string(result))
+}
+
+func TestBinaryValue(t *testing.T) {
+	gateway := makeTestGateway(t)
+	// the bytes ff 00 01 02 are not valid utf-8
+	if got, want := serve(t, gateway, http.MethodPost, "/", `["SET", "bin", {"base64": "/wABAg=="}]`), `{"result":"OK"}`; got != want {
+		t.Fatalf("SET = %s, want %s", got, want)
+	}
+	if got, want := serve(t, gateway, http.MethodGet, "/GET/bin", ""), `{"result":{"base64":"/wABAg=="}}`; got != want {
+		t.Errorf("GET = %s, want %s", got, want)
+	}
+	if got, want := serve(t, gateway, http.MethodGet, "/STRLEN/bin", ""), `{"result":4}`; got != want {
+		t.Errorf("STRLEN = %s, want %s", got, want)
+	}
+	if got, want := serve(t, gateway, http.MethodPost, "/", `[["RPUSH", "list", "héllo", {"base64": "/wABAg=="}], ["LRANGE", "list", "0", "-1"]]`),
+		`[{"result":2},{"result":["héllo",{"base64":"/wABAg=="}]}]`; got != want {
+		t.Errorf("pipeline = %s, want %s", got, want)
+	}
+}
+
+func TestInvalidBinaryArgument(t *testing.T) {
+	gateway := makeTestGateway(t)
+	for _, body := range []string{`["SET", "bin", {"base64": "not base64!"}]`, `["SET", "bin", {"hex": "ff"}]`} {
+		if got := serve(t, gateway, http.MethodPost, "/", body); !strings.HasPrefix(got, `{"error":"ERR `) {
+			t.Errorf("%s = %s, want an error", body, got)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"go-redis/interface/resp"
+	"go-redis/resp/parser"
+	"go-redis/resp/reply"
+	"math"
+	"unicode/utf8"
+)
+
+// errorJSON is the json of an error reply, nested or not
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+// binaryJSON is the json of a string which is not valid utf-8, json strings would replace its invalid bytes.
+// It is accepted as an argument too.
+type binaryJSON struct {
+	Base64 string `json:"base64"`
+}
+
+// resultJSON is the json of a successful reply
+type resultJSON struct {
+	Result interface{} `json:"result"`
+}
+
+// makeReplyJSON returns the json of a top level reply, {"result": ...} or {"error": "..."}
+func makeReplyJSON(r resp.Reply) interface{} {
+	if errorReply, ok := r.(resp.ErrorReply); ok {
+		return &errorJSON{Error: errorReply.Error()}
+	}
+	return &resultJSON{Result: toJSON(r)}
+}
+
+// toJSON returns the value of a reply which encoding/json serializes.
+// Strings, integers, nulls and arrays map as they are; maps become objects, doubles numbers and booleans booleans.
+// A string which is not valid utf-8 becomes {"base64": "..."}.
+func toJSON(r resp.Reply) interface{} {
+	switch r := r.(type) {
+	case resp.ErrorReply:
+		return &errorJSON{Error: r.Error()}
+	case *reply.BulkReply:
+		return toJSONString(r.Arg)
+	case *reply.StatusReply:
+		return r.Status
+	case *reply.OkReply:
+		return "OK"
+	case *reply.PongReply:
+		return "PONG"
+	case *reply.IntReply:
+		return r.Code
+	case *reply.NullBulkReply, *reply.NullMultiBulkReply, *reply.NullReply:
+		return nil
+	case *reply.EmptyMultiBulkReply:
+		return []interface{}{}
+	case *reply.MultiBulkReply:
+		values := make([]interface{}, len(r.Args))
+		for i, arg := range r.Args {
+			if arg != nil {
+				values[i] = toJSONString(arg)
+			}
+		}
+		return values
+	case *reply.MultiRawReply:
+		return toJSONArray(r.Replies)
+	case *reply.SetReply:
+		return toJSONArray(r.Members)
+	case *reply.PushReply:
+		return toJSONArray(r.Items)
+	case *reply.MapReply:
+		values := make(map[string]interface{}, len(r.Keys))
+		for i, key := range r.Keys {
+			values[toJSONKey(key)] = toJSON(r.Values[i])
+		}
+		return values
+	case *reply.DoubleReply:
+		// json has no infinity nor nan
+		if math.IsInf(r.Value, 0) || math.IsNaN(r.Value) {
+			return reply.FormatDouble(r.Value)
+		}
+		return r.Value
+	case *reply.BooleanReply:
+		return r.Value
+	case *reply.BigNumberReply:
+		return json.Number(r.Value.String())
+	case *reply.VerbatimReply:
+		return toJSONString(r.Text)
+	case *reply.AttributeReply:
+		return toJSON(r.Reply)
+	case *reply.VersionedReply:
+		// json keeps the shape of RESP3, e.g. the pairs of a map
+		return toJSON(r.Resp3Reply)
+	}
+	// the replies of modules are decoded from their bytes
+	p := parser.NewParser(bytes.NewReader(r.ToBytes()))
+	defer p.Release()
+	decoded, err := p.ReadReply()
+	if err != nil {
+		return nil
+	}
+	return toJSON(decoded)
+}
+
+// toJSONString returns a string as a json string, or as base64 if it is not valid utf-8
+func toJSONString(b []byte) interface{} {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return &binaryJSON{Base64: base64.StdEncoding.EncodeToString(b)}
+}
+
+func toJSONArray(replies []resp.Reply) []interface{} {
+	values := make([]interface{}, len(replies))
+	for i, r := range replies {
+		values[i] = toJSON(r)
+	}
+	return values
+}
+
+// toJSONKey returns the key of a map as a string, a key which is not a string is its json
+func toJSONKey(key resp.Reply) string {
+	value := toJSON(key)
+	if s, ok := value.(string); ok {
+		return s
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
@@ -0,0 +1,144 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"go-redis/interface/resp"
+	"go-redis/lib/logger"
+	"go-redis/resp/connection"
+	"go-redis/resp/parser"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// maxPendingPushes bounds the pushes waiting to be streamed, a client reading slower than they come is dropped
+const maxPendingPushes = 1024
+
+// errTooManyPushes is returned by the writes to a connection whose client does not read its stream
+var errTooManyPushes = errors.New("too many pushes waiting to be streamed")
+
+// httpConnection is the connection of a request. The pushes written to it, the pub/sub messages, are queued for the stream.
+type httpConnection struct {
+	*connection.Connection
+	pushes       chan []byte
+	overflow     chan struct{} // closed once a push did not fit in the queue
+	overflowOnce sync.Once
+}
+
+func makeConnection() *httpConnection {
+	return &httpConnection{
+		Connection: connection.NewConnection(nil),
+		pushes:     make(chan []byte, maxPendingPushes),
+		overflow:   make(chan struct{}),
+	}
+}
+
+// Write queues a push for the stream
+func (conn *httpConnection) Write(b []byte) error {
+	push := make([]byte, len(b))
+	copy(push, b)
+	select {
+	case conn.pushes <- push:
+		return nil
+	default:
+		conn.overflowOnce.Do(func() {
+			close(conn.overflow)
+		})
+		return errTooManyPushes
+	}
+}
+
+// stream subscribes and sends each push as an event named after its kind, until the client or the server goes away
+func (gateway *Gateway) stream(w http.ResponseWriter, r *http.Request, conn *httpConnection, args [][]byte) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "ERR streaming is not supported")
+		return
+	}
+	result := gateway.exec(r, conn, args)
+	if errorReply, ok := result.(resp.ErrorReply); ok {
+		writeJSON(w, statusOf(&errorJSON{Error: errorReply.Error()}), &errorJSON{Error: errorReply.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case push := <-conn.pushes:
+			if err := writeEvents(w, push); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-conn.overflow:
+			logger.Warn("Stream closed, the client does not read its messages: " + r.RemoteAddr)
+			return
+		case <-r.Context().Done():
+			return
+		case <-gateway.done:
+			return
+		}
+	}
+}
+
+// writeEvents decodes the pushes of b and writes an event for each one
+func writeEvents(w io.Writer, b []byte) error {
+	p := parser.NewParser(bytes.NewReader(b))
+	defer p.Release()
+	for {
+		push, err := p.ReadReply()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		kind, data := makeEvent(toJSON(push))
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "event: "+kind+"\ndata: "+string(encoded)+"\n\n"); err != nil {
+			return err
+		}
+	}
+}
+
+// messageEvent is the data of a message event, the pattern is only set for the messages of PSUBSCRIBE
+type messageEvent struct {
+	Pattern interface{} `json:"pattern,omitempty"`
+	Channel interface{} `json:"channel"`
+	Payload interface{} `json:"payload"`
+}
+
+// subscriptionEvent is the data of the confirmation of a subscribe or an unsubscribe
+type subscriptionEvent struct {
+	Channel interface{} `json:"channel"`
+	Count   interface{} `json:"count"`
+}
+
+// makeEvent returns the name and the data of the event of a push, e.g. ["message", "news", "hi"]
+func makeEvent(push interface{}) (string, interface{}) {
+	items, ok := push.([]interface{})
+	if !ok || len(items) == 0 {
+		return "push", push
+	}
+	kind, ok := items[0].(string)
+	if !ok {
+		return "push", push
+	}
+	kind = strings.ToLower(kind)
+	switch {
+	case (kind == "message" || kind == "smessage") && len(items) == 3:
+		return kind, &messageEvent{Channel: items[1], Payload: items[2]}
+	case kind == "pmessage" && len(items) == 4:
+		return kind, &messageEvent{Pattern: items[1], Channel: items[2], Payload: items[3]}
+	case strings.HasSuffix(kind, "subscribe") && len(items) == 3:
+		return kind, &subscriptionEvent{Channel: items[1], Count: items[2]}
+	}
+	return kind, items[1:]
+}
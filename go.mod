@@ -1,5 +1,3 @@
 module go-redis
 
 go 1.21
-
-require github.com/jolestar/go-commons-pool/v2 v2.1.2
@@ -11,7 +11,13 @@ type ClusterDatabase interface {
 	RelayToPeer(peer string, connection resp.Connection, args database.CommandLine) resp.Reply
 	Broadcast(connection resp.Connection, args database.CommandLine) map[string]resp.Reply
 	GetPeerNode(key string) string
+	GetSlotNode(slot int) string
 	GetDatabase() database.DatabaseEngine
+	GetSelf() string
+	GetPeers() []string
+	IsPeer(connection resp.Connection) bool
+	AddPeer(peer string) bool
+	RemovePeer(peer string) bool
 }
 
 // CommandFunc is a function that executes a command
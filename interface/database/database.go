@@ -2,6 +2,7 @@ package database
 
 import (
 	"go-redis/interface/resp"
+	"go-redis/lib/stats"
 	"time"
 )
 
@@ -11,7 +12,9 @@ type CommandLine = [][]byte
 type Database interface {
 	Exec(client resp.Connection, args CommandLine) resp.Reply
 	Close()
+	AfterClientConnect(client resp.Connection)
 	AfterClientClose(client resp.Connection)
+	Stats() *stats.Stats // the counters reported by INFO
 }
 
 // DatabaseEngine is the embedding storage engine exposing more methods for complex application
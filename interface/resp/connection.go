@@ -1,5 +1,7 @@
 package resp
 
+import "time"
+
 type Connection interface {
 	Write([]byte) error
 	GetDBIndex() int
@@ -7,4 +9,33 @@ type Connection interface {
 
 	SetPassword(string)
 	GetPassword() string
+
+	// pub/sub channels, patterns and shard channels of the connection
+	Subscribe(channel string)
+	UnSubscribe(channel string)
+	PSubscribe(pattern string)
+	PUnSubscribe(pattern string)
+	SSubscribe(channel string)
+	SUnSubscribe(channel string)
+	SubsCount() int
+	ShardSubsCount() int
+	GetChannels() []string
+	GetPatterns() []string
+	GetShardChannels() []string
+
+	// identity and activity of the connection, reported by the CLIENT command
+	GetID() int64
+	SetName(string)
+	GetName() string
+	RemoteAddr() string
+	IsUnixSocket() bool
+	GetCreatedAt() time.Time
+	GetLastInteraction() time.Time
+	GetLastCommand() string
+	SetBlocked(bool)
+	IsBlocked() bool
+
+	// RESP version negotiated by HELLO
+	SetProtocol(int)
+	GetProtocol() int
 }
@@ -4,7 +4,20 @@ type Reply interface {
 	ToBytes() []byte
 }
 
+// Resp3Reply is implemented by the replies encoded differently under RESP3, ToBytes returns their RESP2 form
+type Resp3Reply interface {
+	Reply
+	ToResp3Bytes() []byte
+}
+
 type ErrorReply interface {
 	Error() string
 	ToBytes() []byte
 }
+
+// BlockingReply is returned by a command which blocks the client until it is served or times out
+type BlockingReply interface {
+	Reply
+	// Wait returns the channel delivering the final reply
+	Wait() <-chan Reply
+}
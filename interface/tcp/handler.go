@@ -10,3 +10,19 @@ type Handler interface {
 	Handle(ctx context.Context, conn net.Conn)
 	Close() error
 }
+
+// ConnectionLimiter is implemented by the handlers limiting the number of connections.
+// The server calls Admit in its accept loop, a refused connection is closed by Admit and never handled.
+type ConnectionLimiter interface {
+	Admit(conn net.Conn) bool
+}
+
+// ShutdownNotifier is implemented by the handlers which may ask the server to shut down, e.g. on the SHUTDOWN command
+type ShutdownNotifier interface {
+	ShutdownRequested() <-chan struct{}
+}
+
+// CertificateReloader is implemented by the handlers holding certificates of their own, e.g. to dial the cluster peers over tls
+type CertificateReloader interface {
+	ReloadCertificates() error
+}
@@ -50,7 +50,14 @@ func (nodeMap *NodeMap) GetNode(key string) string {
 	if nodeMap.IsEmpty() {
 		return ""
 	}
-	hash := int(nodeMap.hashFunc([]byte(key)))
+	return nodeMap.GetNodeOfHash(int(nodeMap.hashFunc([]byte(key))))
+}
+
+// GetNodeOfHash returns the node owning the point hash of the ring
+func (nodeMap *NodeMap) GetNodeOfHash(hash int) string {
+	if nodeMap.IsEmpty() {
+		return ""
+	}
 	index := sort.Search(len(nodeMap.NodeHashes), func(i int) bool {
 		return nodeMap.NodeHashes[i] >= hash
 	})
@@ -0,0 +1,47 @@
+package hash_slot
+
+import "strings"
+
+// SlotCount is the number of hash slots the keys are spread over, as in redis cluster
+const SlotCount = 16384
+
+// crc16Table is the table of CRC16-CCITT (XMODEM), the checksum redis cluster hashes the keys with
+var crc16Table [256]uint16
+
+func init() {
+	for i := range crc16Table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		crc16Table[i] = crc
+	}
+}
+
+func crc16(data string) uint16 {
+	var crc uint16
+	for i := 0; i < len(data); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^data[i]]
+	}
+	return crc
+}
+
+// HashTag returns the part of key between the first '{' and the next '}' if it is not empty, else the whole key.
+// The keys sharing a hash tag are in the same slot.
+func HashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+// Slot returns the hash slot of key
+func Slot(key string) int {
+	return int(crc16(HashTag(key))) % SlotCount
+}
@@ -0,0 +1,61 @@
+package hash_slot
+
+import "testing"
+
+func TestCrc16(t *testing.T) {
+	// the check value of CRC16-CCITT (XMODEM), given by the redis cluster specification
+	if got := crc16("123456789"); got != 0x31C3 {
+		t.Errorf("crc16(%q) = %#x, want 0x31c3", "123456789", got)
+	}
+}
+
+func TestHashTag(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"foo", "foo"},
+		{"{user1000}.following", "user1000"},
+		{"foo{bar}{zap}", "bar"},
+		{"foo{{bar}}zap", "{bar"},
+		{"foo{}{bar}", "foo{}{bar}"},
+		{"foo{bar", "foo{bar"},
+		{"foo}bar{", "foo}bar{"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := HashTag(test.key); got != test.want {
+			t.Errorf("HashTag(%q) = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
+
+func TestSlot(t *testing.T) {
+	// the slots CLUSTER KEYSLOT replies in redis
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"foo", 12182},
+		{"bar", 5061},
+		{"hello", 866},
+		{"", 0},
+	}
+	for _, test := range tests {
+		if got := Slot(test.key); got != test.want {
+			t.Errorf("Slot(%q) = %d, want %d", test.key, got, test.want)
+		}
+	}
+}
+
+func TestSlotOfHashTag(t *testing.T) {
+	if Slot("{user1000}.following") != Slot("{user1000}.followers") {
+		t.Error("keys sharing a hash tag are in different slots")
+	}
+	if Slot("{user1000}.following") != Slot("user1000") {
+		t.Error("a key is not in the slot of its hash tag")
+	}
+	if Slot("foo{}{bar}") == Slot("bar") {
+		t.Error("an empty hash tag is used")
+	}
+}
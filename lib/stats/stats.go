@@ -0,0 +1,62 @@
+// Package stats holds the server wide counters reported by INFO
+package stats
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats are the counters of one server, each server embedded in a process has its own
+type Stats struct {
+	StartTime time.Time // when the server started
+
+	totalConnectionsReceived              int64
+	totalCommandsProcessed                int64
+	clientOutputBufferLimitDisconnections int64
+	rejectedConnections                   int64
+}
+
+// MakeStats returns the counters of a server starting now
+func MakeStats() *Stats {
+	return &Stats{StartTime: time.Now()}
+}
+
+// IncrConnectionsReceived counts an accepted connection
+func (stats *Stats) IncrConnectionsReceived() {
+	atomic.AddInt64(&stats.totalConnectionsReceived, 1)
+}
+
+// ConnectionsReceived returns the number of accepted connections
+func (stats *Stats) ConnectionsReceived() int64 {
+	return atomic.LoadInt64(&stats.totalConnectionsReceived)
+}
+
+// IncrCommandsProcessed counts a command executed
+func (stats *Stats) IncrCommandsProcessed() {
+	atomic.AddInt64(&stats.totalCommandsProcessed, 1)
+}
+
+// CommandsProcessed returns the number of commands executed
+func (stats *Stats) CommandsProcessed() int64 {
+	return atomic.LoadInt64(&stats.totalCommandsProcessed)
+}
+
+// IncrOutputBufferLimitDisconnections counts a client closed for crossing its output buffer limit
+func (stats *Stats) IncrOutputBufferLimitDisconnections() {
+	atomic.AddInt64(&stats.clientOutputBufferLimitDisconnections, 1)
+}
+
+// OutputBufferLimitDisconnections returns the number of clients closed for crossing their output buffer limit
+func (stats *Stats) OutputBufferLimitDisconnections() int64 {
+	return atomic.LoadInt64(&stats.clientOutputBufferLimitDisconnections)
+}
+
+// IncrRejectedConnections counts a connection rejected because of the maxclients limit
+func (stats *Stats) IncrRejectedConnections() {
+	atomic.AddInt64(&stats.rejectedConnections, 1)
+}
+
+// RejectedConnections returns the number of connections rejected because of the maxclients limit
+func (stats *Stats) RejectedConnections() int64 {
+	return atomic.LoadInt64(&stats.rejectedConnections)
+}
@@ -0,0 +1,125 @@
+package timewheel
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// job is a task scheduled on the wheel.
+type job struct {
+	key    string
+	circle int // the number of turns left before the job runs
+	task   func()
+}
+
+// location records where a job is stored, so it can be removed.
+type location struct {
+	slot    int
+	element *list.Element
+}
+
+// TimeWheel runs delayed tasks with the precision of one tick.
+type TimeWheel struct {
+	interval time.Duration
+	slots    []*list.List
+	current  int
+	jobs     map[string]*location // key -> location of the job
+	mutex    sync.Mutex
+	ticker   *time.Ticker
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// New creates a time wheel of slotNum slots, the hand moves one slot every interval.
+func New(interval time.Duration, slotNum int) *TimeWheel {
+	slots := make([]*list.List, slotNum)
+	for i := range slots {
+		slots[i] = list.New()
+	}
+	return &TimeWheel{
+		interval: interval,
+		slots:    slots,
+		jobs:     make(map[string]*location),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start starts moving the hand of the wheel.
+func (wheel *TimeWheel) Start() {
+	wheel.ticker = time.NewTicker(wheel.interval)
+	go func() {
+		for {
+			select {
+			case <-wheel.ticker.C:
+				wheel.tick()
+			case <-wheel.stopChan:
+				wheel.ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the wheel, the pending jobs never run.
+func (wheel *TimeWheel) Stop() {
+	wheel.stopOnce.Do(func() {
+		close(wheel.stopChan)
+	})
+}
+
+// AddJob runs task after delay, a job with the same key is replaced.
+func (wheel *TimeWheel) AddJob(delay time.Duration, key string, task func()) {
+	wheel.mutex.Lock()
+	defer wheel.mutex.Unlock()
+	wheel.removeJob(key)
+	ticks := int((delay + wheel.interval - 1) / wheel.interval)
+	if ticks <= 0 {
+		ticks = 1
+	}
+	slot := (wheel.current + ticks) % len(wheel.slots)
+	circle := (ticks - 1) / len(wheel.slots)
+	element := wheel.slots[slot].PushBack(&job{key: key, circle: circle, task: task})
+	wheel.jobs[key] = &location{slot: slot, element: element}
+}
+
+// RemoveJob cancels the job with the given key.
+func (wheel *TimeWheel) RemoveJob(key string) {
+	wheel.mutex.Lock()
+	defer wheel.mutex.Unlock()
+	wheel.removeJob(key)
+}
+
+func (wheel *TimeWheel) removeJob(key string) {
+	loc, ok := wheel.jobs[key]
+	if !ok {
+		return
+	}
+	wheel.slots[loc.slot].Remove(loc.element)
+	delete(wheel.jobs, key)
+}
+
+// tick moves the hand to the next slot and runs the jobs due.
+func (wheel *TimeWheel) tick() {
+	var due []func()
+	wheel.mutex.Lock()
+	wheel.current = (wheel.current + 1) % len(wheel.slots)
+	slot := wheel.slots[wheel.current]
+	for element := slot.Front(); element != nil; {
+		next := element.Next()
+		j := element.Value.(*job)
+		if j.circle > 0 {
+			j.circle--
+		} else {
+			due = append(due, j.task)
+			slot.Remove(element)
+			delete(wheel.jobs, j.key)
+		}
+		element = next
+	}
+	wheel.mutex.Unlock()
+	// the tasks run outside the lock, so they may schedule or cancel jobs
+	for _, task := range due {
+		go task()
+	}
+}
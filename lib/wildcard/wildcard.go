@@ -73,5 +73,14 @@ func CompilePattern(src string) (*Pattern, error) {
 
 // IsMatch returns whether the given string matches pattern
 func (p *Pattern) IsMatch(s string) bool {
-	return p.exp.Match([]byte(s))
+	return p.exp.MatchString(s)
+}
+
+// LiteralPrefix returns the part of a wildcard string before its first special character.
+// Every string matching the pattern starts with this prefix.
+func LiteralPrefix(src string) string {
+	if i := strings.IndexAny(src, `*?[\`); i >= 0 {
+		return src[:i]
+	}
+	return src
 }
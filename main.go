@@ -7,6 +7,7 @@ import (
 	"go-redis/resp/handler"
 	"go-redis/tcp"
 	"os"
+	"strconv"
 )
 
 const configFile = "redis.conf"
@@ -14,6 +15,10 @@ const configFile = "redis.conf"
 var defaultProperties = &config.ServerProperties{
 	Bind:                       "127.0.0.1",
 	Port:                       6379,
+	MaxClients:                 10000,
+	TCPKeepAlive:               300,
+	ProtoMaxBulkLen:            "512mb",
+	ClientQueryBufferLimit:     "1gb",
 	AppendOnly:                 false,
 	AppendFilename:             "appendOnly.aof",
 	AppendFsync:                "everysec",
@@ -42,11 +47,44 @@ func main() {
 		config.Properties = defaultProperties
 	}
 
-	err := tcp.ListenAndServeWithSignal(
-		&tcp.Config{Addr: fmt.Sprintf("%s:%d", config.Properties.Bind, config.Properties.Port)},
-		handler.MakeHandler(),
-	)
+	tcpConfig, err := makeTCPConfig(config.Properties)
 	if err != nil {
 		logger.Error(err)
+		return
 	}
+	err = tcp.ListenAndServeWithSignal(tcpConfig, handler.MakeHandler(config.Properties))
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// makeTCPConfig returns the listeners to serve, port 0 disables plain tcp, tls-port enables tls, unixsocket the unix socket
+// and http-port the http gateway
+func makeTCPConfig(properties *config.ServerProperties) (*tcp.Config, error) {
+	cfg := &tcp.Config{}
+	if properties.Port != 0 {
+		cfg.Addr = fmt.Sprintf("%s:%d", properties.Bind, properties.Port)
+	}
+	if properties.TLSPort != 0 {
+		certs, err := tcp.LoadCertificates(tcp.MakeTLSConfig(properties))
+		if err != nil {
+			return nil, err
+		}
+		cfg.TLSAddr = fmt.Sprintf("%s:%d", properties.Bind, properties.TLSPort)
+		cfg.TLS = certs
+	}
+	if properties.UnixSocket != "" {
+		cfg.UnixSocket = properties.UnixSocket
+		if properties.UnixSocketPerm != "" {
+			perm, err := strconv.ParseUint(properties.UnixSocketPerm, 8, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid unixsocketperm %q", properties.UnixSocketPerm)
+			}
+			cfg.UnixSocketPerm = os.FileMode(perm)
+		}
+	}
+	if properties.HTTPPort != 0 {
+		cfg.HTTPAddr = fmt.Sprintf("%s:%d", properties.Bind, properties.HTTPPort)
+	}
+	return cfg, nil
 }
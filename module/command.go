@@ -0,0 +1,63 @@
+package module
+
+import (
+	"go-redis/database"
+	databaseInterface "go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+	"strings"
+)
+
+// init registers module command.
+func init() {
+	database.RegisterSysCommand("MODULE", execModule, -2)
+}
+
+// execModule executes the module commands.
+// MODULE LOAD path [arg ...]
+// MODULE UNLOAD name
+// MODULE LIST
+func execModule(_ *resp.Connection, args databaseInterface.CommandLine) resp.Reply {
+	subCommand := strings.ToLower(string(args[0]))
+	switch subCommand {
+	case "load":
+		if len(args) < 2 {
+			return reply.MakeArgsNumErrorReply("module|load")
+		}
+		moduleArgs := make([]string, 0, len(args)-2)
+		for _, arg := range args[2:] {
+			moduleArgs = append(moduleArgs, string(arg))
+		}
+		if _, err := Load(string(args[1]), moduleArgs); err != nil {
+			return reply.MakeStandardErrorReply("ERR Error loading the extension: " + err.Error())
+		}
+		return reply.MakeOkReply()
+	case "unload":
+		if len(args) != 2 {
+			return reply.MakeArgsNumErrorReply("module|unload")
+		}
+		if err := Unload(string(args[1])); err != nil {
+			return reply.MakeStandardErrorReply("ERR Error unloading module: " + err.Error())
+		}
+		return reply.MakeOkReply()
+	case "list":
+		if len(args) != 1 {
+			return reply.MakeArgsNumErrorReply("module|list")
+		}
+		loaded := List()
+		result := make([]resp.Reply, len(loaded))
+		for i, module := range loaded {
+			moduleArgs := make([][]byte, len(module.Args))
+			for j, arg := range module.Args {
+				moduleArgs[j] = []byte(arg)
+			}
+			result[i] = reply.MakeMapReply().
+				Add(reply.MakeBulkReply([]byte("name")), reply.MakeBulkReply([]byte(module.Name))).
+				Add(reply.MakeBulkReply([]byte("ver")), reply.MakeIntReply(int64(module.Version))).
+				Add(reply.MakeBulkReply([]byte("path")), reply.MakeBulkReply([]byte(module.Path))).
+				Add(reply.MakeBulkReply([]byte("args")), reply.MakeMultiBulkReply(moduleArgs))
+		}
+		return reply.MakeMultiRawReply(result)
+	}
+	return reply.MakeStandardErrorReply("ERR unknown subcommand '" + subCommand + "'. Try MODULE HELP.")
+}
@@ -0,0 +1,89 @@
+package module
+
+import (
+	"fmt"
+	"go-redis/aof"
+	"go-redis/database"
+	"reflect"
+	"strings"
+)
+
+// Context is handed to the OnLoad hook of a module.
+// Registrations only take effect once the hook returns without error and nothing it declared conflicts.
+type Context struct {
+	module    *Module
+	commands  []*commandSpec
+	dataTypes []*dataTypeSpec
+}
+
+type commandSpec struct {
+	name     string
+	executor database.ExecFunc
+	prepare  database.PrepareFunc
+	arity    int
+}
+
+type dataTypeSpec struct {
+	name    string
+	sample  interface{}
+	marshal aof.MarshalFunc
+}
+
+// SetName sets the name and version of the module, the file name is used by default
+func (ctx *Context) SetName(name string, version int) {
+	ctx.module.Name = name
+	ctx.module.Version = version
+}
+
+// Args returns the arguments given after the module path
+func (ctx *Context) Args() []string {
+	return ctx.module.Args
+}
+
+// RegisterCommand declares a command, the arguments are the same as database.RegisterCommand.
+// prepare is required: the keys it returns are locked, and the written ones are invalidated for the tracking clients.
+func (ctx *Context) RegisterCommand(name string, executor database.ExecFunc, prepare database.PrepareFunc, arity int) {
+	ctx.commands = append(ctx.commands, &commandSpec{name: name, executor: executor, prepare: prepare, arity: arity})
+}
+
+// RegisterDataType declares a data type, values of the same go type as sample are rewritten into the aof by marshal
+func (ctx *Context) RegisterDataType(name string, sample interface{}, marshal aof.MarshalFunc) {
+	ctx.dataTypes = append(ctx.dataTypes, &dataTypeSpec{name: name, sample: sample, marshal: marshal})
+}
+
+// validate checks what the hook declared, the caller must hold modulesLock
+func (ctx *Context) validate() error {
+	module := ctx.module
+	if _, exists := modules[strings.ToLower(module.Name)]; exists {
+		return fmt.Errorf("module %s is already loaded", module.Name)
+	}
+	commands := make(map[string]struct{}, len(ctx.commands))
+	for _, spec := range ctx.commands {
+		name := strings.ToLower(spec.name)
+		if _, duplicated := commands[name]; duplicated {
+			return fmt.Errorf("command %s is declared twice by module %s", spec.name, module.Name)
+		}
+		commands[name] = struct{}{}
+		if spec.prepare == nil {
+			return fmt.Errorf("command %s of module %s does not declare its keys", spec.name, module.Name)
+		}
+		if database.HasCommand(spec.name) {
+			return fmt.Errorf("command %s of module %s conflicts with an existing command", spec.name, module.Name)
+		}
+	}
+	dataTypes := make(map[string]struct{}, len(ctx.dataTypes))
+	goTypes := make(map[reflect.Type]struct{}, len(ctx.dataTypes))
+	for _, spec := range ctx.dataTypes {
+		name, goType := strings.ToLower(spec.name), reflect.TypeOf(spec.sample)
+		_, duplicatedName := dataTypes[name]
+		_, duplicatedType := goTypes[goType]
+		if duplicatedName || duplicatedType {
+			return fmt.Errorf("data type %s is declared twice by module %s", spec.name, module.Name)
+		}
+		dataTypes[name], goTypes[goType] = struct{}{}, struct{}{}
+		if aof.HasDataType(spec.name, spec.sample) {
+			return fmt.Errorf("data type %s of module %s conflicts with an existing data type", spec.name, module.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"go-redis/aof"
+	"go-redis/database"
+	"go-redis/lib/logger"
+	"path/filepath"
+	"plugin"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	onLoadSymbol   = "OnLoad"   // the hook every module must export: func(*module.Context) error
+	onUnloadSymbol = "OnUnload" // the optional hook called before unloading: func() error
+)
+
+// Module is a go plugin loaded into the server
+type Module struct {
+	Name    string
+	Version int
+	Path    string
+	Args    []string
+
+	commands  []string
+	dataTypes []*aof.DataType
+	onUnload  func() error
+}
+
+var (
+	modules     = make(map[string]*Module)
+	modulesLock sync.Mutex
+)
+
+// Load opens the go plugin at path, runs its OnLoad hook and registers what the hook declared.
+// A plugin loaded already is refused before its hook runs. Nothing is registered if a command or a data type
+// of the module conflicts with an existing one, or with another one of the module, and OnUnload undoes the hook.
+func Load(path string, args []string) (*Module, error) {
+	modulesLock.Lock()
+	defer modulesLock.Unlock()
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	for _, module := range modules {
+		if module.Path == path || strings.EqualFold(module.Name, name) {
+			return nil, fmt.Errorf("module %s is already loaded", module.Name)
+		}
+	}
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	symbol, err := p.Lookup(onLoadSymbol)
+	if err != nil {
+		return nil, err
+	}
+	onLoad, ok := symbol.(func(*Context) error)
+	if !ok {
+		return nil, fmt.Errorf("%s of %s should be func(*module.Context) error", onLoadSymbol, path)
+	}
+	var onUnload func() error
+	if symbol, err = p.Lookup(onUnloadSymbol); err == nil {
+		onUnload, _ = symbol.(func() error)
+	}
+
+	ctx := &Context{
+		module: &Module{
+			Name:     name,
+			Path:     path,
+			Args:     args,
+			onUnload: onUnload,
+		},
+	}
+	if err = onLoad(ctx); err != nil {
+		return nil, err
+	}
+	module := ctx.module
+	if err = ctx.validate(); err != nil {
+		if onUnload != nil {
+			if unloadErr := onUnload(); unloadErr != nil {
+				logger.Error("Module", module.Name, "failed to unload:", unloadErr)
+			}
+		}
+		return nil, err
+	}
+
+	for _, spec := range ctx.commands {
+		database.RegisterCommand(spec.name, spec.executor, spec.prepare, spec.arity)
+		module.commands = append(module.commands, spec.name)
+	}
+	for _, spec := range ctx.dataTypes {
+		module.dataTypes = append(module.dataTypes, aof.RegisterDataType(spec.name, spec.sample, spec.marshal))
+	}
+	modules[strings.ToLower(module.Name)] = module
+	logger.Info("Module loaded:", module.Name, "from", path)
+	return module, nil
+}
+
+// Unload removes the commands of a module. Go can not unmap a plugin, so its code stays in memory.
+// Modules exporting data types are never unloaded because keys may still hold their values.
+func Unload(name string) error {
+	modulesLock.Lock()
+	defer modulesLock.Unlock()
+
+	module, ok := modules[strings.ToLower(name)]
+	if !ok {
+		return errors.New("no such module with that name")
+	}
+	if len(module.dataTypes) > 0 {
+		return errors.New("the module exports one or more module-side data types, can't unload")
+	}
+	if module.onUnload != nil {
+		if err := module.onUnload(); err != nil {
+			return err
+		}
+	}
+	for _, name := range module.commands {
+		database.UnregisterCommand(name)
+	}
+	delete(modules, strings.ToLower(module.Name))
+	logger.Info("Module unloaded:", module.Name)
+	return nil
+}
+
+// List returns the loaded modules sorted by name
+func List() []*Module {
+	modulesLock.Lock()
+	defer modulesLock.Unlock()
+
+	result := make([]*Module, 0, len(modules))
+	for _, module := range modules {
+		result = append(result, module)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// IsModuleCommand returns true if name is a command of a loaded module
+func IsModuleCommand(name string) bool {
+	modulesLock.Lock()
+	defer modulesLock.Unlock()
+
+	for _, module := range modules {
+		for _, command := range module.commands {
+			if strings.EqualFold(command, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LoadModules loads the modules of the loadmodule directives, each one is "path [arg ...]"
+func LoadModules(directives []string) {
+	for _, directive := range directives {
+		fields := strings.Fields(directive)
+		if len(fields) == 0 {
+			continue
+		}
+		if _, err := Load(fields[0], fields[1:]); err != nil {
+			logger.Error("Module", fields[0], "failed to load:", err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package pubsub
+
+import (
+	"go-redis/interface/resp"
+	"go-redis/lib/wildcard"
+	"sync"
+)
+
+// channelTable maps a channel to its subscribed connections
+type channelTable map[string]map[resp.Connection]struct{}
+
+// add adds the client to the subscribers of channel
+func (table channelTable) add(client resp.Connection, channel string) {
+	clients, ok := table[channel]
+	if !ok {
+		clients = make(map[resp.Connection]struct{})
+		table[channel] = clients
+	}
+	clients[client] = struct{}{}
+}
+
+// remove removes the client from the subscribers of channel, the channel is dropped once it is empty
+func (table channelTable) remove(client resp.Connection, channel string) {
+	clients, ok := table[channel]
+	if !ok {
+		return
+	}
+	delete(clients, client)
+	if len(clients) == 0 {
+		delete(table, channel)
+	}
+}
+
+// snapshot returns a copy of the subscribers of channel
+func (table channelTable) snapshot(channel string) []resp.Connection {
+	clients := table[channel]
+	result := make([]resp.Connection, 0, len(clients))
+	for client := range clients {
+		result = append(result, client)
+	}
+	return result
+}
+
+// Hub stores the subscribers of every channel, pattern and shard channel
+type Hub struct {
+	subscribers      channelTable // channel -> subscribed connections
+	shardSubscribers channelTable // shard channel -> subscribed connections
+	patterns         *patternIndex
+	lock             sync.RWMutex
+}
+
+// MakeHub returns a new instance of Hub
+func MakeHub() *Hub {
+	return &Hub{
+		subscribers:      make(channelTable),
+		shardSubscribers: make(channelTable),
+		patterns:         makePatternIndex(),
+	}
+}
+
+// subscribe adds the client to the subscribers of channel
+func (hub *Hub) subscribe(client resp.Connection, channel string) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	hub.subscribers.add(client, channel)
+}
+
+// unsubscribe removes the client from the subscribers of channel
+func (hub *Hub) unsubscribe(client resp.Connection, channel string) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	hub.subscribers.remove(client, channel)
+}
+
+// getSubscribers returns a snapshot of the subscribers of channel, so messages are written without holding the lock
+func (hub *Hub) getSubscribers(channel string) []resp.Connection {
+	hub.lock.RLock()
+	defer hub.lock.RUnlock()
+	return hub.subscribers.snapshot(channel)
+}
+
+// ssubscribe adds the client to the subscribers of shard channel
+func (hub *Hub) ssubscribe(client resp.Connection, channel string) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	hub.shardSubscribers.add(client, channel)
+}
+
+// sunsubscribe removes the client from the subscribers of shard channel
+func (hub *Hub) sunsubscribe(client resp.Connection, channel string) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	hub.shardSubscribers.remove(client, channel)
+}
+
+// getShardSubscribers returns a snapshot of the subscribers of shard channel
+func (hub *Hub) getShardSubscribers(channel string) []resp.Connection {
+	hub.lock.RLock()
+	defer hub.lock.RUnlock()
+	return hub.shardSubscribers.snapshot(channel)
+}
+
+// getShardChannels returns the shard channels having at least one subscriber
+func (hub *Hub) getShardChannels() []string {
+	hub.lock.RLock()
+	defer hub.lock.RUnlock()
+	channels := make([]string, 0, len(hub.shardSubscribers))
+	for channel := range hub.shardSubscribers {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// psubscribe adds the client to the subscribers of the compiled pattern
+func (hub *Hub) psubscribe(client resp.Connection, source string, pattern *wildcard.Pattern) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	hub.patterns.add(client, source, pattern)
+}
+
+// punsubscribe removes the client from the subscribers of pattern
+func (hub *Hub) punsubscribe(client resp.Connection, source string) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	hub.patterns.remove(client, source)
+}
+
+// getPatternSubscribers returns a snapshot of the clients subscribed to patterns matching channel
+func (hub *Hub) getPatternSubscribers(channel string) []patternMatch {
+	hub.lock.RLock()
+	defer hub.lock.RUnlock()
+	return hub.patterns.match(channel)
+}
+
+// getChannels returns the channels having at least one subscriber
+func (hub *Hub) getChannels() []string {
+	hub.lock.RLock()
+	defer hub.lock.RUnlock()
+	channels := make([]string, 0, len(hub.subscribers))
+	for channel := range hub.subscribers {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// countSubscribers returns the number of clients subscribed to channel, pattern subscribers excluded
+func (hub *Hub) countSubscribers(channel string) int {
+	hub.lock.RLock()
+	defer hub.lock.RUnlock()
+	return len(hub.subscribers[channel])
+}
+
+// countShardSubscribers returns the number of clients subscribed to shard channel
+func (hub *Hub) countShardSubscribers(channel string) int {
+	hub.lock.RLock()
+	defer hub.lock.RUnlock()
+	return len(hub.shardSubscribers[channel])
+}
+
+// countPatterns returns the number of distinct patterns subscribed by any client
+func (hub *Hub) countPatterns() int {
+	hub.lock.RLock()
+	defer hub.lock.RUnlock()
+	return len(hub.patterns.patterns)
+}
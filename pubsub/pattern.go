@@ -0,0 +1,96 @@
+package pubsub
+
+import (
+	"go-redis/interface/resp"
+	"go-redis/lib/wildcard"
+)
+
+// patternEntry is a compiled pattern and the clients subscribed to it
+type patternEntry struct {
+	source  string
+	pattern *wildcard.Pattern
+	clients map[resp.Connection]struct{}
+}
+
+// patternIndex groups the patterns by their literal prefix.
+// A channel can only match the patterns whose prefix is one of its own prefixes,
+// so PUBLISH looks up len(channel)+1 buckets instead of trying every pattern.
+type patternIndex struct {
+	patterns    map[string]*patternEntry            // pattern -> entry
+	buckets     map[string]map[string]*patternEntry // literal prefix -> pattern -> entry
+	prefixCount map[int]int                         // prefix length -> number of buckets, skips empty lengths
+}
+
+// patternMatch is a client that should receive a message through pattern
+type patternMatch struct {
+	client  resp.Connection
+	pattern string
+}
+
+func makePatternIndex() *patternIndex {
+	return &patternIndex{
+		patterns:    make(map[string]*patternEntry),
+		buckets:     make(map[string]map[string]*patternEntry),
+		prefixCount: make(map[int]int),
+	}
+}
+
+// add subscribes the client to the compiled pattern
+func (index *patternIndex) add(client resp.Connection, source string, pattern *wildcard.Pattern) {
+	entry, ok := index.patterns[source]
+	if !ok {
+		entry = &patternEntry{source: source, pattern: pattern, clients: make(map[resp.Connection]struct{})}
+		index.patterns[source] = entry
+		prefix := wildcard.LiteralPrefix(source)
+		bucket, ok := index.buckets[prefix]
+		if !ok {
+			bucket = make(map[string]*patternEntry)
+			index.buckets[prefix] = bucket
+			index.prefixCount[len(prefix)]++
+		}
+		bucket[source] = entry
+	}
+	entry.clients[client] = struct{}{}
+}
+
+// remove unsubscribes the client from the pattern, unused patterns and buckets are dropped
+func (index *patternIndex) remove(client resp.Connection, source string) {
+	entry, ok := index.patterns[source]
+	if !ok {
+		return
+	}
+	delete(entry.clients, client)
+	if len(entry.clients) > 0 {
+		return
+	}
+	delete(index.patterns, source)
+	prefix := wildcard.LiteralPrefix(source)
+	bucket := index.buckets[prefix]
+	delete(bucket, source)
+	if len(bucket) == 0 {
+		delete(index.buckets, prefix)
+		index.prefixCount[len(prefix)]--
+		if index.prefixCount[len(prefix)] == 0 {
+			delete(index.prefixCount, len(prefix))
+		}
+	}
+}
+
+// match returns every client subscribed to a pattern matching channel
+func (index *patternIndex) match(channel string) []patternMatch {
+	var result []patternMatch
+	for length := 0; length <= len(channel); length++ {
+		if index.prefixCount[length] == 0 {
+			continue
+		}
+		for _, entry := range index.buckets[channel[:length]] {
+			if !entry.pattern.IsMatch(channel) {
+				continue
+			}
+			for client := range entry.clients {
+				result = append(result, patternMatch{client: client, pattern: entry.source})
+			}
+		}
+	}
+	return result
+}
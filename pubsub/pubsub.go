@@ -0,0 +1,368 @@
+package pubsub
+
+import (
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/wildcard"
+	"go-redis/resp/reply"
+	"strings"
+)
+
+var (
+	messageBytes      = []byte("message")
+	pmessageBytes     = []byte("pmessage")
+	subscribeBytes    = []byte("subscribe")
+	unsubscribeBytes  = []byte("unsubscribe")
+	psubscribeBytes   = []byte("psubscribe")
+	punsubscribeBytes = []byte("punsubscribe")
+	smessageBytes     = []byte("smessage")
+	ssubscribeBytes   = []byte("ssubscribe")
+	sunsubscribeBytes = []byte("sunsubscribe")
+	pongBytes         = []byte("pong")
+)
+
+// allowedInSubscribeMode lists the commands a client may send while it is subscribed
+var allowedInSubscribeMode = map[string]struct{}{
+	"subscribe":    {},
+	"unsubscribe":  {},
+	"psubscribe":   {},
+	"punsubscribe": {},
+	"ssubscribe":   {},
+	"sunsubscribe": {},
+	"ping":         {},
+	"quit":         {},
+	"reset":        {},
+}
+
+// InSubscribeMode returns true if a RESP2 client is subscribed to any channel, pattern or shard channel,
+// RESP3 clients receive pushes out of band and may keep sending any command
+func InSubscribeMode(client resp.Connection) bool {
+	if client.GetProtocol() >= reply.Resp3 {
+		return false
+	}
+	return client.SubsCount() > 0 || client.ShardSubsCount() > 0
+}
+
+// IsAllowedInSubscribeMode returns true if the command can be executed by a subscribed client
+func IsAllowedInSubscribeMode(commandName string) bool {
+	_, ok := allowedInSubscribeMode[strings.ToLower(commandName)]
+	return ok
+}
+
+// MakeSubscribeModeErrorReply returns the error replied to a subscribed client sending other commands
+func MakeSubscribeModeErrorReply(commandName string) resp.Reply {
+	return reply.MakeStandardErrorReply("ERR Can't execute '" + strings.ToLower(commandName) +
+		"': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context")
+}
+
+// makeAckReply returns the confirmation of a (un)subscribe, which carries the remaining subscription count
+func makeAckReply(kind []byte, channel []byte, count int) resp.Reply {
+	return reply.MakePushReply([]resp.Reply{
+		reply.MakeBulkReply(kind),
+		reply.MakeBulkReply(channel),
+		reply.MakeIntReply(int64(count)),
+	})
+}
+
+// writePush writes a push reply in the protocol of the client
+func writePush(client resp.Connection, push resp.Reply) error {
+	return client.Write(reply.Encode(push, client.GetProtocol()))
+}
+
+// encodedPush encodes a push reply sent to many clients once per protocol
+type encodedPush struct {
+	push  resp.Reply
+	resp2 []byte
+	resp3 []byte
+}
+
+// bytesFor returns the bytes of the push reply in the given protocol
+func (e *encodedPush) bytesFor(protocol int) []byte {
+	if protocol >= reply.Resp3 {
+		if e.resp3 == nil {
+			e.resp3 = reply.Encode(e.push, reply.Resp3)
+		}
+		return e.resp3
+	}
+	if e.resp2 == nil {
+		e.resp2 = e.push.ToBytes()
+	}
+	return e.resp2
+}
+
+// makeMessageReply returns the message pushed to the subscribers of channel
+func makeMessageReply(channel []byte, message []byte) *encodedPush {
+	return &encodedPush{push: makePush(messageBytes, channel, message)}
+}
+
+// makePatternMessageReply returns the message pushed to the subscribers of a pattern matching channel
+func makePatternMessageReply(pattern string, channel []byte, message []byte) resp.Reply {
+	return makePush(pmessageBytes, []byte(pattern), channel, message)
+}
+
+// makePush returns a push reply of bulk strings
+func makePush(items ...[]byte) resp.Reply {
+	replies := make([]resp.Reply, len(items))
+	for i, item := range items {
+		replies[i] = reply.MakeBulkReply(item)
+	}
+	return reply.MakePushReply(replies)
+}
+
+// Subscribe puts the client into subscribe mode and listens to the channels.
+// SUBSCRIBE channel [channel ...]
+func (hub *Hub) Subscribe(client resp.Connection, args database.CommandLine) resp.Reply {
+	for _, arg := range args {
+		channel := string(arg)
+		client.Subscribe(channel)
+		// acknowledge before joining the hub, so no message can overtake the confirmation
+		_ = writePush(client, makeAckReply(subscribeBytes, arg, client.SubsCount()))
+		hub.subscribe(client, channel)
+	}
+	return reply.MakeNoReply()
+}
+
+// UnSubscribe stops listening to the channels, or to every channel if none is given.
+// UNSUBSCRIBE [channel [channel ...]]
+func (hub *Hub) UnSubscribe(client resp.Connection, args database.CommandLine) resp.Reply {
+	var channels []string
+	if len(args) > 0 {
+		channels = make([]string, len(args))
+		for i, arg := range args {
+			channels[i] = string(arg)
+		}
+	} else {
+		channels = client.GetChannels()
+	}
+	if len(channels) == 0 {
+		return makeEmptyAckReply(unsubscribeBytes, client.SubsCount())
+	}
+	for _, channel := range channels {
+		hub.unsubscribe(client, channel)
+		client.UnSubscribe(channel)
+		_ = writePush(client, makeAckReply(unsubscribeBytes, []byte(channel), client.SubsCount()))
+	}
+	return reply.MakeNoReply()
+}
+
+// makeEmptyAckReply is the confirmation of an unsubscribe from nothing, redis still acknowledges with a null channel
+func makeEmptyAckReply(kind []byte, count int) resp.Reply {
+	return reply.MakePushReply([]resp.Reply{
+		reply.MakeBulkReply(kind),
+		reply.MakeNullBulkReply(),
+		reply.MakeIntReply(int64(count)),
+	})
+}
+
+// PSubscribe puts the client into subscribe mode and listens to the channels matching the patterns.
+// PSUBSCRIBE pattern [pattern ...]
+func (hub *Hub) PSubscribe(client resp.Connection, args database.CommandLine) resp.Reply {
+	patterns := make([]*wildcard.Pattern, len(args))
+	for i, arg := range args {
+		pattern, err := wildcard.CompilePattern(string(arg))
+		if err != nil {
+			return reply.MakeStandardErrorReply("ERR invalid pattern '" + string(arg) + "': " + err.Error())
+		}
+		patterns[i] = pattern
+	}
+	for i, arg := range args {
+		source := string(arg)
+		client.PSubscribe(source)
+		_ = writePush(client, makeAckReply(psubscribeBytes, arg, client.SubsCount()))
+		hub.psubscribe(client, source, patterns[i])
+	}
+	return reply.MakeNoReply()
+}
+
+// PUnSubscribe stops listening to the patterns, or to every pattern if none is given.
+// PUNSUBSCRIBE [pattern [pattern ...]]
+func (hub *Hub) PUnSubscribe(client resp.Connection, args database.CommandLine) resp.Reply {
+	var patterns []string
+	if len(args) > 0 {
+		patterns = make([]string, len(args))
+		for i, arg := range args {
+			patterns[i] = string(arg)
+		}
+	} else {
+		patterns = client.GetPatterns()
+	}
+	if len(patterns) == 0 {
+		return makeEmptyAckReply(punsubscribeBytes, client.SubsCount())
+	}
+	for _, pattern := range patterns {
+		hub.punsubscribe(client, pattern)
+		client.PUnSubscribe(pattern)
+		_ = writePush(client, makeAckReply(punsubscribeBytes, []byte(pattern), client.SubsCount()))
+	}
+	return reply.MakeNoReply()
+}
+
+// SSubscribe puts the client into subscribe mode and listens to the shard channels.
+// SSUBSCRIBE shardchannel [shardchannel ...]
+func (hub *Hub) SSubscribe(client resp.Connection, args database.CommandLine) resp.Reply {
+	for _, arg := range args {
+		channel := string(arg)
+		client.SSubscribe(channel)
+		_ = writePush(client, makeAckReply(ssubscribeBytes, arg, client.ShardSubsCount()))
+		hub.ssubscribe(client, channel)
+	}
+	return reply.MakeNoReply()
+}
+
+// SUnSubscribe stops listening to the shard channels, or to every shard channel if none is given.
+// SUNSUBSCRIBE [shardchannel [shardchannel ...]]
+func (hub *Hub) SUnSubscribe(client resp.Connection, args database.CommandLine) resp.Reply {
+	var channels []string
+	if len(args) > 0 {
+		channels = make([]string, len(args))
+		for i, arg := range args {
+			channels[i] = string(arg)
+		}
+	} else {
+		channels = client.GetShardChannels()
+	}
+	if len(channels) == 0 {
+		return makeEmptyAckReply(sunsubscribeBytes, client.ShardSubsCount())
+	}
+	for _, channel := range channels {
+		hub.sunsubscribe(client, channel)
+		client.SUnSubscribe(channel)
+		_ = writePush(client, makeAckReply(sunsubscribeBytes, []byte(channel), client.ShardSubsCount()))
+	}
+	return reply.MakeNoReply()
+}
+
+// EvictShardChannels unsubscribes every client from the shard channels this node no longer owns.
+// The clients receive a sunsubscribe, so they can subscribe again on the new owner.
+func (hub *Hub) EvictShardChannels(isOwned func(channel string) bool) {
+	for _, channel := range hub.getShardChannels() {
+		if isOwned(channel) {
+			continue
+		}
+		for _, client := range hub.getShardSubscribers(channel) {
+			hub.sunsubscribe(client, channel)
+			client.SUnSubscribe(channel)
+			_ = writePush(client, makeAckReply(sunsubscribeBytes, []byte(channel), client.ShardSubsCount()))
+		}
+	}
+}
+
+// UnsubscribeAll removes the client from every channel and pattern, it is called when the client is closed
+func (hub *Hub) UnsubscribeAll(client resp.Connection) {
+	for _, channel := range client.GetChannels() {
+		hub.unsubscribe(client, channel)
+		client.UnSubscribe(channel)
+	}
+	for _, pattern := range client.GetPatterns() {
+		hub.punsubscribe(client, pattern)
+		client.PUnSubscribe(pattern)
+	}
+	for _, channel := range client.GetShardChannels() {
+		hub.sunsubscribe(client, channel)
+		client.SUnSubscribe(channel)
+	}
+}
+
+// Publish sends the message to the subscribers of channel and returns how many clients received it.
+// PUBLISH channel message
+func (hub *Hub) Publish(args database.CommandLine) resp.Reply {
+	if len(args) != 2 {
+		return reply.MakeArgsNumErrorReply("publish")
+	}
+	channel := string(args[0])
+	payload := makeMessageReply(args[0], args[1])
+	var receivers int64
+	for _, client := range hub.getSubscribers(channel) {
+		if err := client.Write(payload.bytesFor(client.GetProtocol())); err == nil {
+			receivers++
+		}
+	}
+	// a client subscribed through several matching patterns receives one message per pattern
+	for _, match := range hub.getPatternSubscribers(channel) {
+		if err := writePush(match.client, makePatternMessageReply(match.pattern, args[0], args[1])); err == nil {
+			receivers++
+		}
+	}
+	return reply.MakeIntReply(receivers)
+}
+
+// SPublish sends the message to the subscribers of shard channel and returns how many clients received it.
+// SPUBLISH shardchannel message
+func (hub *Hub) SPublish(args database.CommandLine) resp.Reply {
+	if len(args) != 2 {
+		return reply.MakeArgsNumErrorReply("spublish")
+	}
+	payload := &encodedPush{push: makePush(smessageBytes, args[0], args[1])}
+	var receivers int64
+	for _, client := range hub.getShardSubscribers(string(args[0])) {
+		if err := client.Write(payload.bytesFor(client.GetProtocol())); err == nil {
+			receivers++
+		}
+	}
+	return reply.MakeIntReply(receivers)
+}
+
+// Ping replies a subscribed client with a pong array instead of a status.
+// PING [message]
+func Ping(args database.CommandLine) resp.Reply {
+	message := []byte{}
+	if len(args) > 0 {
+		message = args[0]
+	}
+	return reply.MakeMultiBulkReply([][]byte{pongBytes, message})
+}
+
+// PubSub answers the introspection sub commands.
+// PUBSUB CHANNELS [pattern]
+// PUBSUB NUMSUB [channel [channel ...]]
+// PUBSUB NUMPAT
+// PUBSUB SHARDCHANNELS [pattern]
+// PUBSUB SHARDNUMSUB [shardchannel [shardchannel ...]]
+func (hub *Hub) PubSub(args database.CommandLine) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgsNumErrorReply("pubsub")
+	}
+	subCommand := strings.ToLower(string(args[0]))
+	switch subCommand {
+	case "channels", "shardchannels":
+		if len(args) > 2 {
+			return reply.MakeArgsNumErrorReply("pubsub|" + subCommand)
+		}
+		var pattern *wildcard.Pattern
+		if len(args) == 2 {
+			var err error
+			if pattern, err = wildcard.CompilePattern(string(args[1])); err != nil {
+				return reply.MakeStandardErrorReply("ERR invalid pattern '" + string(args[1]) + "': " + err.Error())
+			}
+		}
+		channels := hub.getChannels()
+		if subCommand == "shardchannels" {
+			channels = hub.getShardChannels()
+		}
+		result := make([][]byte, 0, len(channels))
+		for _, channel := range channels {
+			if pattern == nil || pattern.IsMatch(channel) {
+				result = append(result, []byte(channel))
+			}
+		}
+		return reply.MakeMultiBulkReply(result)
+	case "numsub", "shardnumsub":
+		countFunc := hub.countSubscribers
+		if subCommand == "shardnumsub" {
+			countFunc = hub.countShardSubscribers
+		}
+		result := make([]resp.Reply, 0, 2*(len(args)-1))
+		for _, channel := range args[1:] {
+			result = append(result,
+				reply.MakeBulkReply(channel),
+				reply.MakeIntReply(int64(countFunc(string(channel)))))
+		}
+		return reply.MakeMultiRawReply(result)
+	case "numpat":
+		if len(args) != 1 {
+			return reply.MakeArgsNumErrorReply("pubsub|numpat")
+		}
+		return reply.MakeIntReply(int64(hub.countPatterns()))
+	}
+	return reply.MakeStandardErrorReply("ERR unknown subcommand '" + subCommand + "'. Try PUBSUB HELP.")
+}
@@ -1,218 +1,171 @@
 package client
 
 import (
+	"context"
 	"errors"
-	"go-redis/interface/resp"
-	"go-redis/lib/logger"
-	"go-redis/lib/sync/wait"
-	"go-redis/resp/parser"
-	"go-redis/resp/reply"
+	"io"
 	"net"
-	"runtime/debug"
-	"sync"
 	"time"
 )
 
-const (
-	chanSize = 256
-	maxWait  = 3 * time.Second
-)
-
-// Client is a pipeline mode redis client
+// Client is a redis client backed by a pool of connections, it is safe for concurrent use.
+// A command whose connection could not be dialed is retried after a growing backoff.
+// A command failed by a network error once written is not sent again, the server may have executed it,
+// so the idle connections the server closed are dropped before they are reused.
 type Client struct {
-	connection  net.Conn
-	pendingReqs chan *request // wait to send
-	waitingReqs chan *request // waiting response
-	ticker      *time.Ticker
-	address     string
+	cmdable
+	opts *Options
+	pool *connPool
+}
 
-	onceClose sync.Once       // prevent closing multiple times
-	working   *sync.WaitGroup // its counter presents unfinished requests(pending and waiting)
+// NewClient returns a client of the server described by opts, the connections are dialed when the commands need them
+func NewClient(opts *Options) *Client {
+	copied := *opts
+	copied.init()
+	client := &Client{
+		opts: &copied,
+		pool: makeConnPool(&copied),
+	}
+	client.cmdable = client.Process
+	return client
 }
 
-// request is a message sends to redis server
-type request struct {
-	id        uint64
-	args      [][]byte
-	reply     resp.Reply
-	heartbeat bool
-	waiting   *wait.Wait
-	err       error
+// Options returns the options of the client with the defaults filled in
+func (client *Client) Options() *Options {
+	return client.opts
 }
 
-// MakeClient creates a new client
-func MakeClient(address string) (*Client, error) {
-	connection, err := net.Dial("tcp", address)
-	if err != nil {
-		return nil, err
-	}
-	logger.Info("Connect to peer node: " + address)
-	return &Client{
-		address:     address,
-		connection:  connection,
-		pendingReqs: make(chan *request, chanSize),
-		waitingReqs: make(chan *request, chanSize),
-		working:     &sync.WaitGroup{},
-	}, nil
-}
-
-// Start starts asynchronous goroutines
-func (client *Client) Start() {
-	client.ticker = time.NewTicker(10 * time.Second)
-	go client.handleWrite()
-	go func() {
-		err := client.handleRead()
-		if err != nil {
-			logger.Error(err)
-		}
-	}()
-	go client.heartbeat()
+// Process executes cmd and returns its error
+func (client *Client) Process(ctx context.Context, cmd Cmder) error {
+	_ = client.processCommands(ctx, []Cmder{cmd}, false)
+	return cmd.Err()
 }
 
-// handleWrite sends requests
-func (client *Client) handleWrite() {
-	for req := range client.pendingReqs {
-		client.doRequest(req)
-	}
+// Pipeline returns a pipeline sending its commands in one round trip
+func (client *Client) Pipeline() *Pipeline {
+	return makePipeline(func(ctx context.Context, cmds []Cmder) error {
+		return client.processCommands(ctx, cmds, false)
+	})
 }
 
-// doRequest sends a request and handles errors
-func (client *Client) doRequest(req *request) {
-	if req == nil || len(req.args) == 0 {
-		return
-	}
-	re := reply.MakeMultiBulkReply(req.args)
-	bytes := re.ToBytes()
-	_, err := client.connection.Write(bytes)
-	i := 0
-	for err != nil && i < 3 {
-		err = client.handleConnectionError(err)
-		if err == nil {
-			_, err = client.connection.Write(bytes)
-		}
-		i++
-	}
-	if err == nil {
-		client.waitingReqs <- req // block waiting
-	} else {
-		req.err = err
-		req.waiting.Done()
-	}
+// Pipelined queues the commands of fn in a pipeline and executes them
+func (client *Client) Pipelined(ctx context.Context, fn func(*Pipeline) error) ([]Cmder, error) {
+	return client.Pipeline().Pipelined(ctx, fn)
+}
+
+// TxPipeline returns a pipeline wrapping its commands in MULTI and EXEC
+func (client *Client) TxPipeline() *Pipeline {
+	return makePipeline(func(ctx context.Context, cmds []Cmder) error {
+		return client.processCommands(ctx, cmds, true)
+	})
 }
 
-// handleConnectionError handles connection error and reconnect
-func (client *Client) handleConnectionError(_ error) error {
-	err1 := client.connection.Close()
-	if err1 != nil {
-		var opErr *net.OpError
-		if errors.As(err1, &opErr) {
-			if opErr.Err.Error() != "use of closed network connection" {
-				return err1
+// TxPipelined queues the commands of fn in a transaction and executes it
+func (client *Client) TxPipelined(ctx context.Context, fn func(*Pipeline) error) ([]Cmder, error) {
+	return client.TxPipeline().Pipelined(ctx, fn)
+}
+
+// Conn returns a connection reserved for the caller until it is closed, e.g. to WATCH keys before a transaction
+func (client *Client) Conn() *Conn {
+	conn := &Conn{client: client}
+	conn.cmdable = conn.Process
+	return conn
+}
+
+// Close closes the idle connections, the ones in use are closed once their commands are done
+func (client *Client) Close() error {
+	return client.pool.close()
+}
+
+// processCommands executes cmds on one connection, as a transaction if tx is set.
+// It returns the first error of the commands.
+func (client *Client) processCommands(ctx context.Context, cmds []Cmder, tx bool) error {
+	var err error
+	for attempt := 0; attempt <= client.opts.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, client.opts.retryBackoff(attempt)); err != nil {
+				setCmdsErr(cmds, err)
+				return err
 			}
 		}
+		var cn *conn
+		cn, err = client.pool.get(ctx)
+		if err == nil {
+			err = client.roundTrip(ctx, cn, cmds, tx)
+			client.pool.put(cn)
+			break
+		}
+		if !shouldRetry(err) {
+			break
+		}
 	}
-	conn, err1 := net.Dial("tcp", client.address)
-	if err1 != nil {
-		logger.Error(err1)
-		return err1
+	if err != nil {
+		setCmdsErr(cmds, err)
+		return err
 	}
-	client.connection = conn
-	logger.Info("Connect to peer node: " + client.address)
-	go func() {
-		_ = client.handleRead()
-	}()
-	return nil
+	return firstCmdsErr(cmds)
 }
 
-// handleRead reads all responses from the connection
-func (client *Client) handleRead() error {
-	ch := parser.ParseStream(client.connection)
-	for payload := range ch {
-		if payload.Error != nil {
-			client.finishRequest(reply.MakeStandardErrorReply(payload.Error.Error()))
-			continue
+// roundTrip sends cmds and reads their replies, the database of the client is selected again if a command changed it
+func (client *Client) roundTrip(ctx context.Context, cn *conn, cmds []Cmder, tx bool) error {
+	if cn.db != client.opts.DB && (tx || len(cmds) == 0 || cmds[0].Name() != "select") {
+		selectCmd := NewStatusCmd("select", client.opts.DB)
+		if tx {
+			return txRoundTrip(ctx, cn, client.opts, []Cmder{selectCmd}, cmds)
 		}
-		client.finishRequest(payload.Data)
+		cmds = append([]Cmder{selectCmd}, cmds...)
 	}
-	return nil
-}
-
-// finishRequest receives a response
-func (client *Client) finishRequest(reply resp.Reply) {
-	defer func() {
-		if err := recover(); err != nil {
-			debug.PrintStack()
-			logger.Error(err)
-		}
-	}()
-	request := <-client.waitingReqs
-	if request == nil {
-		return
+	if tx {
+		return txRoundTrip(ctx, cn, client.opts, nil, cmds)
 	}
-	request.reply = reply
-	if request.waiting != nil {
-		request.waiting.Done()
+	if err := cn.writeCommands(ctx, client.opts.WriteTimeout, cmds); err != nil {
+		return err
 	}
+	return cn.readReplies(ctx, client.opts.ReadTimeout, cmds)
 }
 
-// heartbeat uses ticker to send a heartbeat request
-func (client *Client) heartbeat() {
-	for range client.ticker.C {
-		client.doHeartbeat()
+// sleep waits for d, or returns the error of ctx if it ends first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
-// doHeartbeat sends a heartbeat request
-func (client *Client) doHeartbeat() {
-	request := &request{
-		args:      [][]byte{[]byte("PING")},
-		heartbeat: true,
-		waiting:   &wait.Wait{},
+// shouldRetry returns true for the errors of a connection closed or reset, or of a dial which failed.
+// Timeouts are not retried, the server may just be slow.
+func shouldRetry(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
 	}
-	request.waiting.Add(1)
-	client.working.Add(1)
-	defer client.working.Done()
-	client.pendingReqs <- request
-	if timeout := request.waiting.WaitWithTimeout(maxWait); timeout {
-		logger.Warn("timeout from peer node: " + client.address)
-	} else {
-		logger.Info("PONG from peer node: " + client.address)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
 	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return !netErr.Timeout()
+	}
+	return false
 }
 
-// Send sends a request to redis server
-func (client *Client) Send(args [][]byte) resp.Reply {
-	request := &request{
-		args:      args,
-		heartbeat: false,
-		waiting:   &wait.Wait{},
-	}
-	request.waiting.Add(1)
-	client.working.Add(1)
-	defer client.working.Done()
-	// prevent sending when pendingReqs is closed
-	select {
-	case client.pendingReqs <- request:
-	default:
-		return reply.MakeStandardErrorReply("client is closed or no space available")
-	}
-	timeout := request.waiting.WaitWithTimeout(maxWait)
-	if timeout {
-		return reply.MakeStandardErrorReply("server time out")
-	}
-	if request.err != nil {
-		return reply.MakeStandardErrorReply("request failed")
+// setCmdsErr sets err on the commands which got no reply
+func setCmdsErr(cmds []Cmder, err error) {
+	for _, cmd := range cmds {
+		if cmd.Err() == nil && cmd.Reply() == nil {
+			cmd.setErr(err)
+		}
 	}
-	return request.reply
 }
 
-// Close stops asynchronous goroutines and close connection
-func (client *Client) Close() {
-	client.onceClose.Do(func() {
-		client.ticker.Stop()
-		close(client.pendingReqs)
-		client.working.Wait() // wait stop process
-		_ = client.connection.Close()
-		close(client.waitingReqs)
-	})
+func firstCmdsErr(cmds []Cmder) error {
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,561 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"go-redis/interface/resp"
+	"go-redis/lib/hash_slot"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ClusterOptions configures a ClusterClient, the zero values are replaced by the defaults
+type ClusterOptions struct {
+	Addrs []string // the nodes asked for the slots of the cluster, "localhost:6379" by default
+
+	// MaxRedirects is how many times a command follows MOVED or ASK, or is sent again after TRYAGAIN or CLUSTERDOWN.
+	// 3 by default, -1 disables it.
+	MaxRedirects int
+
+	// NodeOptions configures the client of each node, Addr is replaced by the address of the node.
+	// Its retry backoff is also the wait before a command replied TRYAGAIN or CLUSTERDOWN is sent again.
+	NodeOptions Options
+}
+
+// init replaces the zero values by the defaults
+func (opts *ClusterOptions) init() {
+	if len(opts.Addrs) == 0 {
+		opts.Addrs = []string{"localhost:6379"}
+	}
+	switch {
+	case opts.MaxRedirects == 0:
+		opts.MaxRedirects = 3
+	case opts.MaxRedirects < 0:
+		opts.MaxRedirects = 0
+	}
+}
+
+// clusterSlot is a range of slots and the node owning it
+type clusterSlot struct {
+	start, end int
+	addr       string
+}
+
+// clusterState is the slots of the cluster as a node described them
+type clusterState struct {
+	slots []clusterSlot // sorted by start
+	addrs []string      // the nodes owning slots
+}
+
+// makeClusterState sorts the slots and collects their nodes, a cluster without slots is an error
+func makeClusterState(slots []clusterSlot) (*clusterState, error) {
+	if len(slots) == 0 {
+		return nil, errors.New("redis: cluster has no slots")
+	}
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].start < slots[j].start
+	})
+	state := &clusterState{slots: slots}
+	known := make(map[string]bool)
+	for _, slot := range slots {
+		if !known[slot.addr] {
+			known[slot.addr] = true
+			state.addrs = append(state.addrs, slot.addr)
+		}
+	}
+	return state, nil
+}
+
+// slotAddr returns the node owning slot, or "" if no node does
+func (state *clusterState) slotAddr(slot int) string {
+	i := sort.Search(len(state.slots), func(i int) bool {
+		return state.slots[i].end >= slot
+	})
+	if i < len(state.slots) && state.slots[i].start <= slot {
+		return state.slots[i].addr
+	}
+	return ""
+}
+
+// cmdAddr returns the node owning the first key of cmd, or any node if it has no key
+func (state *clusterState) cmdAddr(cmd Cmder) string {
+	if key, ok := cmdFirstKey(cmd); ok {
+		if addr := state.slotAddr(hash_slot.Slot(key)); addr != "" {
+			return addr
+		}
+	}
+	return state.addrs[rand.Intn(len(state.addrs))]
+}
+
+// keylessCommands have no key, or are executed by every node, so any node is sent them
+var keylessCommands = map[string]bool{
+	"asking": true, "auth": true, "bgrewriteaof": true, "bgsave": true, "client": true, "cluster": true,
+	"command": true, "config": true, "dbsize": true, "discard": true, "echo": true, "exec": true,
+	"flushall": true, "flushdb": true, "hello": true, "info": true, "keys": true, "lastsave": true,
+	"module": true, "multi": true, "ping": true, "publish": true, "pubsub": true, "quit": true,
+	"randomkey": true, "readonly": true, "readwrite": true, "save": true, "scan": true, "select": true,
+	"shutdown": true, "time": true, "unwatch": true,
+}
+
+// cmdFirstKey returns the first key of cmd, ok is false if it has none
+func cmdFirstKey(cmd Cmder) (key string, ok bool) {
+	args := cmd.Args()
+	pos := 1
+	switch name := cmd.Name(); name {
+	case "eval", "evalsha", "fcall":
+		// EVAL script numkeys key...
+		if len(args) > 2 && string(args[2]) == "0" {
+			return "", false
+		}
+		pos = 3
+	case "xread", "xreadgroup":
+		// XREAD [COUNT count] [BLOCK ms] STREAMS key...
+		pos = len(args)
+		for i := 1; i < len(args); i++ {
+			if strings.EqualFold(string(args[i]), "streams") {
+				pos = i + 1
+				break
+			}
+		}
+	default:
+		if keylessCommands[name] {
+			return "", false
+		}
+	}
+	if pos >= len(args) {
+		return "", false
+	}
+	return string(args[pos]), true
+}
+
+// ClusterClient is a client of a cluster, it keeps a client per node and sends each command to the node owning
+// the slot of its first key. The slots are loaded with CLUSTER SLOTS, or CLUSTER SHARDS, by the first command and
+// loaded again when a node replies MOVED. It is safe for concurrent use.
+type ClusterClient struct {
+	cmdable
+	opts     *ClusterOptions
+	nodeOpts *Options // NodeOptions with the defaults filled in
+
+	nodesLock sync.Mutex // guards nodes and closed
+	nodes     map[string]*Client
+	closed    bool
+
+	loadLock  sync.Mutex   // one load of the slots at a time
+	stateLock sync.RWMutex // guards state and reloading
+	state     *clusterState
+	reloading bool
+}
+
+// NewClusterClient returns a client of the cluster the nodes of opts belong to, nothing is dialed until the first command
+func NewClusterClient(opts *ClusterOptions) *ClusterClient {
+	copied := *opts
+	copied.Addrs = append([]string(nil), opts.Addrs...)
+	copied.init()
+	nodeOpts := copied.NodeOptions
+	nodeOpts.init()
+	client := &ClusterClient{
+		opts:     &copied,
+		nodeOpts: &nodeOpts,
+		nodes:    make(map[string]*Client),
+	}
+	client.cmdable = client.Process
+	return client
+}
+
+// Options returns the options of the client with the defaults filled in
+func (client *ClusterClient) Options() *ClusterOptions {
+	return client.opts
+}
+
+// Process executes cmd on the node owning its key and returns its error
+func (client *ClusterClient) Process(ctx context.Context, cmd Cmder) error {
+	_ = client.processCommands(ctx, []Cmder{cmd})
+	return cmd.Err()
+}
+
+// Pipeline returns a pipeline whose commands are split by node, each node is sent its commands in one round trip
+func (client *ClusterClient) Pipeline() *Pipeline {
+	return makePipeline(client.processCommands)
+}
+
+// Pipelined queues the commands of fn in a pipeline and executes them
+func (client *ClusterClient) Pipelined(ctx context.Context, fn func(*Pipeline) error) ([]Cmder, error) {
+	return client.Pipeline().Pipelined(ctx, fn)
+}
+
+// ReloadState loads the slots of the cluster again from one of its nodes
+func (client *ClusterClient) ReloadState(ctx context.Context) error {
+	_, err := client.loadState(ctx)
+	return err
+}
+
+// Close closes the clients of every node
+func (client *ClusterClient) Close() error {
+	client.nodesLock.Lock()
+	defer client.nodesLock.Unlock()
+	client.closed = true
+	var err error
+	for _, node := range client.nodes {
+		if closeErr := node.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// getNode returns the client of the node at addr, it is created on first use
+func (client *ClusterClient) getNode(addr string) (*Client, error) {
+	client.nodesLock.Lock()
+	defer client.nodesLock.Unlock()
+	if client.closed {
+		return nil, ErrClosed
+	}
+	node, ok := client.nodes[addr]
+	if !ok {
+		opts := client.opts.NodeOptions
+		opts.Addr = addr
+		node = NewClient(&opts)
+		client.nodes[addr] = node
+	}
+	return node, nil
+}
+
+// getState returns the slots of the cluster, they are loaded if they were not yet
+func (client *ClusterClient) getState(ctx context.Context) (*clusterState, error) {
+	client.stateLock.RLock()
+	state := client.state
+	client.stateLock.RUnlock()
+	if state != nil {
+		return state, nil
+	}
+	return client.loadState(ctx)
+}
+
+// loadState asks the nodes owning slots, then the nodes of the options, for the slots until one of them answers
+func (client *ClusterClient) loadState(ctx context.Context) (*clusterState, error) {
+	client.loadLock.Lock()
+	defer client.loadLock.Unlock()
+	var addrs []string
+	client.stateLock.RLock()
+	if client.state != nil {
+		addrs = append(addrs, client.state.addrs...)
+	}
+	client.stateLock.RUnlock()
+	addrs = append(addrs, client.opts.Addrs...)
+
+	var err error
+	asked := make(map[string]bool)
+	for _, addr := range addrs {
+		if asked[addr] {
+			continue
+		}
+		asked[addr] = true
+		var node *Client
+		if node, err = client.getNode(addr); err != nil {
+			return nil, err
+		}
+		var state *clusterState
+		if state, err = fetchClusterState(ctx, node, addr); err == nil {
+			client.stateLock.Lock()
+			client.state = state
+			client.stateLock.Unlock()
+			return state, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, err
+}
+
+// lazyReload loads the slots again in the background, unless a reload is running
+func (client *ClusterClient) lazyReload() {
+	client.stateLock.Lock()
+	if client.reloading {
+		client.stateLock.Unlock()
+		return
+	}
+	client.reloading = true
+	client.stateLock.Unlock()
+	go func() {
+		_, _ = client.loadState(context.Background())
+		client.stateLock.Lock()
+		client.reloading = false
+		client.stateLock.Unlock()
+	}()
+}
+
+// clusterBatch is a node and whether each command sent to it is preceded by ASKING
+type clusterBatch struct {
+	addr   string
+	asking bool
+}
+
+// processCommands sends each command to the node owning its key, then follows the redirections the nodes replied.
+// It returns the first error of the commands.
+func (client *ClusterClient) processCommands(ctx context.Context, cmds []Cmder) error {
+	state, err := client.getState(ctx)
+	if err != nil {
+		setCmdsErr(cmds, err)
+		return err
+	}
+	batches := make(map[clusterBatch][]Cmder)
+	for _, cmd := range cmds {
+		batch := clusterBatch{addr: state.cmdAddr(cmd)}
+		batches[batch] = append(batches[batch], cmd)
+	}
+	for attempt := 1; ; attempt++ {
+		client.execBatches(ctx, batches)
+		if attempt > client.opts.MaxRedirects {
+			break
+		}
+		var backoff bool
+		if batches, backoff = client.redirect(batches); len(batches) == 0 {
+			break
+		}
+		if !backoff {
+			continue
+		}
+		if err := sleep(ctx, client.nodeOpts.retryBackoff(attempt)); err != nil {
+			for _, batch := range batches {
+				setCmdsErr(batch, err)
+			}
+			return err
+		}
+	}
+	return firstCmdsErr(cmds)
+}
+
+// execBatches sends every node its commands, the nodes are sent them concurrently
+func (client *ClusterClient) execBatches(ctx context.Context, batches map[clusterBatch][]Cmder) {
+	if len(batches) == 1 {
+		for batch, cmds := range batches {
+			client.execBatch(ctx, batch, cmds)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	for batch, cmds := range batches {
+		wg.Add(1)
+		go func(batch clusterBatch, cmds []Cmder) {
+			defer wg.Done()
+			client.execBatch(ctx, batch, cmds)
+		}(batch, cmds)
+	}
+	wg.Wait()
+}
+
+// execBatch sends cmds to the node of batch in one round trip
+func (client *ClusterClient) execBatch(ctx context.Context, batch clusterBatch, cmds []Cmder) {
+	node, err := client.getNode(batch.addr)
+	if err != nil {
+		setCmdsErr(cmds, err)
+		return
+	}
+	if batch.asking {
+		// ASKING only lets the next command in
+		asked := make([]Cmder, 0, 2*len(cmds))
+		for _, cmd := range cmds {
+			asked = append(asked, NewStatusCmd("asking"), cmd)
+		}
+		cmds = asked
+	}
+	if err := node.processCommands(ctx, cmds, false); shouldRetry(err) {
+		// the node could not be reached even after the retries, it may have left the cluster
+		client.lazyReload()
+	}
+}
+
+// redirect returns the commands to send again by node: the ones redirected by MOVED or ASK,
+// and the ones replied TRYAGAIN or CLUSTERDOWN, which are sent again after a backoff
+func (client *ClusterClient) redirect(batches map[clusterBatch][]Cmder) (map[clusterBatch][]Cmder, bool) {
+	next := make(map[clusterBatch][]Cmder)
+	backoff := false
+	for batch, cmds := range batches {
+		for _, cmd := range cmds {
+			var replyErr Error
+			if !errors.As(cmd.Err(), &replyErr) {
+				continue
+			}
+			kind, addr := parseClusterError(replyErr)
+			if strings.HasPrefix(addr, ":") {
+				// the host is left out when it is the one of the node which replied
+				host, _, _ := net.SplitHostPort(batch.addr)
+				addr = host + addr
+			}
+			switch kind {
+			case "MOVED":
+				client.lazyReload()
+				next[clusterBatch{addr: addr}] = append(next[clusterBatch{addr: addr}], cmd)
+			case "ASK":
+				next[clusterBatch{addr: addr, asking: true}] = append(next[clusterBatch{addr: addr, asking: true}], cmd)
+			case "TRYAGAIN", "CLUSTERDOWN":
+				next[batch] = append(next[batch], cmd)
+				backoff = true
+			default:
+				continue
+			}
+			cmd.reset()
+		}
+	}
+	return next, backoff
+}
+
+// parseClusterError returns the kind of err and the node it redirects to, e.g. "MOVED 3999 127.0.0.1:6381"
+func parseClusterError(err Error) (kind string, addr string) {
+	fields := strings.Fields(string(err))
+	if len(fields) == 0 {
+		return "", ""
+	}
+	kind = fields[0]
+	if kind == "MOVED" || kind == "ASK" {
+		if len(fields) != 3 {
+			return "", ""
+		}
+		addr = fields[2]
+	}
+	return kind, addr
+}
+
+// fetchClusterState asks the node at addr for the slots with CLUSTER SLOTS, or with CLUSTER SHARDS if it does not know it
+func fetchClusterState(ctx context.Context, node *Client, addr string) (*clusterState, error) {
+	slotsCmd := NewCmd("cluster", "slots")
+	err := node.Process(ctx, slotsCmd)
+	if err == nil {
+		return parseClusterSlots(slotsCmd.Val(), addr)
+	}
+	var replyErr Error
+	if !errors.As(err, &replyErr) {
+		return nil, err
+	}
+	shardsCmd := NewCmd("cluster", "shards")
+	if err := node.Process(ctx, shardsCmd); err != nil {
+		return nil, err
+	}
+	return parseClusterShards(shardsCmd.Val(), addr)
+}
+
+// makeNodeAddr returns the address of a node, an empty or unknown host is the one of the node at addr which described it
+func makeNodeAddr(host string, port int64, addr string) string {
+	if host == "" || host == "?" {
+		host, _, _ = net.SplitHostPort(addr)
+	}
+	return net.JoinHostPort(host, strconv.FormatInt(port, 10))
+}
+
+// parseClusterSlots decodes the reply of CLUSTER SLOTS: start, end and the master [host, port, id], then the replicas
+func parseClusterSlots(r resp.Reply, addr string) (*clusterState, error) {
+	entries, err := toElements(r)
+	if err != nil {
+		return nil, err
+	}
+	slots := make([]clusterSlot, 0, len(entries))
+	for _, entry := range entries {
+		fields, err := toElements(entry)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) < 3 {
+			return nil, makeUnexpectedReplyError(r)
+		}
+		start, err := toInt(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		end, err := toInt(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		master, err := toElements(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		if len(master) < 2 {
+			return nil, makeUnexpectedReplyError(r)
+		}
+		host, err := toString(master[0])
+		if err != nil {
+			return nil, err
+		}
+		port, err := toInt(master[1])
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, clusterSlot{start: int(start), end: int(end), addr: makeNodeAddr(host, port, addr)})
+	}
+	return makeClusterState(slots)
+}
+
+// parseClusterShards decodes the reply of CLUSTER SHARDS: per shard, the start and end of its slot ranges and its nodes
+func parseClusterShards(r resp.Reply, addr string) (*clusterState, error) {
+	shards, err := toElements(r)
+	if err != nil {
+		return nil, err
+	}
+	var slots []clusterSlot
+	for _, shard := range shards {
+		fields, err := toMap(shard)
+		if err != nil {
+			return nil, err
+		}
+		ranges, err := toElements(fields["slots"])
+		if err != nil {
+			return nil, err
+		}
+		master, err := parseShardMaster(fields["nodes"], addr)
+		if err != nil {
+			return nil, err
+		}
+		if master == "" {
+			continue
+		}
+		for i := 0; i+1 < len(ranges); i += 2 {
+			start, err := toInt(ranges[i])
+			if err != nil {
+				return nil, err
+			}
+			end, err := toInt(ranges[i+1])
+			if err != nil {
+				return nil, err
+			}
+			slots = append(slots, clusterSlot{start: int(start), end: int(end), addr: master})
+		}
+	}
+	return makeClusterState(slots)
+}
+
+// parseShardMaster returns the address of the master among the nodes of a shard, or "" if it has none
+func parseShardMaster(r resp.Reply, addr string) (string, error) {
+	nodes, err := toElements(r)
+	if err != nil {
+		return "", err
+	}
+	for _, node := range nodes {
+		fields, err := toMap(node)
+		if err != nil {
+			return "", err
+		}
+		if role, _ := toString(fields["role"]); role != "master" {
+			continue
+		}
+		host, _ := toString(fields["endpoint"])
+		if host == "" {
+			host, _ = toString(fields["ip"])
+		}
+		portReply, ok := fields["port"]
+		if !ok {
+			// a node serving tls only has no port
+			portReply = fields["tls-port"]
+		}
+		port, err := toInt(portReply)
+		if err != nil {
+			return "", err
+		}
+		return makeNodeAddr(host, port, addr), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,543 @@
+package client
+
+import (
+	"fmt"
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error is an error replied by the server
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Nil is the error of the commands replying a null, e.g. GET of a missing key
+const Nil = Error("redis: nil")
+
+// TxFailedErr is the error of the commands of a transaction aborted because a watched key changed
+const TxFailedErr = Error("redis: transaction failed")
+
+// Cmder is a command sent to the server, its reply is decoded by the command
+type Cmder interface {
+	// Name returns the name of the command in lower case
+	Name() string
+	// Args returns the command line
+	Args() [][]byte
+	// Err returns the error replied by the server, or the error which prevented the command from being executed
+	Err() error
+	// Reply returns the reply as read from the server, nil until the command is executed
+	Reply() resp.Reply
+
+	setReply(r resp.Reply)
+	setErr(err error)
+	reset()
+}
+
+type baseCmd struct {
+	args  [][]byte
+	reply resp.Reply
+	err   error
+}
+
+func makeBaseCmd(args []interface{}) baseCmd {
+	return baseCmd{args: toArgs(args)}
+}
+
+func (cmd *baseCmd) Name() string {
+	if len(cmd.args) == 0 {
+		return ""
+	}
+	return strings.ToLower(string(cmd.args[0]))
+}
+
+func (cmd *baseCmd) Args() [][]byte {
+	return cmd.args
+}
+
+func (cmd *baseCmd) Err() error {
+	return cmd.err
+}
+
+func (cmd *baseCmd) Reply() resp.Reply {
+	return cmd.reply
+}
+
+func (cmd *baseCmd) setErr(err error) {
+	cmd.err = err
+}
+
+// reset forgets the reply, before the command is sent again to another node
+func (cmd *baseCmd) reset() {
+	cmd.reply, cmd.err = nil, nil
+}
+
+// readReply stores r, it returns false if r is an error which the command must not decode
+func (cmd *baseCmd) readReply(r resp.Reply) bool {
+	cmd.reply, cmd.err = r, nil
+	if errorReply, ok := r.(resp.ErrorReply); ok {
+		cmd.err = Error(errorReply.Error())
+		return false
+	}
+	return true
+}
+
+func (cmd *baseCmd) String() string {
+	args := make([]string, len(cmd.args))
+	for i, arg := range cmd.args {
+		args[i] = string(arg)
+	}
+	s := strings.Join(args, " ")
+	if cmd.err != nil {
+		return s + ": " + cmd.err.Error()
+	}
+	return s
+}
+
+// Cmd is a command whose reply is kept as it is
+type Cmd struct {
+	baseCmd
+}
+
+// NewCmd returns a command made of args, which are strings, byte slices, numbers or booleans
+func NewCmd(args ...interface{}) *Cmd {
+	return &Cmd{baseCmd: makeBaseCmd(args)}
+}
+
+func (cmd *Cmd) setReply(r resp.Reply) {
+	if !cmd.readReply(r) {
+		return
+	}
+	if isNull(r) {
+		cmd.err = Nil
+	}
+}
+
+// Val returns the reply
+func (cmd *Cmd) Val() resp.Reply {
+	return cmd.reply
+}
+
+// Result returns the reply and the error of the command
+func (cmd *Cmd) Result() (resp.Reply, error) {
+	return cmd.reply, cmd.err
+}
+
+// Text returns the reply as a string
+func (cmd *Cmd) Text() (string, error) {
+	if cmd.err != nil {
+		return "", cmd.err
+	}
+	return toString(cmd.reply)
+}
+
+// Int64 returns the reply as an integer
+func (cmd *Cmd) Int64() (int64, error) {
+	if cmd.err != nil {
+		return 0, cmd.err
+	}
+	return toInt(cmd.reply)
+}
+
+// StringSlice returns the reply as a slice of strings
+func (cmd *Cmd) StringSlice() ([]string, error) {
+	if cmd.err != nil {
+		return nil, cmd.err
+	}
+	return toStringSlice(cmd.reply)
+}
+
+// StatusCmd is a command replying a status, e.g. OK
+type StatusCmd struct {
+	baseCmd
+	val string
+}
+
+// NewStatusCmd returns a command made of args replying a status
+func NewStatusCmd(args ...interface{}) *StatusCmd {
+	return &StatusCmd{baseCmd: makeBaseCmd(args)}
+}
+
+func (cmd *StatusCmd) setReply(r resp.Reply) {
+	if cmd.readReply(r) {
+		cmd.val, cmd.err = toString(r)
+	}
+}
+
+func (cmd *StatusCmd) Val() string {
+	return cmd.val
+}
+
+func (cmd *StatusCmd) Result() (string, error) {
+	return cmd.val, cmd.err
+}
+
+// StringCmd is a command replying a string
+type StringCmd struct {
+	baseCmd
+	val string
+}
+
+// NewStringCmd returns a command made of args replying a string
+func NewStringCmd(args ...interface{}) *StringCmd {
+	return &StringCmd{baseCmd: makeBaseCmd(args)}
+}
+
+func (cmd *StringCmd) setReply(r resp.Reply) {
+	if cmd.readReply(r) {
+		cmd.val, cmd.err = toString(r)
+	}
+}
+
+func (cmd *StringCmd) Val() string {
+	return cmd.val
+}
+
+func (cmd *StringCmd) Result() (string, error) {
+	return cmd.val, cmd.err
+}
+
+// Bytes returns the reply as a byte slice
+func (cmd *StringCmd) Bytes() ([]byte, error) {
+	return []byte(cmd.val), cmd.err
+}
+
+// Int64 returns the reply parsed as an integer
+func (cmd *StringCmd) Int64() (int64, error) {
+	if cmd.err != nil {
+		return 0, cmd.err
+	}
+	return strconv.ParseInt(cmd.val, 10, 64)
+}
+
+// Float64 returns the reply parsed as a float
+func (cmd *StringCmd) Float64() (float64, error) {
+	if cmd.err != nil {
+		return 0, cmd.err
+	}
+	return strconv.ParseFloat(cmd.val, 64)
+}
+
+// IntCmd is a command replying an integer
+type IntCmd struct {
+	baseCmd
+	val int64
+}
+
+// NewIntCmd returns a command made of args replying an integer
+func NewIntCmd(args ...interface{}) *IntCmd {
+	return &IntCmd{baseCmd: makeBaseCmd(args)}
+}
+
+func (cmd *IntCmd) setReply(r resp.Reply) {
+	if cmd.readReply(r) {
+		cmd.val, cmd.err = toInt(r)
+	}
+}
+
+func (cmd *IntCmd) Val() int64 {
+	return cmd.val
+}
+
+func (cmd *IntCmd) Result() (int64, error) {
+	return cmd.val, cmd.err
+}
+
+// FloatCmd is a command replying a float, e.g. INCRBYFLOAT
+type FloatCmd struct {
+	baseCmd
+	val float64
+}
+
+// NewFloatCmd returns a command made of args replying a float
+func NewFloatCmd(args ...interface{}) *FloatCmd {
+	return &FloatCmd{baseCmd: makeBaseCmd(args)}
+}
+
+func (cmd *FloatCmd) setReply(r resp.Reply) {
+	if cmd.readReply(r) {
+		cmd.val, cmd.err = toFloat(r)
+	}
+}
+
+func (cmd *FloatCmd) Val() float64 {
+	return cmd.val
+}
+
+func (cmd *FloatCmd) Result() (float64, error) {
+	return cmd.val, cmd.err
+}
+
+// BoolCmd is a command replying 1 or 0, or OK or a null like SET NX does
+type BoolCmd struct {
+	baseCmd
+	val bool
+}
+
+// NewBoolCmd returns a command made of args replying a boolean
+func NewBoolCmd(args ...interface{}) *BoolCmd {
+	return &BoolCmd{baseCmd: makeBaseCmd(args)}
+}
+
+func (cmd *BoolCmd) setReply(r resp.Reply) {
+	if !cmd.readReply(r) {
+		return
+	}
+	switch r := r.(type) {
+	case *reply.IntReply:
+		cmd.val = r.Code != 0
+	case *reply.StatusReply:
+		cmd.val = r.Status == "OK"
+	case *reply.BooleanReply:
+		cmd.val = r.Value
+	default:
+		if !isNull(r) {
+			cmd.err = makeUnexpectedReplyError(r)
+		}
+		cmd.val = false
+	}
+}
+
+func (cmd *BoolCmd) Val() bool {
+	return cmd.val
+}
+
+func (cmd *BoolCmd) Result() (bool, error) {
+	return cmd.val, cmd.err
+}
+
+// DurationCmd is a command replying a duration in the given precision, e.g. TTL or PTTL.
+// The -1 and -2 replies of a key without expiration or a missing key are kept as -1 and -2.
+type DurationCmd struct {
+	baseCmd
+	precision time.Duration
+	val       time.Duration
+}
+
+// NewDurationCmd returns a command made of args replying a duration in precision units
+func NewDurationCmd(precision time.Duration, args ...interface{}) *DurationCmd {
+	return &DurationCmd{baseCmd: makeBaseCmd(args), precision: precision}
+}
+
+func (cmd *DurationCmd) setReply(r resp.Reply) {
+	if !cmd.readReply(r) {
+		return
+	}
+	var n int64
+	n, cmd.err = toInt(r)
+	if n < 0 {
+		cmd.val = time.Duration(n)
+	} else {
+		cmd.val = time.Duration(n) * cmd.precision
+	}
+}
+
+func (cmd *DurationCmd) Val() time.Duration {
+	return cmd.val
+}
+
+func (cmd *DurationCmd) Result() (time.Duration, error) {
+	return cmd.val, cmd.err
+}
+
+// StringSliceCmd is a command replying an array of strings, the null elements are empty strings
+type StringSliceCmd struct {
+	baseCmd
+	val []string
+}
+
+// NewStringSliceCmd returns a command made of args replying an array of strings
+func NewStringSliceCmd(args ...interface{}) *StringSliceCmd {
+	return &StringSliceCmd{baseCmd: makeBaseCmd(args)}
+}
+
+func (cmd *StringSliceCmd) setReply(r resp.Reply) {
+	if cmd.readReply(r) {
+		cmd.val, cmd.err = toStringSlice(r)
+	}
+}
+
+func (cmd *StringSliceCmd) Val() []string {
+	return cmd.val
+}
+
+func (cmd *StringSliceCmd) Result() ([]string, error) {
+	return cmd.val, cmd.err
+}
+
+// SliceCmd is a command replying an array whose null elements are nil, e.g. MGET
+type SliceCmd struct {
+	baseCmd
+	val []interface{}
+}
+
+// NewSliceCmd returns a command made of args replying an array of strings or nulls
+func NewSliceCmd(args ...interface{}) *SliceCmd {
+	return &SliceCmd{baseCmd: makeBaseCmd(args)}
+}
+
+func (cmd *SliceCmd) setReply(r resp.Reply) {
+	if !cmd.readReply(r) {
+		return
+	}
+	elements, err := toElements(r)
+	if err != nil {
+		cmd.err = err
+		return
+	}
+	cmd.val = make([]interface{}, len(elements))
+	for i, element := range elements {
+		if isNull(element) {
+			continue
+		}
+		if cmd.val[i], err = toString(element); err != nil {
+			cmd.err = err
+			return
+		}
+	}
+}
+
+func (cmd *SliceCmd) Val() []interface{} {
+	return cmd.val
+}
+
+func (cmd *SliceCmd) Result() ([]interface{}, error) {
+	return cmd.val, cmd.err
+}
+
+// MapStringStringCmd is a command replying field value pairs, e.g. HGETALL
+type MapStringStringCmd struct {
+	baseCmd
+	val map[string]string
+}
+
+// NewMapStringStringCmd returns a command made of args replying field value pairs
+func NewMapStringStringCmd(args ...interface{}) *MapStringStringCmd {
+	return &MapStringStringCmd{baseCmd: makeBaseCmd(args)}
+}
+
+func (cmd *MapStringStringCmd) setReply(r resp.Reply) {
+	if !cmd.readReply(r) {
+		return
+	}
+	values, err := toStringSlice(r)
+	if err != nil {
+		cmd.err = err
+		return
+	}
+	cmd.val = make(map[string]string, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		cmd.val[values[i]] = values[i+1]
+	}
+}
+
+func (cmd *MapStringStringCmd) Val() map[string]string {
+	return cmd.val
+}
+
+func (cmd *MapStringStringCmd) Result() (map[string]string, error) {
+	return cmd.val, cmd.err
+}
+
+// Z is a member of a sorted set
+type Z struct {
+	Score  float64
+	Member string
+}
+
+// ZSliceCmd is a command replying members with their scores, e.g. ZRANGE WITHSCORES
+type ZSliceCmd struct {
+	baseCmd
+	val []Z
+}
+
+// NewZSliceCmd returns a command made of args replying member score pairs
+func NewZSliceCmd(args ...interface{}) *ZSliceCmd {
+	return &ZSliceCmd{baseCmd: makeBaseCmd(args)}
+}
+
+func (cmd *ZSliceCmd) setReply(r resp.Reply) {
+	if !cmd.readReply(r) {
+		return
+	}
+	values, err := toStringSlice(r)
+	if err != nil {
+		cmd.err = err
+		return
+	}
+	cmd.val = make([]Z, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		score, err := strconv.ParseFloat(values[i+1], 64)
+		if err != nil {
+			cmd.err = err
+			return
+		}
+		cmd.val = append(cmd.val, Z{Member: values[i], Score: score})
+	}
+}
+
+func (cmd *ZSliceCmd) Val() []Z {
+	return cmd.val
+}
+
+func (cmd *ZSliceCmd) Result() ([]Z, error) {
+	return cmd.val, cmd.err
+}
+
+// toArgs converts the args of a command to bulk strings
+func toArgs(args []interface{}) [][]byte {
+	result := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		result = appendArg(result, arg)
+	}
+	return result
+}
+
+// appendArg appends arg to args, a slice of strings or byte slices is appended element by element
+func appendArg(args [][]byte, arg interface{}) [][]byte {
+	switch arg := arg.(type) {
+	case []byte:
+		return append(args, arg)
+	case string:
+		return append(args, []byte(arg))
+	case [][]byte:
+		return append(args, arg...)
+	case []string:
+		for _, s := range arg {
+			args = append(args, []byte(s))
+		}
+		return args
+	case []interface{}:
+		for _, element := range arg {
+			args = appendArg(args, element)
+		}
+		return args
+	case int:
+		return append(args, []byte(strconv.Itoa(arg)))
+	case int64:
+		return append(args, []byte(strconv.FormatInt(arg, 10)))
+	case int32:
+		return append(args, []byte(strconv.FormatInt(int64(arg), 10)))
+	case uint64:
+		return append(args, []byte(strconv.FormatUint(arg, 10)))
+	case uint:
+		return append(args, []byte(strconv.FormatUint(uint64(arg), 10)))
+	case float64:
+		return append(args, []byte(strconv.FormatFloat(arg, 'f', -1, 64)))
+	case float32:
+		return append(args, []byte(strconv.FormatFloat(float64(arg), 'f', -1, 32)))
+	case bool:
+		if arg {
+			return append(args, []byte("1"))
+		}
+		return append(args, []byte("0"))
+	case nil:
+		return append(args, []byte{})
+	default:
+		return append(args, []byte(fmt.Sprint(arg)))
+	}
+}
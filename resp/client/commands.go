@@ -0,0 +1,418 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// KeepTTL is the expiration of a SET keeping the time to live of the key
+const KeepTTL time.Duration = -1
+
+// cmdable executes or queues a command, the typed commands are built on it by Client, Conn and Pipeline
+type cmdable func(ctx context.Context, cmd Cmder) error
+
+// Do executes a command made of args, the reply is kept as it is
+func (c cmdable) Do(ctx context.Context, args ...interface{}) *Cmd {
+	cmd := NewCmd(args...)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// appendExpiration appends EX or PX to args, PX is used if expiration is not a whole number of seconds
+func appendExpiration(args []interface{}, expiration time.Duration) []interface{} {
+	switch {
+	case expiration == KeepTTL:
+		return append(args, "keepttl")
+	case expiration <= 0:
+		return args
+	case expiration%time.Second == 0:
+		return append(args, "ex", int64(expiration/time.Second))
+	default:
+		return append(args, "px", int64(expiration/time.Millisecond))
+	}
+}
+
+// --- connection
+
+func (c cmdable) Ping(ctx context.Context) *StatusCmd {
+	cmd := NewStatusCmd("ping")
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Echo(ctx context.Context, message interface{}) *StringCmd {
+	cmd := NewStringCmd("echo", message)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// --- keys
+
+func (c cmdable) Del(ctx context.Context, keys ...string) *IntCmd {
+	cmd := NewIntCmd("del", keys)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Exists(ctx context.Context, keys ...string) *IntCmd {
+	cmd := NewIntCmd("exists", keys)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Expire(ctx context.Context, key string, expiration time.Duration) *BoolCmd {
+	cmd := NewBoolCmd("expire", key, int64(expiration/time.Second))
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Persist(ctx context.Context, key string) *BoolCmd {
+	cmd := NewBoolCmd("persist", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) TTL(ctx context.Context, key string) *DurationCmd {
+	cmd := NewDurationCmd(time.Second, "ttl", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) PTTL(ctx context.Context, key string) *DurationCmd {
+	cmd := NewDurationCmd(time.Millisecond, "pttl", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Type(ctx context.Context, key string) *StatusCmd {
+	cmd := NewStatusCmd("type", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Rename(ctx context.Context, key, newKey string) *StatusCmd {
+	cmd := NewStatusCmd("rename", key, newKey)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) RenameNX(ctx context.Context, key, newKey string) *BoolCmd {
+	cmd := NewBoolCmd("renamenx", key, newKey)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Keys(ctx context.Context, pattern string) *StringSliceCmd {
+	cmd := NewStringSliceCmd("keys", pattern)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) FlushDB(ctx context.Context) *StatusCmd {
+	cmd := NewStatusCmd("flushdb")
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// --- strings
+
+func (c cmdable) Get(ctx context.Context, key string) *StringCmd {
+	cmd := NewStringCmd("get", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// Set sets key to value, with a time to live if expiration is positive or keeping the current one if it is KeepTTL
+func (c cmdable) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *StatusCmd {
+	cmd := NewStatusCmd(appendExpiration([]interface{}{"set", key, value}, expiration)...)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// SetNX sets key to value if it does not exist, it returns whether the key was set
+func (c cmdable) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *BoolCmd {
+	var cmd *BoolCmd
+	if expiration > 0 || expiration == KeepTTL {
+		cmd = NewBoolCmd(append(appendExpiration([]interface{}{"set", key, value}, expiration), "nx")...)
+	} else {
+		cmd = NewBoolCmd("setnx", key, value)
+	}
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) GetSet(ctx context.Context, key string, value interface{}) *StringCmd {
+	cmd := NewStringCmd("getset", key, value)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// MGet returns the values of keys, the value of a missing key is nil
+func (c cmdable) MGet(ctx context.Context, keys ...string) *SliceCmd {
+	cmd := NewSliceCmd("mget", keys)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// MSet sets the keys and values of pairs, e.g. MSet(ctx, "k1", "v1", "k2", "v2")
+func (c cmdable) MSet(ctx context.Context, pairs ...interface{}) *StatusCmd {
+	cmd := NewStatusCmd(append([]interface{}{"mset"}, pairs...)...)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Incr(ctx context.Context, key string) *IntCmd {
+	cmd := NewIntCmd("incr", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) IncrBy(ctx context.Context, key string, increment int64) *IntCmd {
+	cmd := NewIntCmd("incrby", key, increment)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) IncrByFloat(ctx context.Context, key string, increment float64) *FloatCmd {
+	cmd := NewFloatCmd("incrbyfloat", key, increment)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Decr(ctx context.Context, key string) *IntCmd {
+	cmd := NewIntCmd("decr", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) DecrBy(ctx context.Context, key string, decrement int64) *IntCmd {
+	cmd := NewIntCmd("decrby", key, decrement)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Append(ctx context.Context, key, value string) *IntCmd {
+	cmd := NewIntCmd("append", key, value)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) StrLen(ctx context.Context, key string) *IntCmd {
+	cmd := NewIntCmd("strlen", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// --- hashes
+
+// HSet sets the fields and values of pairs, e.g. HSet(ctx, "hash", "f1", "v1", "f2", "v2")
+func (c cmdable) HSet(ctx context.Context, key string, pairs ...interface{}) *IntCmd {
+	cmd := NewIntCmd(append([]interface{}{"hset", key}, pairs...)...)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) HGet(ctx context.Context, key, field string) *StringCmd {
+	cmd := NewStringCmd("hget", key, field)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) HGetAll(ctx context.Context, key string) *MapStringStringCmd {
+	cmd := NewMapStringStringCmd("hgetall", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) HDel(ctx context.Context, key string, fields ...string) *IntCmd {
+	cmd := NewIntCmd("hdel", key, fields)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) HExists(ctx context.Context, key, field string) *BoolCmd {
+	cmd := NewBoolCmd("hexists", key, field)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) HLen(ctx context.Context, key string) *IntCmd {
+	cmd := NewIntCmd("hlen", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) HKeys(ctx context.Context, key string) *StringSliceCmd {
+	cmd := NewStringSliceCmd("hkeys", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) HVals(ctx context.Context, key string) *StringSliceCmd {
+	cmd := NewStringSliceCmd("hvals", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) HIncrBy(ctx context.Context, key, field string, increment int64) *IntCmd {
+	cmd := NewIntCmd("hincrby", key, field, increment)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// --- lists
+
+func (c cmdable) LPush(ctx context.Context, key string, values ...interface{}) *IntCmd {
+	cmd := NewIntCmd(append([]interface{}{"lpush", key}, values...)...)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) RPush(ctx context.Context, key string, values ...interface{}) *IntCmd {
+	cmd := NewIntCmd(append([]interface{}{"rpush", key}, values...)...)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) LPop(ctx context.Context, key string) *StringCmd {
+	cmd := NewStringCmd("lpop", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) RPop(ctx context.Context, key string) *StringCmd {
+	cmd := NewStringCmd("rpop", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) LLen(ctx context.Context, key string) *IntCmd {
+	cmd := NewIntCmd("llen", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) LRange(ctx context.Context, key string, start, stop int64) *StringSliceCmd {
+	cmd := NewStringSliceCmd("lrange", key, start, stop)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) LIndex(ctx context.Context, key string, index int64) *StringCmd {
+	cmd := NewStringCmd("lindex", key, index)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// --- sets
+
+func (c cmdable) SAdd(ctx context.Context, key string, members ...interface{}) *IntCmd {
+	cmd := NewIntCmd(append([]interface{}{"sadd", key}, members...)...)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) SRem(ctx context.Context, key string, members ...interface{}) *IntCmd {
+	cmd := NewIntCmd(append([]interface{}{"srem", key}, members...)...)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) SMembers(ctx context.Context, key string) *StringSliceCmd {
+	cmd := NewStringSliceCmd("smembers", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) SIsMember(ctx context.Context, key string, member interface{}) *BoolCmd {
+	cmd := NewBoolCmd("sismember", key, member)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) SCard(ctx context.Context, key string) *IntCmd {
+	cmd := NewIntCmd("scard", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// --- sorted sets
+
+func (c cmdable) ZAdd(ctx context.Context, key string, members ...Z) *IntCmd {
+	args := make([]interface{}, 0, 2+2*len(members))
+	args = append(args, "zadd", key)
+	for _, member := range members {
+		args = append(args, member.Score, member.Member)
+	}
+	cmd := NewIntCmd(args...)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ZRem(ctx context.Context, key string, members ...interface{}) *IntCmd {
+	cmd := NewIntCmd(append([]interface{}{"zrem", key}, members...)...)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ZScore(ctx context.Context, key, member string) *FloatCmd {
+	cmd := NewFloatCmd("zscore", key, member)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ZIncrBy(ctx context.Context, key string, increment float64, member string) *FloatCmd {
+	cmd := NewFloatCmd("zincrby", key, increment, member)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ZCard(ctx context.Context, key string) *IntCmd {
+	cmd := NewIntCmd("zcard", key)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ZRank(ctx context.Context, key, member string) *IntCmd {
+	cmd := NewIntCmd("zrank", key, member)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ZRange(ctx context.Context, key string, start, stop int64) *StringSliceCmd {
+	cmd := NewStringSliceCmd("zrange", key, start, stop)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ZRangeWithScores(ctx context.Context, key string, start, stop int64) *ZSliceCmd {
+	cmd := NewZSliceCmd("zrange", key, start, stop, "withscores")
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) ZRevRange(ctx context.Context, key string, start, stop int64) *StringSliceCmd {
+	cmd := NewStringSliceCmd("zrevrange", key, start, stop)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+// --- transactions and pub/sub
+
+func (c cmdable) Watch(ctx context.Context, keys ...string) *StatusCmd {
+	cmd := NewStatusCmd("watch", keys)
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Unwatch(ctx context.Context) *StatusCmd {
+	cmd := NewStatusCmd("unwatch")
+	_ = c(ctx, cmd)
+	return cmd
+}
+
+func (c cmdable) Publish(ctx context.Context, channel string, message interface{}) *IntCmd {
+	cmd := NewIntCmd("publish", channel, message)
+	_ = c(ctx, cmd)
+	return cmd
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"go-redis/resp/parser"
+	"go-redis/resp/reply"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// conn is a connection to the server, the commands are written and their replies read in order
+type conn struct {
+	netConn net.Conn
+	parser  *parser.Parser
+	writer  *bufio.Writer
+	usedAt  time.Time // when the connection was returned to the pool
+	db      int       // the selected database
+	broken  bool      // a network or protocol error happened, the connection must not be reused
+}
+
+func makeConn(netConn net.Conn) *conn {
+	return &conn{
+		netConn: netConn,
+		parser:  parser.NewParser(netConn),
+		writer:  bufio.NewWriter(netConn),
+	}
+}
+
+// deadline returns the deadline of an io bounded by timeout and by ctx, zero means no deadline
+func deadline(ctx context.Context, timeout time.Duration) time.Time {
+	var t time.Time
+	if timeout > 0 {
+		t = time.Now().Add(timeout)
+	}
+	if ctxDeadline, ok := ctx.Deadline(); ok && (t.IsZero() || ctxDeadline.Before(t)) {
+		t = ctxDeadline
+	}
+	return t
+}
+
+// writeCommands sends the commands in one write
+func (cn *conn) writeCommands(ctx context.Context, timeout time.Duration, cmds []Cmder) error {
+	if err := cn.netConn.SetWriteDeadline(deadline(ctx, timeout)); err != nil {
+		cn.broken = true
+		return err
+	}
+	for _, cmd := range cmds {
+		if _, err := cn.writer.Write(reply.MakeMultiBulkReply(cmd.Args()).ToBytes()); err != nil {
+			cn.broken = true
+			return err
+		}
+	}
+	if err := cn.writer.Flush(); err != nil {
+		cn.broken = true
+		return err
+	}
+	return nil
+}
+
+// readReplies reads the reply of each command in order
+func (cn *conn) readReplies(ctx context.Context, timeout time.Duration, cmds []Cmder) error {
+	if err := cn.netConn.SetReadDeadline(deadline(ctx, timeout)); err != nil {
+		cn.broken = true
+		return err
+	}
+	for _, cmd := range cmds {
+		r, err := cn.parser.ReadReply()
+		if err != nil {
+			cn.broken = true
+			return err
+		}
+		cmd.setReply(r)
+		cn.trackSelect(cmd)
+	}
+	return nil
+}
+
+// trackSelect remembers the database selected by a successful SELECT
+func (cn *conn) trackSelect(cmd Cmder) {
+	if cmd.Err() != nil || cmd.Name() != "select" || len(cmd.Args()) != 2 {
+		return
+	}
+	if db, err := strconv.Atoi(string(cmd.Args()[1])); err == nil {
+		cn.db = db
+	}
+}
+
+// isAlive returns false if the server closed the connection while it was idle, or sent a reply nobody asked for.
+// The socket is peeked without blocking, a connection of a custom dialer which can not be peeked is assumed alive.
+func (cn *conn) isAlive() bool {
+	netConn := cn.netConn
+	if tlsConn, ok := netConn.(*tls.Conn); ok {
+		netConn = tlsConn.NetConn()
+	}
+	sysConn, ok := netConn.(syscall.Conn)
+	if !ok {
+		return true
+	}
+	rawConn, err := sysConn.SyscallConn()
+	if err != nil {
+		return false
+	}
+	alive := false
+	var buf [1]byte
+	err = rawConn.Read(func(fd uintptr) bool {
+		_, _, err := syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		// nothing to read: the connection is open, a read of 0 bytes would be the end of the stream
+		alive = err == syscall.EAGAIN || err == syscall.EWOULDBLOCK
+		return true
+	})
+	return err == nil && alive
+}
+
+func (cn *conn) close() error {
+	err := cn.netConn.Close()
+	cn.parser.Release()
+	return err
+}
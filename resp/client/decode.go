@@ -0,0 +1,136 @@
+package client
+
+import (
+	"fmt"
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+	"strconv"
+)
+
+// makeUnexpectedReplyError returns the error of a reply the command can not decode
+func makeUnexpectedReplyError(r resp.Reply) error {
+	return fmt.Errorf("redis: unexpected reply %T", r)
+}
+
+// isNull returns true if r is a null bulk string, a null array or a RESP3 null
+func isNull(r resp.Reply) bool {
+	switch r.(type) {
+	case *reply.NullBulkReply, *reply.NullMultiBulkReply, *reply.NullReply:
+		return true
+	}
+	return false
+}
+
+// toString decodes a bulk string, a status or a number
+func toString(r resp.Reply) (string, error) {
+	switch r := r.(type) {
+	case *reply.BulkReply:
+		return string(r.Arg), nil
+	case *reply.StatusReply:
+		return r.Status, nil
+	case *reply.OkReply:
+		return "OK", nil
+	case *reply.PongReply:
+		return "PONG", nil
+	case *reply.IntReply:
+		return strconv.FormatInt(r.Code, 10), nil
+	case *reply.DoubleReply:
+		return reply.FormatDouble(r.Value), nil
+	case *reply.VerbatimReply:
+		return string(r.Text), nil
+	}
+	if isNull(r) {
+		return "", Nil
+	}
+	return "", makeUnexpectedReplyError(r)
+}
+
+// toInt decodes an integer, or a string holding one
+func toInt(r resp.Reply) (int64, error) {
+	if r, ok := r.(*reply.IntReply); ok {
+		return r.Code, nil
+	}
+	s, err := toString(r)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// toFloat decodes a double, or a string holding one
+func toFloat(r resp.Reply) (float64, error) {
+	if r, ok := r.(*reply.DoubleReply); ok {
+		return r.Value, nil
+	}
+	s, err := toString(r)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// toElements returns the elements of an array, the elements of a multi-bulk are bulk strings or nulls
+func toElements(r resp.Reply) ([]resp.Reply, error) {
+	switch r := r.(type) {
+	case *reply.MultiBulkReply:
+		elements := make([]resp.Reply, len(r.Args))
+		for i, arg := range r.Args {
+			if arg == nil {
+				elements[i] = reply.MakeNullBulkReply()
+			} else {
+				elements[i] = reply.MakeBulkReply(arg)
+			}
+		}
+		return elements, nil
+	case *reply.MultiRawReply:
+		return r.Replies, nil
+	case *reply.EmptyMultiBulkReply:
+		return []resp.Reply{}, nil
+	}
+	if isNull(r) {
+		return nil, Nil
+	}
+	return nil, makeUnexpectedReplyError(r)
+}
+
+// toStringSlice decodes an array of strings, the null elements are empty strings
+func toStringSlice(r resp.Reply) ([]string, error) {
+	if r, ok := r.(*reply.MultiBulkReply); ok {
+		values := make([]string, len(r.Args))
+		for i, arg := range r.Args {
+			values[i] = string(arg)
+		}
+		return values, nil
+	}
+	elements, err := toElements(r)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, len(elements))
+	for i, element := range elements {
+		if isNull(element) {
+			continue
+		}
+		if values[i], err = toString(element); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// toMap decodes an array of key value pairs, the keys are strings
+func toMap(r resp.Reply) (map[string]resp.Reply, error) {
+	elements, err := toElements(r)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]resp.Reply, len(elements)/2)
+	for i := 0; i+1 < len(elements); i += 2 {
+		key, err := toString(elements[i])
+		if err != nil {
+			return nil, err
+		}
+		values[key] = elements[i+1]
+	}
+	return values, nil
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"math/rand"
+	"net"
+	"runtime"
+	"time"
+)
+
+// Options configures a Client, the zero values are replaced by the defaults
+type Options struct {
+	Network string // "tcp" by default, or "unix" to connect to a unix socket
+	Addr    string // "localhost:6379" by default
+
+	// Dialer creates the connections if it is set, instead of dialing Network and Addr with TLSConfig
+	Dialer    func(ctx context.Context, network, addr string) (net.Conn, error)
+	TLSConfig *tls.Config // the server is dialed over tls if it is set
+
+	Username string // the user sent with AUTH, the password alone is sent if it is empty
+	Password string // AUTH is sent on connect if it is set
+	DB       int    // SELECT is sent on connect if it is not 0
+
+	DialTimeout  time.Duration // 5 seconds by default
+	ReadTimeout  time.Duration // 3 seconds by default, -1 disables it
+	WriteTimeout time.Duration // ReadTimeout by default, -1 disables it
+
+	PoolSize        int           // the most connections open at once, 10 per CPU by default
+	PoolTimeout     time.Duration // how long a command waits for a free connection, ReadTimeout + 1 second by default
+	ConnMaxIdleTime time.Duration // idle connections are closed after it, 30 minutes by default, -1 disables it
+
+	MaxRetries      int           // retries of the commands whose connection could not be dialed, 3 by default, -1 disables them
+	MinRetryBackoff time.Duration // the wait before the first retry, 8 milliseconds by default
+	MaxRetryBackoff time.Duration // the longest wait between two retries, 512 milliseconds by default
+
+	PubSubChannelSize         int           // the messages buffered by PubSub.Channel, 100 by default
+	PubSubHealthCheckInterval time.Duration // PubSub.Channel pings the server after receiving nothing for it, 3 seconds by default, -1 disables it
+}
+
+// init replaces the zero values by the defaults
+func (opts *Options) init() {
+	if opts.Network == "" {
+		opts.Network = "tcp"
+	}
+	if opts.Addr == "" {
+		opts.Addr = "localhost:6379"
+	}
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.ReadTimeout == 0 {
+		opts.ReadTimeout = 3 * time.Second
+	}
+	if opts.WriteTimeout == 0 {
+		opts.WriteTimeout = opts.ReadTimeout
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 10 * runtime.GOMAXPROCS(0)
+	}
+	if opts.PoolTimeout == 0 {
+		opts.PoolTimeout = time.Second
+		if opts.ReadTimeout > 0 {
+			opts.PoolTimeout += opts.ReadTimeout
+		}
+	}
+	if opts.ConnMaxIdleTime == 0 {
+		opts.ConnMaxIdleTime = 30 * time.Minute
+	}
+	switch {
+	case opts.MaxRetries == 0:
+		opts.MaxRetries = 3
+	case opts.MaxRetries < 0:
+		opts.MaxRetries = 0
+	}
+	if opts.MinRetryBackoff == 0 {
+		opts.MinRetryBackoff = 8 * time.Millisecond
+	}
+	if opts.MaxRetryBackoff == 0 {
+		opts.MaxRetryBackoff = 512 * time.Millisecond
+	}
+	if opts.PubSubChannelSize <= 0 {
+		opts.PubSubChannelSize = 100
+	}
+	if opts.PubSubHealthCheckInterval == 0 {
+		opts.PubSubHealthCheckInterval = 3 * time.Second
+	}
+}
+
+// retryBackoff returns the wait before a retry, it doubles at each attempt with some jitter
+func (opts *Options) retryBackoff(attempt int) time.Duration {
+	backoff := opts.MinRetryBackoff << uint(attempt-1)
+	if backoff <= 0 || backoff > opts.MaxRetryBackoff {
+		backoff = opts.MaxRetryBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
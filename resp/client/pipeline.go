@@ -0,0 +1,199 @@
+package client
+
+import (
+	"context"
+)
+
+// Pipeline queues commands and sends them in one round trip when Exec is called.
+// A transaction pipeline wraps them in MULTI and EXEC. A pipeline is not safe for concurrent use.
+type Pipeline struct {
+	cmdable
+	exec func(ctx context.Context, cmds []Cmder) error
+	cmds []Cmder
+}
+
+func makePipeline(exec func(ctx context.Context, cmds []Cmder) error) *Pipeline {
+	pipe := &Pipeline{exec: exec}
+	pipe.cmdable = pipe.Process
+	return pipe
+}
+
+// Process queues cmd, its reply is read by Exec
+func (pipe *Pipeline) Process(_ context.Context, cmd Cmder) error {
+	pipe.cmds = append(pipe.cmds, cmd)
+	return nil
+}
+
+// Len returns the number of queued commands
+func (pipe *Pipeline) Len() int {
+	return len(pipe.cmds)
+}
+
+// Discard drops the queued commands
+func (pipe *Pipeline) Discard() {
+	pipe.cmds = nil
+}
+
+// Exec sends the queued commands and reads their replies, it returns the commands and the first of their errors.
+// The pipeline is empty afterwards and may be reused.
+func (pipe *Pipeline) Exec(ctx context.Context) ([]Cmder, error) {
+	cmds := pipe.cmds
+	pipe.cmds = nil
+	if len(cmds) == 0 {
+		return cmds, nil
+	}
+	return cmds, pipe.exec(ctx, cmds)
+}
+
+// Pipelined queues the commands of fn and executes them, nothing is sent if fn fails
+func (pipe *Pipeline) Pipelined(ctx context.Context, fn func(*Pipeline) error) ([]Cmder, error) {
+	if err := fn(pipe); err != nil {
+		pipe.Discard()
+		return nil, err
+	}
+	return pipe.Exec(ctx)
+}
+
+// txRoundTrip sends pre and MULTI, then cmds and EXEC, and gives each command its reply from the EXEC array.
+// The commands are only sent once MULTI is accepted: a server without transactions would execute them one by one.
+func txRoundTrip(ctx context.Context, cn *conn, opts *Options, pre []Cmder, cmds []Cmder) error {
+	multi := NewStatusCmd("multi")
+	exec := NewCmd("exec")
+	begin := make([]Cmder, 0, len(pre)+1)
+	begin = append(begin, pre...)
+	begin = append(begin, multi)
+	if err := cn.writeCommands(ctx, opts.WriteTimeout, begin); err != nil {
+		return err
+	}
+	if err := cn.readReplies(ctx, opts.ReadTimeout, begin); err != nil {
+		return err
+	}
+	if err := multi.Err(); err != nil {
+		setCmdsErr(cmds, err)
+		return nil
+	}
+
+	all := make([]Cmder, 0, len(cmds)+1)
+	all = append(all, cmds...)
+	all = append(all, exec)
+	if err := cn.writeCommands(ctx, opts.WriteTimeout, all); err != nil {
+		return err
+	}
+	// the commands reply QUEUED, or the error which aborts the transaction
+	queued := make([]Cmder, len(cmds))
+	for i := range cmds {
+		queued[i] = NewStatusCmd()
+	}
+	if err := cn.readReplies(ctx, opts.ReadTimeout, queued); err != nil {
+		return err
+	}
+	for i, cmd := range cmds {
+		if err := queued[i].Err(); err != nil {
+			cmd.setReply(queued[i].Reply())
+		}
+	}
+	if err := cn.readReplies(ctx, opts.ReadTimeout, []Cmder{exec}); err != nil {
+		return err
+	}
+	switch exec.Err() {
+	case nil:
+	case Nil: // a watched key changed
+		setCmdsErr(cmds, TxFailedErr)
+		return nil
+	default: // EXECABORT, the commands which were queued are discarded with the error
+		setCmdsErr(cmds, exec.Err())
+		return nil
+	}
+	replies, err := toElements(exec.Reply())
+	if err != nil {
+		return err
+	}
+	if len(replies) != len(cmds) {
+		cn.broken = true
+		return makeUnexpectedReplyError(exec.Reply())
+	}
+	for i, cmd := range cmds {
+		cmd.setReply(replies[i])
+		cn.trackSelect(cmd)
+	}
+	return nil
+}
+
+// Conn is a connection reserved for its caller, the commands changing the state of the connection
+// like SELECT or WATCH last until it is closed. It is not safe for concurrent use.
+type Conn struct {
+	cmdable
+	client   *Client
+	cn       *conn
+	watching bool // WATCH was sent, the keys are unwatched when the connection is closed
+}
+
+// Process executes cmd on the reserved connection, it is dialed by the first command
+func (conn *Conn) Process(ctx context.Context, cmd Cmder) error {
+	_ = conn.processCommands(ctx, []Cmder{cmd}, false)
+	return cmd.Err()
+}
+
+// Pipeline returns a pipeline sending its commands on the reserved connection
+func (conn *Conn) Pipeline() *Pipeline {
+	return makePipeline(func(ctx context.Context, cmds []Cmder) error {
+		return conn.processCommands(ctx, cmds, false)
+	})
+}
+
+// TxPipeline returns a transaction pipeline sending its commands on the reserved connection
+func (conn *Conn) TxPipeline() *Pipeline {
+	return makePipeline(func(ctx context.Context, cmds []Cmder) error {
+		return conn.processCommands(ctx, cmds, true)
+	})
+}
+
+// TxPipelined queues the commands of fn in a transaction and executes it on the reserved connection
+func (conn *Conn) TxPipelined(ctx context.Context, fn func(*Pipeline) error) ([]Cmder, error) {
+	return conn.TxPipeline().Pipelined(ctx, fn)
+}
+
+// processCommands executes cmds on the reserved connection, they are not retried since the state of a new connection differs
+func (conn *Conn) processCommands(ctx context.Context, cmds []Cmder, tx bool) error {
+	if conn.cn == nil {
+		cn, err := conn.client.pool.get(ctx)
+		if err != nil {
+			setCmdsErr(cmds, err)
+			return err
+		}
+		conn.cn = cn
+	}
+	for _, cmd := range cmds {
+		if cmd.Name() == "watch" {
+			conn.watching = true
+		}
+	}
+	var err error
+	if tx {
+		err = txRoundTrip(ctx, conn.cn, conn.client.opts, nil, cmds)
+	} else if err = conn.cn.writeCommands(ctx, conn.client.opts.WriteTimeout, cmds); err == nil {
+		err = conn.cn.readReplies(ctx, conn.client.opts.ReadTimeout, cmds)
+	}
+	if conn.cn.broken {
+		conn.client.pool.put(conn.cn)
+		conn.cn = nil
+	}
+	if err != nil {
+		setCmdsErr(cmds, err)
+		return err
+	}
+	return firstCmdsErr(cmds)
+}
+
+// Close returns the connection to the pool of the client, after unwatching the keys watched
+func (conn *Conn) Close() error {
+	if conn.cn != nil && conn.watching {
+		_ = conn.Process(context.Background(), NewStatusCmd("unwatch"))
+	}
+	conn.watching = false
+	if conn.cn != nil {
+		conn.client.pool.put(conn.cn)
+		conn.cn = nil
+	}
+	return nil
+}
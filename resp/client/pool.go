@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by the commands of a closed client
+var ErrClosed = errors.New("redis: client is closed")
+
+// ErrPoolTimeout is returned when no connection got free within the pool timeout
+var ErrPoolTimeout = errors.New("redis: connection pool timeout")
+
+// connPool holds the idle connections to the server, and bounds the number of connections open at once
+type connPool struct {
+	opts   *Options
+	tokens chan struct{} // one token per connection in use
+
+	mutex  sync.Mutex
+	idle   []*conn // the most recently used connection is the last one
+	closed bool
+}
+
+func makeConnPool(opts *Options) *connPool {
+	return &connPool{
+		opts:   opts,
+		tokens: make(chan struct{}, opts.PoolSize),
+	}
+}
+
+// get returns an idle connection still open, or dials a new one if there is none
+func (pool *connPool) get(ctx context.Context) (*conn, error) {
+	if err := pool.acquire(ctx); err != nil {
+		return nil, err
+	}
+	for {
+		pool.mutex.Lock()
+		if pool.closed {
+			pool.mutex.Unlock()
+			pool.release()
+			return nil, ErrClosed
+		}
+		if len(pool.idle) == 0 {
+			pool.mutex.Unlock()
+			break
+		}
+		cn := pool.idle[len(pool.idle)-1]
+		pool.idle = pool.idle[:len(pool.idle)-1]
+		pool.mutex.Unlock()
+		if pool.opts.ConnMaxIdleTime > 0 && time.Since(cn.usedAt) > pool.opts.ConnMaxIdleTime {
+			_ = cn.close()
+			continue
+		}
+		// e.g. the server closed it after its idle timeout, a command written to it would fail
+		if !cn.isAlive() {
+			_ = cn.close()
+			continue
+		}
+		return cn, nil
+	}
+	cn, err := pool.dial(ctx)
+	if err != nil {
+		pool.release()
+		return nil, err
+	}
+	return cn, nil
+}
+
+// acquire waits for a connection to get free, until the pool timeout or the end of ctx
+func (pool *connPool) acquire(ctx context.Context) error {
+	select {
+	case pool.tokens <- struct{}{}:
+		return nil
+	default:
+	}
+	timer := time.NewTimer(pool.opts.PoolTimeout)
+	defer timer.Stop()
+	select {
+	case pool.tokens <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return ErrPoolTimeout
+	}
+}
+
+func (pool *connPool) release() {
+	<-pool.tokens
+}
+
+// put returns a connection to the pool, a broken one is closed
+func (pool *connPool) put(cn *conn) {
+	defer pool.release()
+	if cn.broken {
+		_ = cn.close()
+		return
+	}
+	cn.usedAt = time.Now()
+	pool.mutex.Lock()
+	if pool.closed {
+		pool.mutex.Unlock()
+		_ = cn.close()
+		return
+	}
+	pool.idle = append(pool.idle, cn)
+	pool.mutex.Unlock()
+}
+
+// dial connects to the server, then authenticates and selects the database
+func (pool *connPool) dial(ctx context.Context) (*conn, error) {
+	opts := pool.opts
+	dialCtx, cancel := context.WithTimeout(ctx, opts.DialTimeout)
+	defer cancel()
+	var netConn net.Conn
+	var err error
+	switch {
+	case opts.Dialer != nil:
+		netConn, err = opts.Dialer(dialCtx, opts.Network, opts.Addr)
+	case opts.TLSConfig != nil:
+		dialer := &tls.Dialer{Config: opts.TLSConfig}
+		netConn, err = dialer.DialContext(dialCtx, opts.Network, opts.Addr)
+	default:
+		dialer := &net.Dialer{}
+		netConn, err = dialer.DialContext(dialCtx, opts.Network, opts.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cn := makeConn(netConn)
+	var cmds []Cmder
+	if opts.Password != "" {
+		if opts.Username != "" {
+			cmds = append(cmds, NewStatusCmd("auth", opts.Username, opts.Password))
+		} else {
+			cmds = append(cmds, NewStatusCmd("auth", opts.Password))
+		}
+	}
+	if opts.DB != 0 {
+		cmds = append(cmds, NewStatusCmd("select", opts.DB))
+	}
+	if len(cmds) > 0 {
+		err = cn.writeCommands(ctx, opts.WriteTimeout, cmds)
+		if err == nil {
+			err = cn.readReplies(ctx, opts.ReadTimeout, cmds)
+		}
+		for i := 0; err == nil && i < len(cmds); i++ {
+			err = cmds[i].Err()
+		}
+		if err != nil {
+			_ = cn.close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// close closes the idle connections, the ones in use are closed when they are returned
+func (pool *connPool) close() error {
+	pool.mutex.Lock()
+	if pool.closed {
+		pool.mutex.Unlock()
+		return ErrClosed
+	}
+	pool.closed = true
+	idle := pool.idle
+	pool.idle = nil
+	pool.mutex.Unlock()
+	var firstErr error
+	for _, cn := range idle {
+		if err := cn.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,438 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"go-redis/interface/resp"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a message published to a channel the PubSub listens to
+type Message struct {
+	Channel string
+	Pattern string // the pattern the channel matched, for the messages of PSUBSCRIBE
+	Payload string
+}
+
+// Subscription is the confirmation of a subscribe or an unsubscribe
+type Subscription struct {
+	Kind    string // subscribe, unsubscribe, psubscribe, punsubscribe, ssubscribe or sunsubscribe
+	Channel string
+	Count   int // the subscriptions left on the connection
+}
+
+// Pong is the reply of a PING sent by a PubSub
+type Pong struct {
+	Payload string
+}
+
+// PubSub is a connection dedicated to pub/sub, outside of the pool since the server pushes it messages at any time.
+// A new connection is dialed after a network error and subscribes again to every channel and pattern.
+// Subscribing and pinging are safe for concurrent use, but only one goroutine may receive.
+type PubSub struct {
+	opts *Options
+	dial func(ctx context.Context) (*conn, error)
+
+	mutex         sync.Mutex // guards cn, closed and the subscriptions, the commands are written under it
+	cn            *conn
+	closed        bool
+	channels      map[string]bool
+	patterns      map[string]bool
+	shardChannels map[string]bool
+
+	ctx         context.Context // canceled by Close, it ends the goroutines of Channel
+	cancel      context.CancelFunc
+	channelOnce sync.Once
+	messages    chan *Message
+	received    chan struct{} // signaled by the receiving goroutine of Channel, so the health check does not ping
+}
+
+func (client *Client) newPubSub() *PubSub {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &PubSub{
+		opts:          client.opts,
+		dial:          client.pool.dial,
+		channels:      make(map[string]bool),
+		patterns:      make(map[string]bool),
+		shardChannels: make(map[string]bool),
+		ctx:           ctx,
+		cancel:        cancel,
+		received:      make(chan struct{}, 1),
+	}
+}
+
+// Subscribe returns a PubSub listening to the channels, the error of the subscription is returned by its Receive
+func (client *Client) Subscribe(ctx context.Context, channels ...string) *PubSub {
+	ps := client.newPubSub()
+	if len(channels) > 0 {
+		_ = ps.Subscribe(ctx, channels...)
+	}
+	return ps
+}
+
+// PSubscribe returns a PubSub listening to the channels matching the patterns
+func (client *Client) PSubscribe(ctx context.Context, patterns ...string) *PubSub {
+	ps := client.newPubSub()
+	if len(patterns) > 0 {
+		_ = ps.PSubscribe(ctx, patterns...)
+	}
+	return ps
+}
+
+// SSubscribe returns a PubSub listening to the shard channels, they must be owned by the node of the client
+func (client *Client) SSubscribe(ctx context.Context, channels ...string) *PubSub {
+	ps := client.newPubSub()
+	if len(channels) > 0 {
+		_ = ps.SSubscribe(ctx, channels...)
+	}
+	return ps
+}
+
+// Subscribe listens to more channels
+func (ps *PubSub) Subscribe(ctx context.Context, channels ...string) error {
+	return ps.subscribe(ctx, "subscribe", ps.channels, channels)
+}
+
+// PSubscribe listens to the channels matching more patterns
+func (ps *PubSub) PSubscribe(ctx context.Context, patterns ...string) error {
+	return ps.subscribe(ctx, "psubscribe", ps.patterns, patterns)
+}
+
+// SSubscribe listens to more shard channels
+func (ps *PubSub) SSubscribe(ctx context.Context, channels ...string) error {
+	return ps.subscribe(ctx, "ssubscribe", ps.shardChannels, channels)
+}
+
+// Unsubscribe stops listening to the channels, or to every channel if none is given
+func (ps *PubSub) Unsubscribe(ctx context.Context, channels ...string) error {
+	return ps.unsubscribe(ctx, "unsubscribe", ps.channels, channels)
+}
+
+// PUnsubscribe stops listening to the patterns, or to every pattern if none is given
+func (ps *PubSub) PUnsubscribe(ctx context.Context, patterns ...string) error {
+	return ps.unsubscribe(ctx, "punsubscribe", ps.patterns, patterns)
+}
+
+// SUnsubscribe stops listening to the shard channels, or to every shard channel if none is given
+func (ps *PubSub) SUnsubscribe(ctx context.Context, channels ...string) error {
+	return ps.unsubscribe(ctx, "sunsubscribe", ps.shardChannels, channels)
+}
+
+// Ping sends a PING, its Pong is received like the messages
+func (ps *PubSub) Ping(ctx context.Context, payload ...string) error {
+	args := []interface{}{"ping"}
+	if len(payload) > 0 {
+		args = append(args, payload[0])
+	}
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	cn, err := ps.getConn(ctx)
+	if err != nil {
+		return err
+	}
+	return ps.write(ctx, cn, NewCmd(args...))
+}
+
+// subscribe remembers the names even if they can not be sent, so the next connection subscribes to them
+func (ps *PubSub) subscribe(ctx context.Context, kind string, subscriptions map[string]bool, names []string) error {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	// a new connection subscribes to what was remembered before, so the names are added after it is dialed
+	cn, err := ps.getConn(ctx)
+	for _, name := range names {
+		subscriptions[name] = true
+	}
+	if err != nil {
+		return err
+	}
+	return ps.write(ctx, cn, NewCmd(kind, names))
+}
+
+// unsubscribe forgets the names, the server is only told if a connection is open
+func (ps *PubSub) unsubscribe(ctx context.Context, kind string, subscriptions map[string]bool, names []string) error {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	if len(names) == 0 {
+		for name := range subscriptions {
+			delete(subscriptions, name)
+		}
+	}
+	for _, name := range names {
+		delete(subscriptions, name)
+	}
+	if ps.closed {
+		return ErrClosed
+	}
+	if ps.cn == nil {
+		return nil
+	}
+	return ps.write(ctx, ps.cn, NewCmd(kind, names))
+}
+
+// getConn returns the connection, a new one is dialed and subscribes again if there is none.
+// The caller must hold mutex.
+func (ps *PubSub) getConn(ctx context.Context) (*conn, error) {
+	if ps.closed {
+		return nil, ErrClosed
+	}
+	if ps.cn != nil {
+		return ps.cn, nil
+	}
+	cn, err := ps.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var cmds []Cmder
+	for kind, subscriptions := range map[string]map[string]bool{
+		"subscribe":  ps.channels,
+		"psubscribe": ps.patterns,
+		"ssubscribe": ps.shardChannels,
+	} {
+		if len(subscriptions) == 0 {
+			continue
+		}
+		names := make([]string, 0, len(subscriptions))
+		for name := range subscriptions {
+			names = append(names, name)
+		}
+		cmds = append(cmds, NewCmd(kind, names))
+	}
+	if len(cmds) > 0 {
+		// the confirmations are received like the messages
+		if err := cn.writeCommands(ctx, ps.opts.WriteTimeout, cmds); err != nil {
+			_ = cn.close()
+			return nil, err
+		}
+	}
+	ps.cn = cn
+	return cn, nil
+}
+
+// write sends cmd, the connection is dropped if it fails. The caller must hold mutex.
+func (ps *PubSub) write(ctx context.Context, cn *conn, cmd Cmder) error {
+	if err := cn.writeCommands(ctx, ps.opts.WriteTimeout, []Cmder{cmd}); err != nil {
+		ps.dropConn(cn)
+		return err
+	}
+	return nil
+}
+
+// dropConn closes cn if it is still the connection, the next use dials a new one.
+// The caller must hold mutex.
+func (ps *PubSub) dropConn(cn *conn) {
+	if ps.cn != cn {
+		return
+	}
+	ps.cn = nil
+	// the parser is not released, the receiving goroutine may still be reading with it
+	_ = cn.netConn.Close()
+}
+
+// Receive waits for the next push of the server: a *Subscription, a *Message or a *Pong
+func (ps *PubSub) Receive(ctx context.Context) (interface{}, error) {
+	return ps.ReceiveTimeout(ctx, 0)
+}
+
+// ReceiveTimeout waits for the next push of the server for at most timeout, 0 waits until ctx ends.
+// A network error other than the timeout drops the connection, the next call dials a new one.
+func (ps *PubSub) ReceiveTimeout(ctx context.Context, timeout time.Duration) (interface{}, error) {
+	_, push, err := ps.receive(ctx, timeout)
+	return push, err
+}
+
+// ReceiveMessage waits for the next message, the confirmations and pongs are skipped
+func (ps *PubSub) ReceiveMessage(ctx context.Context) (*Message, error) {
+	for {
+		push, err := ps.Receive(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if msg, ok := push.(*Message); ok {
+			return msg, nil
+		}
+	}
+}
+
+// receive reads the next push and decodes it, it returns the connection it was read from
+func (ps *PubSub) receive(ctx context.Context, timeout time.Duration) (*conn, interface{}, error) {
+	ps.mutex.Lock()
+	cn, err := ps.getConn(ctx)
+	ps.mutex.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cn.netConn.SetReadDeadline(deadline(ctx, timeout)); err != nil {
+		return cn, nil, err
+	}
+	r, err := cn.parser.ReadReply()
+	if err != nil {
+		ps.mutex.Lock()
+		closed := ps.closed
+		if !isTimeout(err) {
+			ps.dropConn(cn)
+		}
+		ps.mutex.Unlock()
+		if closed {
+			return cn, nil, ErrClosed
+		}
+		return cn, nil, err
+	}
+	push, err := decodePush(r)
+	return cn, push, err
+}
+
+// isTimeout returns true for the error of a read which reached its deadline
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// decodePush decodes a push of the server, an error reply is returned as an Error
+func decodePush(r resp.Reply) (interface{}, error) {
+	if errorReply, ok := r.(resp.ErrorReply); ok {
+		return nil, Error(errorReply.Error())
+	}
+	if status, err := toString(r); err == nil && strings.EqualFold(status, "pong") {
+		// the server was not in subscribe mode yet
+		return &Pong{}, nil
+	}
+	elements, err := toElements(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(elements) < 2 {
+		return nil, makeUnexpectedReplyError(r)
+	}
+	values := make([]string, len(elements)-1)
+	for i, element := range elements[:len(elements)-1] {
+		// the channel of an unsubscribe from nothing is null
+		if values[i], err = toString(element); err != nil && err != Nil {
+			return nil, err
+		}
+	}
+	last := elements[len(elements)-1]
+	switch kind := strings.ToLower(values[0]); kind {
+	case "subscribe", "unsubscribe", "psubscribe", "punsubscribe", "ssubscribe", "sunsubscribe":
+		count, err := toInt(last)
+		if err != nil || len(elements) != 3 {
+			return nil, makeUnexpectedReplyError(r)
+		}
+		return &Subscription{Kind: kind, Channel: values[1], Count: int(count)}, nil
+	case "message", "smessage":
+		payload, err := toString(last)
+		if err != nil || len(elements) != 3 {
+			return nil, makeUnexpectedReplyError(r)
+		}
+		return &Message{Channel: values[1], Payload: payload}, nil
+	case "pmessage":
+		payload, err := toString(last)
+		if err != nil || len(elements) != 4 {
+			return nil, makeUnexpectedReplyError(r)
+		}
+		return &Message{Pattern: values[1], Channel: values[2], Payload: payload}, nil
+	case "pong":
+		payload, err := toString(last)
+		if err != nil || len(elements) != 2 {
+			return nil, makeUnexpectedReplyError(r)
+		}
+		return &Pong{Payload: payload}, nil
+	}
+	return nil, makeUnexpectedReplyError(r)
+}
+
+// Channel returns a channel receiving the messages, it is closed when the PubSub is closed.
+// The server is pinged when nothing came for PubSubHealthCheckInterval, the connection is dropped and dialed again
+// if even the pong does not come within ReadTimeout.
+func (ps *PubSub) Channel() <-chan *Message {
+	ps.channelOnce.Do(func() {
+		ps.messages = make(chan *Message, ps.opts.PubSubChannelSize)
+		if ps.opts.PubSubHealthCheckInterval > 0 {
+			go ps.healthCheck()
+		}
+		go ps.receiveMessages()
+	})
+	return ps.messages
+}
+
+// healthCheck pings the server whenever nothing was received for the health check interval
+func (ps *PubSub) healthCheck() {
+	timer := time.NewTimer(ps.opts.PubSubHealthCheckInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ps.received:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-timer.C:
+			_ = ps.Ping(ps.ctx)
+		case <-ps.ctx.Done():
+			return
+		}
+		timer.Reset(ps.opts.PubSubHealthCheckInterval)
+	}
+}
+
+// receiveMessages passes the messages to the channel until the PubSub is closed, it dials again after a network error
+func (ps *PubSub) receiveMessages() {
+	defer close(ps.messages)
+	var timeout time.Duration
+	if ps.opts.PubSubHealthCheckInterval > 0 {
+		// the health check pings once nothing came for the interval, so the pong is late after this
+		timeout = ps.opts.PubSubHealthCheckInterval
+		if ps.opts.ReadTimeout > 0 {
+			timeout += ps.opts.ReadTimeout
+		}
+	}
+	failures := 0
+	for {
+		cn, push, err := ps.receive(ps.ctx, timeout)
+		if err != nil {
+			if ps.ctx.Err() != nil || errors.Is(err, ErrClosed) {
+				return
+			}
+			if cn != nil && isTimeout(err) {
+				ps.mutex.Lock()
+				ps.dropConn(cn)
+				ps.mutex.Unlock()
+			}
+			failures++
+			if sleep(ps.ctx, ps.opts.retryBackoff(failures)) != nil {
+				return
+			}
+			continue
+		}
+		failures = 0
+		select {
+		case ps.received <- struct{}{}:
+		default:
+		}
+		if msg, ok := push.(*Message); ok {
+			select {
+			case ps.messages <- msg:
+			case <-ps.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// Close unsubscribes by closing the connection, and closes the channel of the messages
+func (ps *PubSub) Close() error {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	if ps.closed {
+		return ErrClosed
+	}
+	ps.closed = true
+	ps.cancel()
+	if ps.cn != nil {
+		cn := ps.cn
+		ps.cn = nil
+		return cn.netConn.Close()
+	}
+	return nil
+}
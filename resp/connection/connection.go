@@ -1,23 +1,65 @@
 package connection
 
 import (
+	"errors"
+	"go-redis/interface/resp"
+	"go-redis/lib/stats"
+	"go-redis/lib/sync/atomic"
 	"go-redis/lib/sync/wait"
 	"net"
 	"sync"
+	stdatomic "sync/atomic"
 	"time"
 )
 
+// nextID is the id of the last connection created
+var nextID int64
+
+// errOutputLimitReached is returned by the writes to a client closed for crossing its output buffer limit
+var errOutputLimitReached = errors.New("client reached its output buffer limit")
+
+// outputBufferSize is the size of the buffered replies flushed without waiting for the input to run dry
+const outputBufferSize = 16 * 1024
+
 type Connection struct {
 	connection   net.Conn   // connection instance
 	waitingReply wait.Wait  // WaitGroup with timeout feature
-	mutex        sync.Mutex // Mutex Lock
+	mutex        sync.Mutex // Mutex Lock, guards the output
 	selectedDB   int        // DB index
 	password     string     // login pass
+
+	output             []byte              // replies waiting to be written
+	spare              []byte              // the buffer written last, reused for the next output
+	writing            int                 // the size of the output being written
+	flushing           bool                // a goroutine is writing the output
+	outputLimits       *OutputBufferLimits // checked whenever the output grows, nil means no limit
+	stats              *stats.Stats        // counts the disconnections caused by outputLimits
+	softLimitSince     time.Time           // when the output crossed the soft limit, zero if it is below
+	outputLimitReached bool                // the output crossed its limit, the connection is closed
+
+	subs     map[string]struct{} // subscribed pub/sub channels
+	psubs    map[string]struct{} // subscribed pub/sub patterns
+	ssubs    map[string]struct{} // subscribed shard channels
+	subsLock sync.Mutex
+
+	id              int64           // unique id reported by CLIENT ID
+	name            string          // set by CLIENT SETNAME
+	createdAt       time.Time       // when the connection was accepted
+	lastInteraction int64           // unix nano of the last command
+	lastCommand     stdatomic.Value // name of the last command
+	blocked         atomic.Boolean  // waiting in a blocking command
+	protocol        int32           // RESP version negotiated by HELLO, 0 means RESP2
 }
 
 // NewConnection creates a new instance of Connection
 func NewConnection(conn net.Conn) *Connection {
-	return &Connection{connection: conn}
+	now := time.Now()
+	return &Connection{
+		connection:      conn,
+		id:              stdatomic.AddInt64(&nextID, 1),
+		createdAt:       now,
+		lastInteraction: now.UnixNano(),
+	}
 }
 
 // RemoteAddress returns the remote address
@@ -25,19 +67,75 @@ func (c *Connection) RemoteAddress() net.Addr {
 	return c.connection.RemoteAddr()
 }
 
-// Write writes data to the connection and increments the waitingReply counter
+// Write sends data to the client after the replies buffered before, without waiting for it to be written.
+// It returns an error if the client crossed its output buffer limit.
 func (c *Connection) Write(bytes []byte) error {
 	if len(bytes) == 0 {
 		return nil
 	}
 	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.queue(bytes) {
+		return errOutputLimitReached
+	}
+	c.startDrain()
+	return nil
+}
+
+// WriteBuffered appends data to the output, it is sent by Flush or once the output is bigger than outputBufferSize
+func (c *Connection) WriteBuffered(bytes []byte) error {
+	if len(bytes) == 0 {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.queue(bytes) {
+		return errOutputLimitReached
+	}
+	if len(c.output) >= outputBufferSize {
+		c.startDrain()
+	}
+	return nil
+}
+
+// WriteBufferedReply encodes r in the protocol of the client straight into the output, it is sent like WriteBuffered
+func (c *Connection) WriteBufferedReply(r resp.Reply) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.queueReply(r) {
+		return errOutputLimitReached
+	}
+	if len(c.output) >= outputBufferSize {
+		c.startDrain()
+	}
+	return nil
+}
+
+// Flush starts writing the buffered replies without waiting for them to be written,
+// so a client which does not read its replies can not block the goroutine serving its commands.
+// Its output grows instead, until it crosses its output buffer limit.
+func (c *Connection) Flush() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.outputLimitReached {
+		return errOutputLimitReached
+	}
+	c.startDrain()
+	return nil
+}
+
+// startDrain writes the output in another goroutine, unless one is already writing it.
+// It must be called with the mutex held.
+func (c *Connection) startDrain() {
+	if c.flushing || len(c.output) == 0 {
+		return
+	}
+	c.flushing = true
+	// counted before the goroutine starts, so Close waits for it
 	c.waitingReply.Add(1)
-	defer func() {
-		c.waitingReply.Done()
-		c.mutex.Unlock()
+	go func() {
+		_ = c.drain()
 	}()
-	_, err := c.connection.Write(bytes)
-	return err
 }
 
 // GetDBIndex returns the DB index
@@ -60,8 +158,194 @@ func (c *Connection) GetPassword() string {
 	return c.password
 }
 
-// Close closes the connection while timeout
+// Subscribe adds the channel to the subscriptions of the connection
+func (c *Connection) Subscribe(channel string) {
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+	if c.subs == nil {
+		c.subs = make(map[string]struct{})
+	}
+	c.subs[channel] = struct{}{}
+}
+
+// UnSubscribe removes the channel from the subscriptions of the connection
+func (c *Connection) UnSubscribe(channel string) {
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+	delete(c.subs, channel)
+}
+
+// PSubscribe adds the pattern to the subscriptions of the connection
+func (c *Connection) PSubscribe(pattern string) {
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+	if c.psubs == nil {
+		c.psubs = make(map[string]struct{})
+	}
+	c.psubs[pattern] = struct{}{}
+}
+
+// PUnSubscribe removes the pattern from the subscriptions of the connection
+func (c *Connection) PUnSubscribe(pattern string) {
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+	delete(c.psubs, pattern)
+}
+
+// SSubscribe adds the shard channel to the subscriptions of the connection
+func (c *Connection) SSubscribe(channel string) {
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+	if c.ssubs == nil {
+		c.ssubs = make(map[string]struct{})
+	}
+	c.ssubs[channel] = struct{}{}
+}
+
+// SUnSubscribe removes the shard channel from the subscriptions of the connection
+func (c *Connection) SUnSubscribe(channel string) {
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+	delete(c.ssubs, channel)
+}
+
+// SubsCount returns the number of subscribed channels and patterns
+func (c *Connection) SubsCount() int {
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+	return len(c.subs) + len(c.psubs)
+}
+
+// GetChannels returns the subscribed channels
+func (c *Connection) GetChannels() []string {
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+	channels := make([]string, 0, len(c.subs))
+	for channel := range c.subs {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// ShardSubsCount returns the number of subscribed shard channels
+func (c *Connection) ShardSubsCount() int {
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+	return len(c.ssubs)
+}
+
+// GetShardChannels returns the subscribed shard channels
+func (c *Connection) GetShardChannels() []string {
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+	channels := make([]string, 0, len(c.ssubs))
+	for channel := range c.ssubs {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// GetPatterns returns the subscribed patterns
+func (c *Connection) GetPatterns() []string {
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+	patterns := make([]string, 0, len(c.psubs))
+	for pattern := range c.psubs {
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// GetID returns the unique id of the connection
+func (c *Connection) GetID() int64 {
+	return c.id
+}
+
+// SetName sets the name of the connection
+func (c *Connection) SetName(name string) {
+	c.name = name
+}
+
+// GetName returns the name of the connection
+func (c *Connection) GetName() string {
+	return c.name
+}
+
+// RemoteAddr returns the remote address as a string, it is empty for a fake connection.
+// Unix socket clients have no address, the path of the socket is returned like redis does.
+func (c *Connection) RemoteAddr() string {
+	if c.connection == nil {
+		return ""
+	}
+	if c.IsUnixSocket() {
+		return c.connection.LocalAddr().String() + ":0"
+	}
+	return c.connection.RemoteAddr().String()
+}
+
+// IsUnixSocket returns whether the client is connected through a unix socket
+func (c *Connection) IsUnixSocket() bool {
+	if c.connection == nil {
+		return false
+	}
+	_, ok := c.connection.LocalAddr().(*net.UnixAddr)
+	return ok
+}
+
+// GetCreatedAt returns when the connection was accepted
+func (c *Connection) GetCreatedAt() time.Time {
+	return c.createdAt
+}
+
+// MarkCommand records the command the connection is about to execute
+func (c *Connection) MarkCommand(name string) {
+	c.lastCommand.Store(name)
+	stdatomic.StoreInt64(&c.lastInteraction, time.Now().UnixNano())
+}
+
+// GetLastInteraction returns when the connection sent its last command
+func (c *Connection) GetLastInteraction() time.Time {
+	return time.Unix(0, stdatomic.LoadInt64(&c.lastInteraction))
+}
+
+// GetLastCommand returns the name of the last command
+func (c *Connection) GetLastCommand() string {
+	name, _ := c.lastCommand.Load().(string)
+	return name
+}
+
+// SetBlocked marks whether the connection waits in a blocking command
+func (c *Connection) SetBlocked(blocked bool) {
+	c.blocked.Set(blocked)
+}
+
+// IsBlocked returns true if the connection waits in a blocking command
+func (c *Connection) IsBlocked() bool {
+	return c.blocked.Get()
+}
+
+// SetProtocol sets the RESP version of the connection
+func (c *Connection) SetProtocol(protocol int) {
+	stdatomic.StoreInt32(&c.protocol, int32(protocol))
+}
+
+// GetProtocol returns the RESP version of the connection
+func (c *Connection) GetProtocol() int {
+	if protocol := stdatomic.LoadInt32(&c.protocol); protocol != 0 {
+		return int(protocol)
+	}
+	return 2
+}
+
+// CloseConn closes the underlying connection at once, without sending the buffered replies.
+// The handler of the client notices the closed connection and releases it.
+func (c *Connection) CloseConn() {
+	_ = c.connection.Close()
+}
+
+// Close sends the buffered replies, waiting for them while timeout, then closes the connection
 func (c *Connection) Close() error {
+	_ = c.Flush()
 	c.waitingReply.WaitWithTimeout(10 * 1000 * time.Millisecond)
 	// no need to return error while the connection is closed
 	_ = c.connection.Close()
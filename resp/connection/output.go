@@ -0,0 +1,139 @@
+package connection
+
+import (
+	"go-redis/interface/resp"
+	"go-redis/lib/logger"
+	"go-redis/lib/stats"
+	"go-redis/resp/reply"
+	"strconv"
+	"time"
+)
+
+// OutputBufferLimit limits the output buffered for a class of clients.
+// A client is closed once its output reaches Hard, or stays above Soft for longer than SoftSeconds.
+// A zero limit is disabled.
+type OutputBufferLimit struct {
+	Hard        int64
+	Soft        int64
+	SoftSeconds time.Duration
+}
+
+// OutputBufferLimits are the limits of each class of clients, set by client-output-buffer-limit
+type OutputBufferLimits struct {
+	Normal  OutputBufferLimit
+	Replica OutputBufferLimit
+	PubSub  OutputBufferLimit
+}
+
+// DefaultOutputBufferLimits are the limits used by redis when client-output-buffer-limit is unset
+var DefaultOutputBufferLimits = OutputBufferLimits{
+	Replica: OutputBufferLimit{Hard: 256 * 1024 * 1024, Soft: 64 * 1024 * 1024, SoftSeconds: 60 * time.Second},
+	PubSub:  OutputBufferLimit{Hard: 32 * 1024 * 1024, Soft: 8 * 1024 * 1024, SoftSeconds: 60 * time.Second},
+}
+
+// SetOutputBufferLimits sets the limits the output of the connection is checked against,
+// the disconnections they cause are counted in counters
+func (c *Connection) SetOutputBufferLimits(limits *OutputBufferLimits, counters *stats.Stats) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.outputLimits = limits
+	c.stats = counters
+}
+
+// outputLimit returns the limit of the class of the client, there is no replica in go-redis yet
+func (c *Connection) outputLimit() OutputBufferLimit {
+	if c.outputLimits == nil {
+		return OutputBufferLimit{}
+	}
+	if c.SubsCount() > 0 || c.ShardSubsCount() > 0 {
+		return c.outputLimits.PubSub
+	}
+	return c.outputLimits.Normal
+}
+
+// queue appends data to the output, it must be called with the mutex held.
+// It returns false if the output crossed its limit, then the connection is closed and the output dropped.
+func (c *Connection) queue(data []byte) bool {
+	if c.outputLimitReached {
+		return false
+	}
+	c.output = append(c.output, data...)
+	return c.checkOutputLimit()
+}
+
+// queueReply encodes r at the end of the output, like queue
+func (c *Connection) queueReply(r resp.Reply) bool {
+	if c.outputLimitReached {
+		return false
+	}
+	c.output = reply.AppendEncode(c.output, r, c.GetProtocol())
+	return c.checkOutputLimit()
+}
+
+// checkOutputLimit returns false and closes the connection if the output crossed its limit
+func (c *Connection) checkOutputLimit() bool {
+	size := int64(len(c.output) + c.writing)
+	limit := c.outputLimit()
+	reached := limit.Hard > 0 && size >= limit.Hard
+	if limit.Soft > 0 && size >= limit.Soft {
+		now := time.Now()
+		if c.softLimitSince.IsZero() {
+			c.softLimitSince = now
+		} else if now.Sub(c.softLimitSince) > limit.SoftSeconds {
+			reached = true
+		}
+	} else {
+		c.softLimitSince = time.Time{}
+	}
+	if !reached {
+		return true
+	}
+	c.outputLimitReached = true
+	c.output = nil
+	if c.stats != nil {
+		c.stats.IncrOutputBufferLimitDisconnections()
+	}
+	logger.Warn("Client id=" + strconv.FormatInt(c.id, 10) + " addr=" + c.RemoteAddr() +
+		" closed for overcoming of output buffer limits.")
+	// the handler of the client notices the closed connection and releases it
+	go func() {
+		_ = c.connection.Close()
+	}()
+	return false
+}
+
+// drain writes the output until it is empty, only the goroutine which set flushing calls it,
+// after adding itself to waitingReply
+func (c *Connection) drain() error {
+	defer c.waitingReply.Done()
+	for {
+		c.mutex.Lock()
+		if len(c.output) == 0 || c.outputLimitReached {
+			c.flushing = false
+			c.mutex.Unlock()
+			return nil
+		}
+		data := c.output
+		c.output = c.spare[:0]
+		c.writing = len(data)
+		c.mutex.Unlock()
+
+		_, err := c.connection.Write(data)
+
+		c.mutex.Lock()
+		c.writing = 0
+		// the written buffer is reused for the next output, unless it grew too big to keep
+		if cap(data) <= outputBufferSize*4 {
+			c.spare = data[:0]
+		} else {
+			c.spare = nil
+		}
+		if err != nil {
+			c.flushing = false
+			c.output = nil
+			c.mutex.Unlock()
+			return err
+		}
+		c.mutex.Unlock()
+	}
+}
@@ -2,103 +2,352 @@ package handler
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"go-redis/cluster_database/core"
 	"go-redis/config"
 	"go-redis/database"
+	"go-redis/gateway"
 	databaseInterface "go-redis/interface/database"
+	respInterface "go-redis/interface/resp"
+	tcpInterface "go-redis/interface/tcp"
 	"go-redis/lib/logger"
 	"go-redis/lib/sync/atomic"
+	"go-redis/lib/utils"
+	"go-redis/module"
 	"go-redis/resp/connection"
 	"go-redis/resp/parser"
 	"go-redis/resp/reply"
+	"go-redis/tcp"
 	"io"
 	"net"
+	"net/http"
+	"strconv"
 	"strings"
 	"sync"
+	stdatomic "sync/atomic"
+	"time"
 )
 
 type RespHandler struct {
 	activeConnections sync.Map
 	database          databaseInterface.Database
 	closing           atomic.Boolean
+	closeOnce         sync.Once
+	done              chan struct{} // closed with the handler, stops the idle sweep
+
+	maxClients   int64         // clients beyond it are rejected, resp connections and http requests alike
+	clientCount  int64         // number of the clients being served
+	idleTimeout  time.Duration // idle normal clients are closed after it, 0 disables it
+	tcpKeepAlive time.Duration // period of the tcp keepalive probes, 0 disables them
+
+	protoMaxBulkLen        int64 // the longest bulk string a client may send
+	clientQueryBufferLimit int64 // the largest command a client may send
+	outputBufferLimits     *connection.OutputBufferLimits
+
+	gateway *gateway.Gateway // serves the http requests
 }
 
-// MakeHandler creates a new handler
-func MakeHandler() *RespHandler {
+const (
+	defaultProtoMaxBulkLen        = 512 * 1024 * 1024
+	defaultClientQueryBufferLimit = 1024 * 1024 * 1024
+	idleSweepInterval             = time.Second
+	defaultMaxClients             = 10000
+)
+
+var maxClientsReachedReply = reply.MakeStandardErrorReply("ERR max number of clients reached")
+
+// MakeHandler creates a new handler serving the database described by properties
+func MakeHandler(properties *config.ServerProperties) *RespHandler {
+	// modules are loaded first, so the commands they add can be replayed from the aof file
+	module.LoadModules(properties.LoadModules)
 	var db databaseInterface.Database
-	if config.Properties.Self != "" && len(config.Properties.Peers) > 0 {
-		db = core.NewClusterDatabase()
+	if properties.Self != "" && len(properties.Peers) > 0 {
+		db = core.NewClusterDatabase(properties)
 	} else {
-		db = database.NewStandaloneDatabase()
+		db = database.NewStandaloneDatabase(properties)
+	}
+	handler := &RespHandler{
+		database:               db,
+		done:                   make(chan struct{}),
+		maxClients:             int64(properties.MaxClients),
+		idleTimeout:            time.Duration(properties.Timeout) * time.Second,
+		tcpKeepAlive:           time.Duration(properties.TCPKeepAlive) * time.Second,
+		protoMaxBulkLen:        parseSizeOrDefault(properties.ProtoMaxBulkLen, defaultProtoMaxBulkLen),
+		clientQueryBufferLimit: parseSizeOrDefault(properties.ClientQueryBufferLimit, defaultClientQueryBufferLimit),
+		outputBufferLimits:     parseOutputBufferLimits(properties.ClientOutputBufferLimit),
+	}
+	handler.gateway = gateway.MakeGateway(db, handler, handler.clientQueryBufferLimit)
+	if handler.maxClients <= 0 {
+		handler.maxClients = defaultMaxClients
+	}
+	if handler.idleTimeout > 0 {
+		go handler.sweepIdleClients()
+	}
+	return handler
+}
+
+// sweepIdleClients periodically closes the clients idle for longer than the timeout, until the handler is closed.
+// Pub/sub and blocked clients are expected to stay silent, they are never closed.
+func (handler *RespHandler) sweepIdleClients() {
+	ticker := time.NewTicker(idleSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-handler.done:
+			return
+		case now := <-ticker.C:
+			handler.activeConnections.Range(func(key, value interface{}) bool {
+				client := key.(*connection.Connection)
+				if client.IsBlocked() || client.SubsCount() > 0 || client.ShardSubsCount() > 0 {
+					return true
+				}
+				if now.Sub(client.GetLastInteraction()) > handler.idleTimeout {
+					logger.Info("Closing idle client: " + client.RemoteAddr())
+					// the handling goroutine sees the closed connection and releases the client
+					client.CloseConn()
+				}
+				return true
+			})
+		}
+	}
+}
+
+// setKeepAlive enables the tcp keepalive probes of conn, or disables them if period is 0
+func setKeepAlive(conn net.Conn, period time.Duration) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	_ = tcpConn.SetKeepAlive(period > 0)
+	if period > 0 {
+		_ = tcpConn.SetKeepAlivePeriod(period)
+	}
+}
+
+// parseOutputBufferLimits parses the client-output-buffer-limit directives, e.g. "pubsub 32mb 8mb 60".
+// A class may be set on its own line or several classes on one line, the unset ones keep the redis defaults.
+func parseOutputBufferLimits(directives []string) *connection.OutputBufferLimits {
+	limits := connection.DefaultOutputBufferLimits
+	var fields []string
+	for _, directive := range directives {
+		fields = append(fields, strings.Fields(directive)...)
+	}
+	for i := 0; i+3 < len(fields); i += 4 {
+		hard, err1 := utils.ParseSize(fields[i+1])
+		soft, err2 := utils.ParseSize(fields[i+2])
+		seconds, err3 := strconv.ParseInt(fields[i+3], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil || hard < 0 || soft < 0 || seconds < 0 {
+			logger.Warn("invalid client-output-buffer-limit for class " + fields[i])
+			continue
+		}
+		limit := connection.OutputBufferLimit{Hard: hard, Soft: soft, SoftSeconds: time.Duration(seconds) * time.Second}
+		switch strings.ToLower(fields[i]) {
+		case "normal":
+			limits.Normal = limit
+		case "replica", "slave":
+			limits.Replica = limit
+		case "pubsub":
+			limits.PubSub = limit
+		default:
+			logger.Warn("invalid client-output-buffer-limit class " + fields[i])
+		}
+	}
+	return &limits
+}
+
+// parseSizeOrDefault parses a size directive like "512mb", it returns defaultSize if the directive is unset or invalid
+func parseSizeOrDefault(size string, defaultSize int64) int64 {
+	if size == "" {
+		return defaultSize
+	}
+	value, err := utils.ParseSize(size)
+	if err != nil || value <= 0 {
+		logger.Warn("invalid size " + size + ", the default is used")
+		return defaultSize
+	}
+	return value
+}
+
+// Admit takes a client slot for conn, the connections beyond maxclients are told why before being closed, like redis does.
+// It runs in the accept loop, so a tls client is refused without a reply, which would wait for its handshake.
+func (handler *RespHandler) Admit(conn net.Conn) bool {
+	if handler.TakeClientSlot() {
+		return true
+	}
+	handler.database.Stats().IncrRejectedConnections()
+	if _, isTLS := conn.(*tls.Conn); !isTLS {
+		// the reply fits in the socket buffer, so the write does not wait for the client
+		_ = conn.SetWriteDeadline(time.Now().Add(10 * time.Millisecond))
+		_, _ = conn.Write(maxClientsReachedReply.ToBytes())
+	}
+	_ = conn.Close()
+	logger.Warn("Connection rejected, max number of clients reached: " + conn.RemoteAddr().String())
+	return false
+}
+
+// TakeClientSlot counts a new client, unless maxclients are already served.
+// The resp connections and the requests of the http gateway share the slots.
+func (handler *RespHandler) TakeClientSlot() bool {
+	if stdatomic.AddInt64(&handler.clientCount, 1) <= handler.maxClients {
+		return true
 	}
-	return &RespHandler{database: db}
+	stdatomic.AddInt64(&handler.clientCount, -1)
+	return false
 }
 
-// Handle creates a new connection with the client and serves it
-func (handler *RespHandler) Handle(_ context.Context, conn net.Conn) {
+// ReleaseClientSlot frees the slot of a client which is gone
+func (handler *RespHandler) ReleaseClientSlot() {
+	stdatomic.AddInt64(&handler.clientCount, -1)
+}
+
+// Handle creates a new connection with the client and serves it, the connection must have been admitted by Admit
+func (handler *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 	// in case the server is closed
 	if handler.closing.Get() {
 		_ = conn.Close()
+		return
 	}
+	// the slot was taken by Admit
+	defer handler.ReleaseClientSlot()
+	// a tls client which does not complete its handshake would hold its slot until it disconnects
+	if err := tcp.Handshake(ctx, conn); err != nil {
+		_ = conn.Close()
+		logger.Warn("TLS handshake failed: " + conn.RemoteAddr().String() + ", " + err.Error())
+		return
+	}
+	setKeepAlive(conn, handler.tcpKeepAlive)
 	client := connection.NewConnection(conn)
+	client.SetOutputBufferLimits(handler.outputBufferLimits, handler.database.Stats())
+	handler.database.Stats().IncrConnectionsReceived()
 	handler.activeConnections.Store(client, struct{}{})
+	handler.database.AfterClientConnect(client)
 	// prevent memory leak
 	defer handler.activeConnections.Delete(client)
+	// Close may have iterated the connections before this one was stored
+	if handler.closing.Get() {
+		handler.closeOneClient(client)
+		return
+	}
 
-	ch := parser.ParseStream(conn)
-	for payload := range ch {
+	// replies are buffered while pipelined commands are parsed, and flushed once the parser waits for more input
+	reader := makeCommandReader(conn, client)
+	reader.parser.SetLimits(handler.protoMaxBulkLen, handler.clientQueryBufferLimit)
+	defer reader.release()
+	for {
+		args, err := reader.next()
 		// Error
-		if payload.Error != nil {
+		if err != nil {
 			// EOF or closed connection
-			if errors.Is(payload.Error, io.EOF) || errors.Is(payload.Error, io.ErrUnexpectedEOF) ||
-				strings.Contains(payload.Error.Error(), "use of closed network connection") {
+			if isClosedError(err) {
 				handler.closeOneClient(client)
 				logger.Info("Connection closed: " + conn.RemoteAddr().String())
 				return
 			}
-			// protocol error
-			errorReply := reply.MakeStandardErrorReply(payload.Error.Error())
-			err := client.Write(errorReply.ToBytes())
-			if err != nil {
-				handler.closeOneClient(client)
-				logger.Info("Connection closed: " + conn.RemoteAddr().String())
-				return
+			// a protocol error is replied before closing the connection, like redis does
+			if parser.IsProtocolError(err) {
+				_ = client.Write(reply.MakeStandardErrorReply(err.Error()).ToBytes())
 			}
-			continue
+			handler.closeOneClient(client)
+			logger.Warn("Connection closed: " + conn.RemoteAddr().String() + ", " + err.Error())
+			return
 		}
 
 		// Exec
-		if payload.Data == nil {
-			continue
-		}
-		multiBulkReply, ok := payload.Data.(*reply.MultiBulkReply)
-		if !ok {
-			logger.Error("require multi bulk reply")
-			continue
+		client.MarkCommand(strings.ToLower(string(args[0])))
+
+		// QUIT asks the server to close the connection after the reply
+		if strings.ToLower(string(args[0])) == "quit" {
+			_ = client.Write(reply.MakeOkReply().ToBytes())
+			handler.closeOneClient(client)
+			logger.Info("Connection closed: " + conn.RemoteAddr().String())
+			return
 		}
 
-		result := handler.database.Exec(client, multiBulkReply.Args)
+		handler.database.Stats().IncrCommandsProcessed()
+		result := handler.database.Exec(client, args)
 		if result == nil {
-			unknownErrorReply := reply.MakeUnknownErrorReply()
-			_ = client.Write(unknownErrorReply.ToBytes())
+			_ = client.WriteBufferedReply(reply.MakeUnknownErrorReply())
 			continue
 		}
-		_ = client.Write(result.ToBytes())
+		if blocking, ok := result.(respInterface.BlockingReply); ok {
+			// wait for the reply, while watching the connection so a client closed meanwhile is released
+			_ = client.Flush()
+			var closed bool
+			result, closed = handler.waitBlocking(blocking, reader)
+			if closed {
+				handler.closeOneClient(client)
+				logger.Info("Connection closed: " + conn.RemoteAddr().String())
+				return
+			}
+		}
+		_ = client.WriteBufferedReply(result)
 	}
 }
 
-// Close closes the server and all active connections
+// waitBlocking waits for the reply of a blocking command, the commands received meanwhile are queued by the reader.
+// It returns closed if the connection is closed before the reply is ready.
+func (handler *RespHandler) waitBlocking(blocking respInterface.BlockingReply, reader *commandReader) (respInterface.Reply, bool) {
+	for {
+		select {
+		case result := <-blocking.Wait():
+			return result, false
+		case command := <-reader.readAhead():
+			reader.inFlight = nil
+			if command.err != nil && isClosedError(command.err) {
+				return nil, true
+			}
+			reader.pending = append(reader.pending, command)
+		}
+	}
+}
+
+// isClosedError returns true if the error means the connection is closed
+func isClosedError(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		strings.Contains(err.Error(), "use of closed network connection")
+}
+
+// Close closes the server and all active connections.
+// It is safe to call Close more than once, later calls wait for the first one to finish.
 func (handler *RespHandler) Close() error {
-	logger.Info("Closing server...")
-	handler.closing.Set(true)
-	handler.activeConnections.Range(func(key, value interface{}) bool {
-		client := key.(*connection.Connection)
-		_ = client.Close()
-		// return true to continue the iteration, or it will stop at the first iteration
-		return true
+	handler.closeOnce.Do(func() {
+		logger.Info("Closing server...")
+		handler.closing.Set(true)
+		close(handler.done)
+		handler.activeConnections.Range(func(key, value interface{}) bool {
+			client := key.(*connection.Connection)
+			_ = client.Close()
+			// return true to continue the iteration, or it will stop at the first iteration
+			return true
+		})
+		handler.gateway.Close()
+		handler.database.Close()
 	})
-	handler.database.Close()
+	return nil
+}
+
+// ServeHTTP serves a request of the http gateway
+func (handler *RespHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler.gateway.ServeHTTP(w, r)
+}
+
+// ShutdownRequested returns a channel closed once a client asked the server to shut down
+func (handler *RespHandler) ShutdownRequested() <-chan struct{} {
+	if notifier, ok := handler.database.(tcpInterface.ShutdownNotifier); ok {
+		return notifier.ShutdownRequested()
+	}
+	return nil
+}
+
+// ReloadCertificates reloads the certificates of the database, if it holds some
+func (handler *RespHandler) ReloadCertificates() error {
+	if reloader, ok := handler.database.(tcpInterface.CertificateReloader); ok {
+		return reloader.ReloadCertificates()
+	}
 	return nil
 }
 
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"go-redis/resp/connection"
+	"go-redis/resp/parser"
+	"io"
+)
+
+// flushingReader flushes the replies buffered for the client before reading more input from it,
+// so the replies of pipelined commands are sent once the input runs dry
+type flushingReader struct {
+	reader io.Reader
+	client *connection.Connection
+}
+
+// Read flushes the buffered replies, then reads from the connection
+func (r *flushingReader) Read(p []byte) (int, error) {
+	if err := r.client.Flush(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
+// command is a command read from a client, or the error met reading it
+type command struct {
+	args [][]byte
+	err  error
+}
+
+// commandReader reads the commands of a client synchronously.
+// While the client is blocked the next command is read ahead in another goroutine,
+// the commands received meanwhile are queued and served once it is unblocked.
+type commandReader struct {
+	client   *connection.Connection
+	parser   *parser.Parser
+	pending  []command
+	inFlight chan command // delivers the command read ahead, nil if none is being read
+}
+
+// makeCommandReader returns a reader of the commands sent by the client.
+// The replies are buffered while pipelined commands are parsed, and flushed once the parser waits for more input.
+func makeCommandReader(reader io.Reader, client *connection.Connection) *commandReader {
+	return &commandReader{
+		client: client,
+		parser: parser.NewParser(&flushingReader{reader: reader, client: client}),
+	}
+}
+
+// next returns the next command of the client
+func (r *commandReader) next() ([][]byte, error) {
+	if len(r.pending) > 0 {
+		next := r.pending[0]
+		r.pending = r.pending[1:]
+		return next.args, next.err
+	}
+	if r.inFlight != nil {
+		// the command read ahead may wait for input, while the replies served since are still buffered
+		_ = r.client.Flush()
+		next := <-r.inFlight
+		r.inFlight = nil
+		return next.args, next.err
+	}
+	return r.read()
+}
+
+// read reads a command from the parser, the database may keep its args as values or aof commands
+func (r *commandReader) read() ([][]byte, error) {
+	return r.parser.ReadCommand()
+}
+
+// readAhead starts reading the next command in another goroutine, unless it is already being read
+func (r *commandReader) readAhead() <-chan command {
+	if r.inFlight == nil {
+		inFlight := make(chan command, 1)
+		go func() {
+			args, err := r.read()
+			inFlight <- command{args: args, err: err}
+		}()
+		r.inFlight = inFlight
+	}
+	return r.inFlight
+}
+
+// release gives the buffers of the parser back, unless a goroutine is still reading from it
+func (r *commandReader) release() {
+	if r.inFlight == nil {
+		r.parser.Release()
+	}
+}
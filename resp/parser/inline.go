@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"strconv"
+)
+
+// maxInlineSize is the longest inline command accepted
+const maxInlineSize = 64 * 1024
+
+var (
+	errTooBigInline     = &ProtocolError{Message: "ERR Protocol error: too big inline request"}
+	errUnbalancedQuotes = &ProtocolError{Message: "ERR Protocol error: unbalanced quotes in request"}
+)
+
+// isTypeByte returns true if b starts a RESP message, any other line is an inline command
+func isTypeByte(b byte) bool {
+	switch b {
+	case '*', '$', '+', '-', ':', '_', '#', ',', '(', '!', '=', '%', '~', '>', '|':
+		return true
+	}
+	return false
+}
+
+// isSpace returns true for the characters separating the arguments of an inline command
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f'
+}
+
+// parseInline splits an inline command into its arguments like redis-cli does.
+// E.g. `SET key "hello\x20world"` or `SET key 'it\'s'`.
+// Double-quoted arguments support the escapes \n \r \t \b \a \xHH, single-quoted ones only \'.
+func parseInline(line []byte) ([][]byte, error) {
+	var args [][]byte
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+		var arg []byte
+		inDoubleQuotes, inSingleQuotes := false, false
+		for done := false; !done; {
+			switch {
+			case inDoubleQuotes:
+				if i >= len(line) {
+					return nil, errUnbalancedQuotes
+				}
+				if line[i] == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]) {
+					b, _ := strconv.ParseUint(string(line[i+2:i+4]), 16, 8)
+					arg = append(arg, byte(b))
+					i += 3
+				} else if line[i] == '\\' && i+1 < len(line) {
+					i++
+					arg = append(arg, unescape(line[i]))
+				} else if line[i] == '"' {
+					// the closing quote must be followed by a space or the end of the line
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				} else {
+					arg = append(arg, line[i])
+				}
+			case inSingleQuotes:
+				if i >= len(line) {
+					return nil, errUnbalancedQuotes
+				}
+				if line[i] == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					arg = append(arg, '\'')
+				} else if line[i] == '\'' {
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				} else {
+					arg = append(arg, line[i])
+				}
+			default:
+				if i >= len(line) || isSpace(line[i]) {
+					done = true
+					continue
+				}
+				switch line[i] {
+				case '"':
+					inDoubleQuotes = true
+				case '\'':
+					inSingleQuotes = true
+				default:
+					arg = append(arg, line[i])
+				}
+			}
+			i++
+		}
+		if arg == nil {
+			arg = []byte{}
+		}
+		args = append(args, arg)
+	}
+}
+
+// isHexDigit returns true if b is a hexadecimal digit
+func isHexDigit(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
+
+// unescape returns the character of an escape sequence inside double quotes
+func unescape(b byte) byte {
+	switch b {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'a':
+		return '\a'
+	}
+	return b
+}
@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseInline(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"PING", []string{"PING"}},
+		{"  SET\tkey   value ", []string{"SET", "key", "value"}},
+		{`SET key "hello world"`, []string{"SET", "key", "hello world"}},
+		{`SET key "a\x20b\n"`, []string{"SET", "key", "a b\n"}},
+		{`SET key "say \"hi\""`, []string{"SET", "key", `say "hi"`}},
+		{`SET key 'it\'s'`, []string{"SET", "key", "it's"}},
+		{`SET key 'no \n escape'`, []string{"SET", "key", `no \n escape`}},
+		{`SET key ""`, []string{"SET", "key", ""}},
+		{"", nil},
+	}
+	for _, test := range tests {
+		args, err := parseInline([]byte(test.line))
+		if err != nil {
+			t.Errorf("parseInline(%q) failed: %v", test.line, err)
+			continue
+		}
+		got := make([]string, 0, len(args))
+		for _, arg := range args {
+			got = append(got, string(arg))
+		}
+		if len(got) == 0 && test.want == nil {
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseInline(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestParseInlineUnbalancedQuotes(t *testing.T) {
+	for _, line := range []string{`SET key "value`, `SET key 'value`, `SET key "a"b`, `SET key 'a'b`} {
+		if _, err := parseInline([]byte(line)); err != errUnbalancedQuotes {
+			t.Errorf("parseInline(%q) = %v, want %v", line, err, errUnbalancedQuotes)
+		}
+	}
+}
+
+func TestReadCommandInline(t *testing.T) {
+	p := NewParser(strings.NewReader("\r\nSET key \"a b\"\nGET key\r\n"))
+	defer p.Release()
+	for _, want := range [][]string{{"SET", "key", "a b"}, {"GET", "key"}} {
+		args, err := p.ReadCommand()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0, len(args))
+		for _, arg := range args {
+			got = append(got, string(arg))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ReadCommand = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestReadCommandTooBigInline(t *testing.T) {
+	p := NewParser(strings.NewReader(strings.Repeat("a", maxInlineSize+1) + "\r\n"))
+	defer p.Release()
+	if _, err := p.ReadCommand(); err != errTooBigInline {
+		t.Errorf("ReadCommand = %v, want %v", err, errTooBigInline)
+	}
+}
@@ -7,9 +7,24 @@ import (
 	"go-redis/lib/logger"
 	"go-redis/resp/reply"
 	"io"
+	"math"
+	"math/big"
 	"runtime/debug"
 	"strconv"
-	"strings"
+	"sync"
+)
+
+const (
+	// minArgSize is the size of the smallest arg of a command, "$0\r\n\r\n"
+	minArgSize = 6
+	// minElementSize is the size of the smallest element of a reply, "_\r\n"
+	minElementSize = 3
+	// maxPreallocatedElements bounds the elements allocated ahead of reading them, a count is not trusted until then
+	maxPreallocatedElements = 1024
+	// arenaSize is the size of the buffers the small args of the commands are sliced from
+	arenaSize = 4 * 1024
+	// maxArenaArgSize is the largest arg sliced from an arena, a bigger one has a buffer of its own
+	maxArenaArgSize = arenaSize / 4
 )
 
 type Payload struct {
@@ -17,221 +32,460 @@ type Payload struct {
 	Error error
 }
 
-type readState struct {
-	readingMultiLine  bool     // reading multi line or single line
-	expectedArgsCount int      // expected how many args we need
-	messageType       byte     // E.g. '*', '-', '$', '+', ':'
-	args              [][]byte // args of command from client
-	bulkLength        int64    // count the bulk length
+// ProtocolError is a malformed message.
+// The server replies it and closes the connection, ParseStream stops reading after it too.
+type ProtocolError struct {
+	Message string
 }
 
-// isFinished returns true if the args count is equal to the expected args count.
-func (r *readState) isFinished() bool {
-	return r.expectedArgsCount > 0 && r.expectedArgsCount == len(r.args)
+// Error returns the error message
+func (e *ProtocolError) Error() string {
+	return e.Message
 }
 
-// ParseStream returns a received-only channel of Payload to make it parallel parsing.
-func ParseStream(reader io.Reader) <-chan *Payload {
-	ch := make(chan *Payload)
-	go parse0(reader, ch)
-	return ch
+// makeProtocolError returns the error of a malformed line
+func makeProtocolError(line []byte) error {
+	return &ProtocolError{Message: "protocol error: " + string(line)}
 }
 
-// parse0 is the main parsing function that reads line by line.
-func parse0(reader io.Reader, ch chan<- *Payload) {
-	// if the panic occurs, we need to recover and log the error.
-	defer func() {
-		if err := recover(); err != nil {
-			logger.Error(string(debug.Stack()))
+var (
+	errInvalidMultiBulkLength = &ProtocolError{Message: "ERR Protocol error: invalid multibulk length"}
+	errInvalidBulkLength      = &ProtocolError{Message: "ERR Protocol error: invalid bulk length"}
+	// ErrQueryBufferLimit is returned once a command is bigger than the query buffer limit, the connection is closed
+	ErrQueryBufferLimit = errors.New("closing client that reached max query buffer length")
+)
+
+// makeExpectedBulkError returns the error of an arg which is not a bulk string
+func makeExpectedBulkError(line []byte) error {
+	got := " "
+	if len(line) > 0 {
+		got = string(line[0])
+	}
+	return &ProtocolError{Message: "ERR Protocol error: expected '$', got '" + got + "'"}
+}
+
+// IsProtocolError returns true if err is a malformed message
+func IsProtocolError(err error) bool {
+	var protocolError *ProtocolError
+	return errors.As(err, &protocolError)
+}
+
+// Parser reads RESP messages synchronously from a buffered reader
+type Parser struct {
+	reader *bufio.Reader
+	arena  []byte // the free space the small args are sliced from
+	long   []byte // a line longer than the buffer of the reader
+
+	maxBulkLength    int64 // the longest bulk string accepted, 0 means no limit
+	queryBufferLimit int64 // the largest command accepted, 0 means no limit
+}
+
+// parserPool reuses the buffers of the parsers of closed connections
+var parserPool = sync.Pool{
+	New: func() interface{} {
+		return &Parser{
+			reader: bufio.NewReader(nil),
+			arena:  make([]byte, arenaSize),
 		}
-	}()
-	bufReader := bufio.NewReader(reader)
-	var state readState
-	var err error
-	var message []byte
+	},
+}
+
+// NewParser returns a parser reading from reader, Release gives its buffers back once it is not used anymore
+func NewParser(reader io.Reader) *Parser {
+	p := parserPool.Get().(*Parser)
+	p.reader.Reset(reader)
+	return p
+}
+
+// Release puts the parser back to the pool, it must not be used after
+func (p *Parser) Release() {
+	p.reader.Reset(nil)
+	p.long = nil
+	p.maxBulkLength, p.queryBufferLimit = 0, 0
+	parserPool.Put(p)
+}
+
+// SetLimits sets the longest bulk string and the largest command accepted, 0 means no limit.
+// The count of a multi bulk is refused at once if that many elements could not fit in the largest command.
+func (p *Parser) SetLimits(maxBulkLength int64, queryBufferLimit int64) {
+	p.maxBulkLength = maxBulkLength
+	p.queryBufferLimit = queryBufferLimit
+}
+
+// maxCount returns the largest count of elements of at least minSize bytes fitting in the query buffer limit
+func (p *Parser) maxCount(minSize int64) int64 {
+	if p.queryBufferLimit <= 0 {
+		return math.MaxInt64
+	}
+	return p.queryBufferLimit / minSize
+}
+
+// preallocated returns the capacity to allocate for count elements
+func preallocated(count int64) int {
+	if count > maxPreallocatedElements {
+		return maxPreallocatedElements
+	}
+	return int(count)
+}
+
+// ReadCommand reads the next command, either a multi bulk or an inline command.
+// The args belong to the caller, which may keep them: the small ones share an arena with the args of
+// other commands, but the parser never writes over what it handed out.
+func (p *Parser) ReadCommand() ([][]byte, error) {
 	for {
-		var isIOError bool
-		message, isIOError, err = readLine(bufReader, &state)
+		line, crlf, err := p.readLine()
 		if err != nil {
-			ch <- &Payload{Error: err}
-			if isIOError {
-				close(ch)
-				return
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '*' {
+			// E.g. "PING\r\n" sent by telnet, an empty line is skipped
+			args, err := parseInline(line)
+			if err != nil || len(args) > 0 {
+				return args, err
 			}
-			state = readState{} // renew a new object, keep reading line
 			continue
 		}
-		// determine if the reply is multi-block
-		if !state.readingMultiLine {
-			if message[0] == '*' { // E.g. "*3\r\n"
-				err = parseMultiBulkHeader(message, &state)
-				if err != nil {
-					ch <- &Payload{Error: err}
-					state = readState{}
-					continue
-				}
-				if state.expectedArgsCount == 0 {
-					ch <- &Payload{Data: reply.MakeEmptyMultiBulkReply()}
-					state = readState{}
-					continue
-				}
-			} else if message[0] == '$' { // E.g. "$3\r\n"
-				err = parseBulkHeader(message, &state)
-				if err != nil {
-					ch <- &Payload{Error: err}
-					state = readState{}
-					continue
-				}
-				if state.bulkLength == -1 { // -1 means null
-					// TODO
-					ch <- &Payload{Data: reply.MakeNullBulkReply()}
-					state = readState{}
-					continue
-				}
-			} else { // E.g. "+OK\r\n" or "-err\r\n" or ":5\r\n"
-				result, err := parseSingleLineReply(message)
-				ch <- &Payload{Data: result, Error: err}
-				state = readState{}
-				continue
-			}
-		} else {
-			err = readBody(message, &state)
+		if !crlf {
+			return nil, makeProtocolError(line)
+		}
+		count, ok := parseLength(line[1:])
+		if !ok || count > p.maxCount(minArgSize) {
+			return nil, errInvalidMultiBulkLength
+		}
+		if count <= 0 { // "*0\r\n" and "*-1\r\n" are ignored
+			continue
+		}
+		args := make([][]byte, 0, preallocated(count))
+		size := int64(len(line))
+		for i := int64(0); i < count; i++ {
+			line, crlf, err = p.readLine()
 			if err != nil {
-				ch <- &Payload{Error: err}
-				state = readState{}
-				continue
+				return nil, err
 			}
-			if state.isFinished() {
-				var result resp.Reply = reply.MakeMultiBulkReply(state.args)
-				// TODO check
-				//if state.messageType == '*' {
-				//	result = reply.MakeMultiBulkReply(state.args)
-				//} else if state.messageType == '$' {
-				//	result = reply.MakeMultiBulkReply([][]byte{state.args[0]})
-				//}
-				ch <- &Payload{Data: result, Error: err}
-				state = readState{}
-				continue
+			if !crlf || len(line) == 0 || line[0] != '$' {
+				return nil, makeExpectedBulkError(line)
+			}
+			length, ok := parseLength(line[1:])
+			if !ok || length < 0 || (p.maxBulkLength > 0 && length > p.maxBulkLength) {
+				return nil, errInvalidBulkLength
 			}
+			size += int64(len(line)) + length
+			if p.queryBufferLimit > 0 && size > p.queryBufferLimit {
+				return nil, ErrQueryBufferLimit
+			}
+			arg, err := p.readBulkBody(int(length))
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
 		}
+		return args, nil
 	}
 }
 
-/*
-*
-readLine reads message from client and below are the two rules to read:
-1. read the line by CRLF
-2. parse the bytes number with ${number} or *${number}
+// ReadReply reads the next reply as the server sent it, the reply owns its memory.
+// An array of bulk strings is returned as a multi bulk, whose nil args are null bulk strings,
+// and any other array as a multi raw holding the nested replies. The RESP3 aggregates are returned as map, set,
+// push and attribute replies, a verbatim string as a verbatim reply and a blob error as an error reply.
+func (p *Parser) ReadReply() (resp.Reply, error) {
+	return p.readElement()
+}
 
-if the readLine occurs IO error, the bool value is true.
-otherwise, the bool value is false when other error occurs.
-*/
-func readLine(bufReader *bufio.Reader, state *readState) (message []byte, isIOError bool, err error) {
-	if state.bulkLength == 0 { // use method 1.
-		message, err = bufReader.ReadBytes('\n')
+// readReplyOf reads the rest of the reply starting with line, the elements of an aggregate are read recursively
+func (p *Parser) readReplyOf(line []byte) (resp.Reply, error) {
+	switch line[0] {
+	case '*': // E.g. "*3\r\n"
+		count, ok := parseLength(line[1:])
+		if !ok || count < -1 || count > p.maxCount(minElementSize) {
+			return nil, errInvalidMultiBulkLength
+		}
+		if count == -1 {
+			return reply.MakeNullMultiBulkReply(), nil
+		}
+		if count == 0 {
+			return reply.MakeEmptyMultiBulkReply(), nil
+		}
+		return p.readArray(int(count))
+	case '$', '!', '=': // E.g. "$3\r\n", the blob error "!5\r\n" or the verbatim string "=8\r\n"
+		length, ok := parseLength(line[1:])
+		if !ok || length < -1 || (p.maxBulkLength > 0 && length > p.maxBulkLength) {
+			return nil, errInvalidBulkLength
+		}
+		if length == -1 && line[0] == '$' {
+			return reply.MakeNullBulkReply(), nil
+		}
+		if length == -1 {
+			return nil, makeProtocolError(line)
+		}
+		body, err := p.readOwnedBulkBody(int(length))
 		if err != nil {
-			return nil, true, err
+			return nil, err
+		}
+		switch line[0] {
+		case '!':
+			return reply.MakeStandardErrorReply(string(body)), nil
+		case '=': // E.g. "txt:Some string"
+			if len(body) < 4 || body[3] != ':' {
+				return nil, makeProtocolError(body)
+			}
+			return reply.MakeVerbatimReply(string(body[:3]), body[4:]), nil
 		}
-		if len(message) == 0 || message[len(message)-2] != '\r' {
-			return nil, false, errors.New("protocol error: " + string(message))
+		return reply.MakeBulkReply(body), nil
+	case '%', '|': // E.g. the map "%2\r\n", or the attributes "|1\r\n" preceding a reply
+		count, ok := parseLength(line[1:])
+		if !ok || count < 0 || count > p.maxCount(2*minElementSize) {
+			return nil, errInvalidMultiBulkLength
 		}
-	} else { // use method 2.
-		message = make([]byte, state.bulkLength+2) // +2 for CRLF
-		_, err = io.ReadFull(bufReader, message)
+		pairs := reply.MakeMapReply()
+		for i := int64(0); i < count; i++ {
+			key, err := p.readElement()
+			if err != nil {
+				return nil, err
+			}
+			value, err := p.readElement()
+			if err != nil {
+				return nil, err
+			}
+			pairs.Add(key, value)
+		}
+		if line[0] == '%' {
+			return pairs, nil
+		}
+		attributed, err := p.readElement()
 		if err != nil {
-			return nil, true, err
+			return nil, err
+		}
+		return reply.MakeAttributeReply(pairs, attributed), nil
+	case '~', '>': // E.g. the set "~2\r\n" or the push ">3\r\n"
+		count, ok := parseLength(line[1:])
+		if !ok || count < 0 || count > p.maxCount(minElementSize) {
+			return nil, errInvalidMultiBulkLength
+		}
+		elements := make([]resp.Reply, 0, preallocated(count))
+		for i := int64(0); i < count; i++ {
+			element, err := p.readElement()
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, element)
 		}
-		if len(message) == 0 || message[len(message)-2] != '\r' || message[len(message)-1] != '\n' {
-			return nil, false, errors.New("protocol error: " + string(message))
+		if line[0] == '~' {
+			return reply.MakeSetReply(elements), nil
 		}
-		state.bulkLength = 0 // reset
+		return reply.MakePushReply(elements), nil
+	default: // E.g. "+OK\r\n" or "-err\r\n" or ":5\r\n"
+		return parseSingleLineReply(line)
 	}
-	return message, false, nil
 }
 
-// parseMultiBulkHeader parses the multi bulk header and init the readState.
-// E.g. "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n".
-func parseMultiBulkHeader(message []byte, state *readState) (err error) {
-	var expectedLine int64
-	expectedLine, err = strconv.ParseInt(string(message[1:len(message)-2]), 10, 64)
+// readElement reads the next element of an aggregate
+func (p *Parser) readElement() (resp.Reply, error) {
+	line, crlf, err := p.readLine()
 	if err != nil {
-		return errors.New("protocol error: " + string(message))
+		return nil, err
+	}
+	if len(line) == 0 || !crlf || !isTypeByte(line[0]) {
+		return nil, makeProtocolError(line)
 	}
+	return p.readReplyOf(line)
+}
 
-	if expectedLine == 0 {
-		state.expectedArgsCount = 0
-		return
-	} else if expectedLine < 0 {
-		err = errors.New("protocol error: " + string(message))
-		return
+// readArray reads the count elements of an array, it returns a multi bulk as long as they are all bulk strings
+func (p *Parser) readArray(count int) (resp.Reply, error) {
+	args := make([][]byte, 0, preallocated(int64(count)))
+	var replies []resp.Reply // set once an element is not a bulk string
+	for i := 0; i < count; i++ {
+		element, err := p.readElement()
+		if err != nil {
+			return nil, err
+		}
+		if replies == nil {
+			switch element := element.(type) {
+			case *reply.BulkReply:
+				args = append(args, element.Arg)
+				continue
+			case *reply.NullBulkReply:
+				args = append(args, nil)
+				continue
+			}
+			replies = make([]resp.Reply, 0, preallocated(int64(count)))
+			for _, arg := range args {
+				replies = append(replies, makeBulkOrNull(arg))
+			}
+		}
+		replies = append(replies, element)
 	}
-	state.messageType = message[0]
-	state.readingMultiLine = true
-	state.expectedArgsCount = int(expectedLine)
-	state.args = make([][]byte, 0, expectedLine)
-	return
+	if replies != nil {
+		return reply.MakeMultiRawReply(replies), nil
+	}
+	return reply.MakeMultiBulkReply(args), nil
 }
 
-// parseBulkHeader parses the bulk header and init the readState.
-// E.g. "$4\r\nPING\r\n".
-func parseBulkHeader(message []byte, state *readState) (err error) {
-	state.bulkLength, err = strconv.ParseInt(string(message[1:len(message)-2]), 10, 64)
-	if err != nil {
-		return errors.New("protocol error: " + string(message))
+// makeBulkOrNull returns a bulk string, or a null bulk string if arg is nil
+func makeBulkOrNull(arg []byte) resp.Reply {
+	if arg == nil {
+		return reply.MakeNullBulkReply()
 	}
+	return reply.MakeBulkReply(arg)
+}
 
-	if state.bulkLength == -1 { // null bulk
-		return
-	} else if state.bulkLength > 0 {
-		state.messageType = message[0]
-		state.readingMultiLine = true
-		state.expectedArgsCount = 1
-		state.args = make([][]byte, 0, 1)
+// readLine returns the next line without its terminator, it is only valid until the next read.
+// crlf is false if the line ends with a bare LF, which is only allowed for an inline command.
+// A line longer than maxInlineSize is a protocol error.
+func (p *Parser) readLine() (line []byte, crlf bool, err error) {
+	line, err = p.reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		p.long = append(p.long[:0], line...)
+		for errors.Is(err, bufio.ErrBufferFull) {
+			if len(p.long) > maxInlineSize {
+				return nil, false, errTooBigInline
+			}
+			line, err = p.reader.ReadSlice('\n')
+			p.long = append(p.long, line...)
+		}
+		line = p.long
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if len(line) >= 2 && line[len(line)-2] == '\r' {
+		line, crlf = line[:len(line)-2], true
 	} else {
-		err = errors.New("protocol error: " + string(message))
+		line = line[:len(line)-1]
+	}
+	// the last chunk of a long line is only counted here
+	if len(line) > maxInlineSize {
+		return nil, false, errTooBigInline
+	}
+	return line, crlf, nil
+}
+
+// readBulkBody reads the body of a bulk string and its CRLF, a small body is sliced from the arena
+func (p *Parser) readBulkBody(length int) ([]byte, error) {
+	if length > maxArenaArgSize {
+		return p.readOwnedBulkBody(length)
+	}
+	if len(p.arena) < length+2 {
+		// the args handed out keep the old arena alive
+		p.arena = make([]byte, arenaSize)
+	}
+	buf := p.arena[:length+2]
+	if _, err := io.ReadFull(p.reader, buf); err != nil {
+		return nil, err
+	}
+	if buf[length] != '\r' || buf[length+1] != '\n' {
+		return nil, makeProtocolError(buf)
+	}
+	// the CRLF is overwritten by the next body, the cap of the body keeps an append from doing it
+	p.arena = p.arena[length:]
+	return buf[:length:length], nil
+}
+
+// readOwnedBulkBody reads the body of a bulk string into its own slice
+func (p *Parser) readOwnedBulkBody(length int) ([]byte, error) {
+	body := make([]byte, length+2)
+	if _, err := io.ReadFull(p.reader, body); err != nil {
+		return nil, err
+	}
+	if body[length] != '\r' || body[length+1] != '\n' {
+		return nil, makeProtocolError(body)
+	}
+	return body[:length:length], nil
+}
+
+// parseLength parses the length of a header without allocating, it accepts -1 for null
+func parseLength(digits []byte) (int64, bool) {
+	if len(digits) == 0 {
+		return 0, false
+	}
+	negative := digits[0] == '-'
+	if negative {
+		digits = digits[1:]
+		if len(digits) == 0 {
+			return 0, false
+		}
+	}
+	var value int64
+	for _, digit := range digits {
+		if digit < '0' || digit > '9' || value > (1<<62)/10 {
+			return 0, false
+		}
+		value = value*10 + int64(digit-'0')
+	}
+	if negative {
+		value = -value
+	}
+	return value, true
+}
+
+// ParseStream returns a received-only channel of Payload to make it parallel parsing.
+// It wraps a Parser for the callers reading replies in another goroutine.
+func ParseStream(reader io.Reader) <-chan *Payload {
+	ch := make(chan *Payload)
+	go parse0(reader, ch)
+	return ch
+}
+
+// parse0 sends every message read by a parser, the channel is closed after the first error.
+func parse0(reader io.Reader, ch chan<- *Payload) {
+	// if the panic occurs, we need to recover and log the error.
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Error(string(debug.Stack()))
+		}
+	}()
+	p := NewParser(reader)
+	defer p.Release()
+	for {
+		result, err := p.ReadReply()
+		if err != nil {
+			// the end of a malformed message is unknown, so nothing after it can be parsed
+			ch <- &Payload{Error: err}
+			close(ch)
+			return
+		}
+		ch <- &Payload{Data: result}
 	}
-	return
 }
 
 // parseSingleLineReply parses the single line and make reply.
-// E.g. "+OK\r\n" or "-err\r\n" or ":5\r\n".
-func parseSingleLineReply(message []byte) (result resp.Reply, err error) {
-	str := strings.TrimSuffix(string(message), "\r\n")
-	switch message[0] {
+// E.g. "+OK" or "-err" or ":5", and the RESP3 "_", "#t", ",1.5" or "(12345".
+func parseSingleLineReply(line []byte) (result resp.Reply, err error) {
+	str := string(line)
+	switch line[0] {
 	case '+':
-		// result = reply.MakeStatusReply(str[1:])
-		// TODO check
-		result = reply.MakeMultiBulkReply([][]byte{[]byte(str[1:])})
+		result = reply.MakeStatusReply(str[1:])
 	case '-':
 		result = reply.MakeStandardErrorReply(str[1:])
 	case ':':
 		var value int64
 		value, err = strconv.ParseInt(str[1:], 10, 64)
 		if err != nil {
-			err = errors.New("protocol error: " + string(message))
-			return
+			return nil, makeProtocolError(line)
 		}
 		result = reply.MakeIntReply(value)
-	}
-	return
-}
-
-// readBody reads the body of the message.
-// E.g. "$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n".
-func readBody(message []byte, state *readState) (err error) {
-	line := message[:len(message)-2] // exclude CRLF
-	if line[0] == '$' {
-		state.bulkLength, err = strconv.ParseInt(string(line[1:]), 10, 64)
+	case '_':
+		result = reply.MakeNullReply()
+	case '#':
+		if str[1:] != "t" && str[1:] != "f" {
+			return nil, makeProtocolError(line)
+		}
+		result = reply.MakeBooleanReply(str[1:] == "t")
+	case ',':
+		var value float64
+		value, err = strconv.ParseFloat(str[1:], 64)
 		if err != nil {
-			err = errors.New("protocol error: " + string(message))
-			return
+			return nil, makeProtocolError(line)
 		}
-		if state.bulkLength <= 0 { // $0\r\n
-			state.args = append(state.args, []byte{})
-			state.bulkLength = 0
+		result = reply.MakeDoubleReply(value)
+	case '(':
+		value, ok := new(big.Int).SetString(str[1:], 10)
+		if !ok {
+			return nil, makeProtocolError(line)
 		}
-	} else {
-		state.args = append(state.args, line)
+		result = reply.MakeBigNumberReply(value)
+	default:
+		return nil, makeProtocolError(line)
 	}
 	return
 }
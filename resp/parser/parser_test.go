@@ -0,0 +1,216 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+	"io"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadReplyResp3(t *testing.T) {
+	replies := []resp.Reply{
+		reply.MakeNullReply(),
+		reply.MakeBooleanReply(true),
+		reply.MakeDoubleReply(1.5),
+		reply.MakeBigNumberReply(new(big.Int).Lsh(big.NewInt(1), 70)),
+		reply.MakeVerbatimReply("txt", []byte("some text")),
+		reply.MakeMapReply().Add(reply.MakeBulkReply([]byte("key")), reply.MakeIntReply(1)),
+		reply.MakeSetReply([]resp.Reply{reply.MakeBulkReply([]byte("a")), reply.MakeBulkReply([]byte("b"))}),
+		reply.MakePushReply([]resp.Reply{reply.MakeBulkReply([]byte("message")), reply.MakeNullReply()}),
+		reply.MakeAttributeReply(
+			reply.MakeMapReply().Add(reply.MakeStatusReply("ttl"), reply.MakeIntReply(3600)),
+			reply.MakeMultiRawReply([]resp.Reply{reply.MakeIntReply(1), reply.MakeMapReply()}),
+		),
+	}
+	for _, want := range replies {
+		encoded := reply.Encode(want, reply.Resp3)
+		p := NewParser(bytes.NewReader(encoded))
+		got, err := p.ReadReply()
+		p.Release()
+		if err != nil {
+			t.Errorf("ReadReply(%q) failed: %v", encoded, err)
+			continue
+		}
+		if decoded := reply.Encode(got, reply.Resp3); !bytes.Equal(decoded, encoded) {
+			t.Errorf("ReadReply(%q) = %q", encoded, decoded)
+		}
+	}
+}
+
+func TestReadReplyBlobError(t *testing.T) {
+	p := NewParser(strings.NewReader("!21\r\nSYNTAX invalid syntax\r\n"))
+	defer p.Release()
+	got, err := p.ReadReply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reply.IsErrorReply(got) || got.(resp.ErrorReply).Error() != "SYNTAX invalid syntax" {
+		t.Errorf("ReadReply = %q, want the error SYNTAX invalid syntax", got.ToBytes())
+	}
+}
+
+func TestReadCommandArgsOutliveNextCommand(t *testing.T) {
+	large := strings.Repeat("v", maxArenaArgSize+1)
+	var input strings.Builder
+	var want [][]string
+	for i := 0; i < 200; i++ { // enough commands to fill several arenas
+		value := fmt.Sprintf("value-%d", i)
+		if i%50 == 0 {
+			value = large
+		}
+		input.WriteString(fmt.Sprintf("*3\r\n$3\r\nSET\r\n$%d\r\nkey-%d\r\n$%d\r\n%s\r\n",
+			len(fmt.Sprintf("key-%d", i)), i, len(value), value))
+		want = append(want, []string{"SET", fmt.Sprintf("key-%d", i), value})
+	}
+	p := NewParser(strings.NewReader(input.String()))
+	defer p.Release()
+	var commands [][][]byte
+	for range want {
+		args, err := p.ReadCommand()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// an append must not write over the args read after
+		_ = append(args[1], 'x')
+		commands = append(commands, args)
+	}
+	for i, args := range commands {
+		got := []string{string(args[0]), string(args[1]), string(args[2])}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Fatalf("command %d = %.40q, want %.40q", i, got, want[i])
+		}
+	}
+}
+
+func TestParseStreamStopsAtProtocolError(t *testing.T) {
+	ch := ParseStream(strings.NewReader("+OK\r\n*2\r\n$3\r\nfoo\r\n?bad\r\n+NEXT\r\n"))
+	var payloads []*Payload
+	for payload := range ch {
+		payloads = append(payloads, payload)
+	}
+	if len(payloads) != 2 {
+		t.Fatalf("got %d payloads, want the reply and the error", len(payloads))
+	}
+	if !IsProtocolError(payloads[1].Error) {
+		t.Errorf("got %v, want a protocol error", payloads[1].Error)
+	}
+}
+
+func TestReadCommandLimits(t *testing.T) {
+	tests := []struct {
+		name             string
+		input            string
+		maxBulkLength    int64
+		queryBufferLimit int64
+		want             error
+	}{
+		{"bulk too long", "*2\r\n$3\r\nGET\r\n$11\r\nkey-too-long\r\n", 10, 0, errInvalidBulkLength},
+		{"negative bulk length", "*1\r\n$-1\r\n", 0, 0, errInvalidBulkLength},
+		{"too many args for the query buffer", "*200\r\n", 0, 1024, errInvalidMultiBulkLength},
+		{"command bigger than the query buffer", "*2\r\n$3\r\nSET\r\n$2000\r\n", 0, 1024, ErrQueryBufferLimit},
+		{"invalid count", "*x\r\n", 0, 0, errInvalidMultiBulkLength},
+	}
+	for _, test := range tests {
+		p := NewParser(strings.NewReader(test.input))
+		p.SetLimits(test.maxBulkLength, test.queryBufferLimit)
+		if _, err := p.ReadCommand(); err != test.want {
+			t.Errorf("%s: ReadCommand = %v, want %v", test.name, err, test.want)
+		}
+		p.Release()
+	}
+}
+
+func TestReadCommandWithinLimits(t *testing.T) {
+	p := NewParser(strings.NewReader("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$10\r\n0123456789\r\n"))
+	defer p.Release()
+	p.SetLimits(10, 1024)
+	args, err := p.ReadCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 3 || string(args[2]) != "0123456789" {
+		t.Errorf("ReadCommand = %q", args)
+	}
+}
+
+func TestReadCommandHugeCountWithoutLimit(t *testing.T) {
+	// the count alone must not allocate, the command fails once the input ends
+	p := NewParser(strings.NewReader("*1000000000\r\n$4\r\nPING\r\n"))
+	defer p.Release()
+	if _, err := p.ReadCommand(); err != io.ErrUnexpectedEOF && err != io.EOF {
+		t.Errorf("ReadCommand = %v, want the end of the input", err)
+	}
+}
+
+// repeatReader returns data again and again
+type repeatReader struct {
+	data   []byte
+	offset int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := copy(p, r.data[r.offset:])
+	r.offset = (r.offset + n) % len(r.data)
+	return n, nil
+}
+
+func benchmarkReadCommand(b *testing.B, command string) {
+	p := NewParser(&repeatReader{data: []byte(command)})
+	defer p.Release()
+	b.SetBytes(int64(len(command)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.ReadCommand(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseCommand(b *testing.B) {
+	benchmarkReadCommand(b, "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n")
+}
+
+func BenchmarkParseCommandLargeValue(b *testing.B) {
+	value := strings.Repeat("v", 16*1024)
+	benchmarkReadCommand(b, "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$16384\r\n"+value+"\r\n")
+}
+
+func BenchmarkParseInlineCommand(b *testing.B) {
+	benchmarkReadCommand(b, "SET key \"hello world\"\r\n")
+}
+
+func BenchmarkParseReply(b *testing.B) {
+	data := "*2\r\n$5\r\nvalue\r\n:42\r\n"
+	p := NewParser(&repeatReader{data: []byte(data)})
+	defer p.Release()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.ReadReply(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseStream(b *testing.B) {
+	data := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"
+	ch := ParseStream(io.LimitReader(&repeatReader{data: []byte(data)}, int64(b.N*len(data))))
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if payload := <-ch; payload.Error != nil {
+			b.Fatal(payload.Error)
+		}
+	}
+	b.StopTimer()
+	for range ch { // io.EOF ends the stream
+	}
+}
@@ -55,6 +55,11 @@ func (p *NullBulkReply) ToBytes() []byte {
 	return nullBulkBytes
 }
 
+// ToResp3Bytes returns the bytes of null
+func (p *NullBulkReply) ToResp3Bytes() []byte {
+	return nullBytes
+}
+
 // MakeNullBulkReply returns an instance of empty bulk reply
 func MakeNullBulkReply() *NullBulkReply {
 	return theNullBulkReply
@@ -80,6 +85,31 @@ func MakeEmptyMultiBulkReply() *EmptyMultiBulkReply {
 	return theEmptyMultiBulkReply
 }
 
+// --- A Null multi bulk reply is used to return a missing array, such as a timed out blocking command.
+
+type NullMultiBulkReply struct {
+}
+
+var (
+	nullMultiBulkBytes    = []byte("*-1\r\n")
+	theNullMultiBulkReply = &NullMultiBulkReply{}
+)
+
+// ToBytes returns the bytes of null multi-bulk
+func (n *NullMultiBulkReply) ToBytes() []byte {
+	return nullMultiBulkBytes
+}
+
+// ToResp3Bytes returns the bytes of null
+func (n *NullMultiBulkReply) ToResp3Bytes() []byte {
+	return nullBytes
+}
+
+// MakeNullMultiBulkReply returns an instance of null multi-bulk reply
+func MakeNullMultiBulkReply() *NullMultiBulkReply {
+	return theNullMultiBulkReply
+}
+
 // --- A No reply is used to return when a command is not found.
 
 type NoReply struct {
@@ -17,15 +17,23 @@ type BulkReply struct {
 	Arg []byte
 }
 
-// ToBytes returns the bytes of bulk with arg and length
+// ToBytes returns the bytes of bulk with arg and length, a nil arg is a null bulk
 func (b *BulkReply) ToBytes() []byte {
-	if len(b.Arg) == 0 {
-		return nullBulkReplyBytes
+	if b.Arg == nil {
+		return []byte(string(nullBulkReplyBytes) + CRLF)
 	}
 	// E.g. "moody" -> "$5\r\nmoody\r\n"
 	return []byte("$" + strconv.Itoa(len(b.Arg)) + CRLF + string(b.Arg) + CRLF)
 }
 
+// ToResp3Bytes returns the bytes of bulk, a nil arg is a null
+func (b *BulkReply) ToResp3Bytes() []byte {
+	if b.Arg == nil {
+		return nullBytes
+	}
+	return b.ToBytes()
+}
+
 // MakeBulkReply returns an instance of bulk reply
 func MakeBulkReply(arg []byte) *BulkReply {
 	return &BulkReply{Arg: arg}
@@ -53,11 +61,51 @@ func (m *MultiBulkReply) ToBytes() []byte {
 	return buf.Bytes()
 }
 
+// ToResp3Bytes returns the bytes of multi-bulk, a nil arg is a null
+func (m *MultiBulkReply) ToResp3Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("*" + strconv.Itoa(len(m.Args)) + CRLF)
+	for _, arg := range m.Args {
+		if arg == nil {
+			buf.Write(nullBytes)
+			continue
+		}
+		buf.WriteString("$" + strconv.Itoa(len(arg)) + CRLF + string(arg) + CRLF)
+	}
+	return buf.Bytes()
+}
+
 // MakeMultiBulkReply returns an instance of multi-bulk reply
 func MakeMultiBulkReply(args [][]byte) *MultiBulkReply {
 	return &MultiBulkReply{Args: args}
 }
 
+// --- A Multi-raw reply is used to return an array of replies with different types.
+
+type MultiRawReply struct {
+	Replies []resp.Reply
+}
+
+// ToBytes returns the bytes of every reply after the array header
+func (m *MultiRawReply) ToBytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("*" + strconv.Itoa(len(m.Replies)) + CRLF)
+	for _, r := range m.Replies {
+		buf.Write(r.ToBytes())
+	}
+	return buf.Bytes()
+}
+
+// ToResp3Bytes returns the bytes of every reply encoded in RESP3 after the array header
+func (m *MultiRawReply) ToResp3Bytes() []byte {
+	return encodeAggregate('*', m.Replies, 3)
+}
+
+// MakeMultiRawReply returns an instance of multi-raw reply
+func MakeMultiRawReply(replies []resp.Reply) *MultiRawReply {
+	return &MultiRawReply{Replies: replies}
+}
+
 // --- A Status reply is used to reply a status string
 
 type StatusReply struct {
@@ -113,5 +161,6 @@ func MakeStandardErrorReply(status string) *StandardErrorReply {
 
 // IsErrorReply returns true if the first byte is '-'
 func IsErrorReply(reply resp.Reply) bool {
-	return reply.ToBytes()[0] == '-'
+	bytes := reply.ToBytes()
+	return len(bytes) > 0 && bytes[0] == '-'
 }
@@ -0,0 +1,372 @@
+package reply
+
+import (
+	"bytes"
+	"go-redis/interface/resp"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// the protocol versions negotiated by HELLO
+const (
+	Resp2 = 2
+	Resp3 = 3
+)
+
+var nullBytes = []byte("_\r\n")
+
+// Encode returns the bytes of the reply in the given protocol version
+func Encode(reply resp.Reply, protocol int) []byte {
+	if protocol >= Resp3 {
+		if resp3Reply, ok := reply.(resp.Resp3Reply); ok {
+			return resp3Reply.ToResp3Bytes()
+		}
+	}
+	return reply.ToBytes()
+}
+
+// AppendEncode appends the bytes of the reply in the given protocol version to dst and returns the extended buffer.
+// The common replies are encoded straight into dst, the others are appended from Encode.
+func AppendEncode(dst []byte, reply resp.Reply, protocol int) []byte {
+	switch r := reply.(type) {
+	case *StatusReply:
+		return append(append(append(dst, '+'), r.Status...), CRLF...)
+	case *StandardErrorReply:
+		return append(append(append(dst, '-'), r.Status...), CRLF...)
+	case *IntReply:
+		return append(strconv.AppendInt(append(dst, ':'), r.Code, 10), CRLF...)
+	case *BulkReply:
+		return appendBulk(dst, r.Arg, protocol)
+	case *MultiBulkReply:
+		dst = appendHeader(dst, '*', len(r.Args))
+		for _, arg := range r.Args {
+			dst = appendBulk(dst, arg, protocol)
+		}
+		return dst
+	case *MultiRawReply:
+		return appendAggregate(dst, '*', r.Replies, protocol)
+	case *SetReply:
+		if protocol >= Resp3 {
+			return appendAggregate(dst, '~', r.Members, protocol)
+		}
+		return appendAggregate(dst, '*', r.Members, protocol)
+	case *PushReply:
+		if protocol >= Resp3 {
+			return appendAggregate(dst, '>', r.Items, protocol)
+		}
+		return appendAggregate(dst, '*', r.Items, protocol)
+	case *MapReply:
+		if protocol >= Resp3 {
+			dst = appendHeader(dst, '%', len(r.Keys))
+		} else {
+			dst = appendHeader(dst, '*', 2*len(r.Keys))
+		}
+		for i := range r.Keys {
+			dst = AppendEncode(dst, r.Keys[i], protocol)
+			dst = AppendEncode(dst, r.Values[i], protocol)
+		}
+		return dst
+	case *VersionedReply:
+		if protocol >= Resp3 {
+			return AppendEncode(dst, r.Resp3Reply, protocol)
+		}
+		return AppendEncode(dst, r.Resp2Reply, protocol)
+	}
+	return append(dst, Encode(reply, protocol)...)
+}
+
+// appendHeader appends the header of an aggregate of n elements
+func appendHeader(dst []byte, kind byte, n int) []byte {
+	return append(strconv.AppendInt(append(dst, kind), int64(n), 10), CRLF...)
+}
+
+// appendBulk appends a bulk string, a nil arg is a null bulk under RESP2 and a null under RESP3
+func appendBulk(dst []byte, arg []byte, protocol int) []byte {
+	if arg == nil {
+		if protocol >= Resp3 {
+			return append(dst, nullBytes...)
+		}
+		return append(dst, nullBulkBytes...)
+	}
+	dst = appendHeader(dst, '$', len(arg))
+	return append(append(dst, arg...), CRLF...)
+}
+
+// appendAggregate appends the header of an aggregate type followed by the replies
+func appendAggregate(dst []byte, kind byte, replies []resp.Reply, protocol int) []byte {
+	dst = appendHeader(dst, kind, len(replies))
+	for _, r := range replies {
+		dst = AppendEncode(dst, r, protocol)
+	}
+	return dst
+}
+
+// encodeAggregate returns the header of an aggregate type followed by the replies
+func encodeAggregate(kind byte, replies []resp.Reply, protocol int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(string(kind) + strconv.Itoa(len(replies)) + CRLF)
+	for _, r := range replies {
+		buf.Write(Encode(r, protocol))
+	}
+	return buf.Bytes()
+}
+
+// encodePairs returns the header of a map-like type followed by the key value pairs
+func encodePairs(kind byte, keys []resp.Reply, values []resp.Reply, protocol int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(string(kind) + strconv.Itoa(len(keys)) + CRLF)
+	for i := range keys {
+		buf.Write(Encode(keys[i], protocol))
+		buf.Write(Encode(values[i], protocol))
+	}
+	return buf.Bytes()
+}
+
+// --- A Map reply is used to return key value pairs, it is a flat array under RESP2.
+
+type MapReply struct {
+	Keys   []resp.Reply
+	Values []resp.Reply
+}
+
+// ToBytes returns the bytes of the flat array of keys and values
+func (m *MapReply) ToBytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("*" + strconv.Itoa(2*len(m.Keys)) + CRLF)
+	for i := range m.Keys {
+		buf.Write(m.Keys[i].ToBytes())
+		buf.Write(m.Values[i].ToBytes())
+	}
+	return buf.Bytes()
+}
+
+// ToResp3Bytes returns the bytes of map
+func (m *MapReply) ToResp3Bytes() []byte {
+	return encodePairs('%', m.Keys, m.Values, Resp3)
+}
+
+// Add appends a key value pair
+func (m *MapReply) Add(key resp.Reply, value resp.Reply) *MapReply {
+	m.Keys = append(m.Keys, key)
+	m.Values = append(m.Values, value)
+	return m
+}
+
+// MakeMapReply returns an instance of map reply
+func MakeMapReply() *MapReply {
+	return &MapReply{}
+}
+
+// --- A Set reply is used to return unordered unique members, it is an array under RESP2.
+
+type SetReply struct {
+	Members []resp.Reply
+}
+
+// ToBytes returns the bytes of array
+func (s *SetReply) ToBytes() []byte {
+	return encodeAggregate('*', s.Members, Resp2)
+}
+
+// ToResp3Bytes returns the bytes of set
+func (s *SetReply) ToResp3Bytes() []byte {
+	return encodeAggregate('~', s.Members, Resp3)
+}
+
+// MakeSetReply returns an instance of set reply
+func MakeSetReply(members []resp.Reply) *SetReply {
+	return &SetReply{Members: members}
+}
+
+// --- A Push reply is used to send out-of-band data, like pub/sub messages, it is an array under RESP2.
+
+type PushReply struct {
+	Items []resp.Reply
+}
+
+// ToBytes returns the bytes of array
+func (p *PushReply) ToBytes() []byte {
+	return encodeAggregate('*', p.Items, Resp2)
+}
+
+// ToResp3Bytes returns the bytes of push
+func (p *PushReply) ToResp3Bytes() []byte {
+	return encodeAggregate('>', p.Items, Resp3)
+}
+
+// MakePushReply returns an instance of push reply
+func MakePushReply(items []resp.Reply) *PushReply {
+	return &PushReply{Items: items}
+}
+
+// --- A Double reply is used to return a floating point number, it is a bulk string under RESP2.
+
+type DoubleReply struct {
+	Value float64
+}
+
+// FormatDouble formats the number the way redis replies it
+func FormatDouble(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	case math.IsNaN(value):
+		return "nan"
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// ToBytes returns the bytes of bulk
+func (d *DoubleReply) ToBytes() []byte {
+	return MakeBulkReply([]byte(FormatDouble(d.Value))).ToBytes()
+}
+
+// ToResp3Bytes returns the bytes of double
+func (d *DoubleReply) ToResp3Bytes() []byte {
+	return []byte("," + FormatDouble(d.Value) + CRLF)
+}
+
+// MakeDoubleReply returns an instance of double reply
+func MakeDoubleReply(value float64) *DoubleReply {
+	return &DoubleReply{Value: value}
+}
+
+// --- A Boolean reply is used to return true or false, it is the integer 1 or 0 under RESP2.
+
+type BooleanReply struct {
+	Value bool
+}
+
+// ToBytes returns the bytes of int
+func (b *BooleanReply) ToBytes() []byte {
+	if b.Value {
+		return []byte(":1" + CRLF)
+	}
+	return []byte(":0" + CRLF)
+}
+
+// ToResp3Bytes returns the bytes of boolean
+func (b *BooleanReply) ToResp3Bytes() []byte {
+	if b.Value {
+		return []byte("#t" + CRLF)
+	}
+	return []byte("#f" + CRLF)
+}
+
+// MakeBooleanReply returns an instance of boolean reply
+func MakeBooleanReply(value bool) *BooleanReply {
+	return &BooleanReply{Value: value}
+}
+
+// --- A Big number reply is used to return an integer out of the 64 bits range, it is a bulk string under RESP2.
+
+type BigNumberReply struct {
+	Value *big.Int
+}
+
+// ToBytes returns the bytes of bulk
+func (b *BigNumberReply) ToBytes() []byte {
+	return MakeBulkReply([]byte(b.Value.String())).ToBytes()
+}
+
+// ToResp3Bytes returns the bytes of big number
+func (b *BigNumberReply) ToResp3Bytes() []byte {
+	return []byte("(" + b.Value.String() + CRLF)
+}
+
+// MakeBigNumberReply returns an instance of big number reply
+func MakeBigNumberReply(value *big.Int) *BigNumberReply {
+	return &BigNumberReply{Value: value}
+}
+
+// --- A Null reply is used to return nothing, it is a null bulk under RESP2.
+
+type NullReply struct {
+}
+
+var theNullReply = &NullReply{}
+
+// ToBytes returns the bytes of null bulk
+func (n *NullReply) ToBytes() []byte {
+	return nullBulkBytes
+}
+
+// ToResp3Bytes returns the bytes of null
+func (n *NullReply) ToResp3Bytes() []byte {
+	return nullBytes
+}
+
+// MakeNullReply returns an instance of null reply
+func MakeNullReply() *NullReply {
+	return theNullReply
+}
+
+// --- A Verbatim string reply is used to return a text meant to be displayed as is, it is a bulk string under RESP2.
+
+type VerbatimReply struct {
+	Format string // three characters, like txt or mkd
+	Text   []byte
+}
+
+// ToBytes returns the bytes of bulk
+func (v *VerbatimReply) ToBytes() []byte {
+	return MakeBulkReply(v.Text).ToBytes()
+}
+
+// ToResp3Bytes returns the bytes of verbatim string
+func (v *VerbatimReply) ToResp3Bytes() []byte {
+	return []byte("=" + strconv.Itoa(len(v.Format)+1+len(v.Text)) + CRLF + v.Format + ":" + string(v.Text) + CRLF)
+}
+
+// MakeVerbatimReply returns an instance of verbatim string reply
+func MakeVerbatimReply(format string, text []byte) *VerbatimReply {
+	return &VerbatimReply{Format: format, Text: text}
+}
+
+// --- An Attribute reply is used to attach auxiliary key value pairs to a reply, they are dropped under RESP2.
+
+type AttributeReply struct {
+	Attributes *MapReply
+	Reply      resp.Reply
+}
+
+// ToBytes returns the bytes of the reply alone
+func (a *AttributeReply) ToBytes() []byte {
+	return a.Reply.ToBytes()
+}
+
+// ToResp3Bytes returns the bytes of the attributes followed by the reply
+func (a *AttributeReply) ToResp3Bytes() []byte {
+	attributes := encodePairs('|', a.Attributes.Keys, a.Attributes.Values, Resp3)
+	return append(attributes, Encode(a.Reply, Resp3)...)
+}
+
+// MakeAttributeReply returns an instance of attribute reply
+func MakeAttributeReply(attributes *MapReply, reply resp.Reply) *AttributeReply {
+	return &AttributeReply{Attributes: attributes, Reply: reply}
+}
+
+// --- A Versioned reply is used when a command replies different shapes under RESP2 and RESP3.
+
+type VersionedReply struct {
+	Resp2Reply resp.Reply
+	Resp3Reply resp.Reply
+}
+
+// ToBytes returns the bytes of the RESP2 reply
+func (v *VersionedReply) ToBytes() []byte {
+	return v.Resp2Reply.ToBytes()
+}
+
+// ToResp3Bytes returns the bytes of the RESP3 reply
+func (v *VersionedReply) ToResp3Bytes() []byte {
+	return Encode(v.Resp3Reply, Resp3)
+}
+
+// MakeVersionedReply returns an instance of versioned reply
+func MakeVersionedReply(resp2Reply resp.Reply, resp3Reply resp.Reply) *VersionedReply {
+	return &VersionedReply{Resp2Reply: resp2Reply, Resp3Reply: resp3Reply}
+}
@@ -0,0 +1,36 @@
+package reply
+
+import (
+	"go-redis/interface/resp"
+	"math/big"
+	"testing"
+)
+
+func TestAppendEncode(t *testing.T) {
+	replies := []resp.Reply{
+		MakeOkReply(),
+		MakeStatusReply("QUEUED"),
+		MakeStandardErrorReply("ERR wrong"),
+		MakeIntReply(-42),
+		MakeBulkReply([]byte("value")),
+		MakeBulkReply(nil),
+		MakeNullBulkReply(),
+		MakeMultiBulkReply([][]byte{[]byte("a"), nil, []byte("")}),
+		MakeMultiRawReply([]resp.Reply{MakeIntReply(1), MakeBulkReply(nil), MakeDoubleReply(1.5)}),
+		MakeMapReply().Add(MakeBulkReply([]byte("key")), MakeBooleanReply(true)),
+		MakeSetReply([]resp.Reply{MakeBulkReply([]byte("member"))}),
+		MakePushReply([]resp.Reply{MakeBulkReply([]byte("message")), MakeNullReply()}),
+		MakeVersionedReply(MakeIntReply(1), MakeBooleanReply(true)),
+		MakeBigNumberReply(big.NewInt(7)),
+		MakeVerbatimReply("txt", []byte("text")),
+		MakeAttributeReply(MakeMapReply().Add(MakeBulkReply([]byte("ttl")), MakeIntReply(3)), MakeBulkReply([]byte("v"))),
+	}
+	for _, protocol := range []int{Resp2, Resp3} {
+		for _, r := range replies {
+			want := string(Encode(r, protocol))
+			if got := string(AppendEncode([]byte("prefix"), r, protocol)); got != "prefix"+want {
+				t.Errorf("AppendEncode(%T) in RESP%d = %q, want %q", r, protocol, got, "prefix"+want)
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Package server embeds a go-redis instance into another go program.
+// Every Server owns its configuration, data and INFO counters, so several instances can run in one process.
+//
+// The command table, the modules and the logger are shared by the process though. A module loaded by one
+// instance, from Options.LoadModules or MODULE LOAD, adds its commands and data types to every instance,
+// and MODULE UNLOAD removes them from all of them.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"go-redis/config"
+	"go-redis/resp/handler"
+	"go-redis/tcp"
+	"net"
+	"os"
+	"sync"
+)
+
+// Options configures an embedded server, the fields mirror the directives of redis.conf
+type Options struct {
+	Dir         string // data directory of the instance, the aof file is stored in it
+	RequirePass string // password clients must send with AUTH, empty means no authentication
+	Databases   int    // number of databases, 16 by default
+
+	AppendOnly               bool   // enables aof persistence
+	AppendFilename           string // name of the aof file inside Dir, "appendOnly.aof" by default
+	AppendFsync              string // "always", "everysec" or "no", "everysec" by default
+	AutoAofRewriteMinSize    string // e.g. "64mb"
+	AutoAofRewritePercentage int64
+
+	HTTPAddr string // address of the http gateway, empty to disable it
+
+	TLSAddr        string // address of the tls listener, empty to disable it
+	TLSCertFile    string // certificate of the tls listener, also presented to the peers with TLSCluster
+	TLSKeyFile     string
+	TLSCACertFile  string // CA verifying the client certificates and the peers
+	TLSAuthClients string // "yes", "optional" or "no", "yes" by default
+	TLSCluster     bool   // the peers are dialed over tls
+
+	Self  string   // address of this node when running as a cluster
+	Peers []string // addresses of the other cluster nodes
+
+	LoadModules []string // modules to load, each one is "path [arg ...]", they are shared by every instance
+}
+
+// Server is an embeddable go-redis instance
+type Server struct {
+	properties *config.ServerProperties
+	httpAddr   string
+	tlsAddr    string
+	serveOnce  sync.Once
+
+	mutex   sync.Mutex // guards certs and handler, they are set once serving
+	certs   *tcp.Certificates
+	handler *handler.RespHandler
+}
+
+// New returns a server configured by opts, nothing is started until Serve is called
+func New(opts Options) *Server {
+	properties := &config.ServerProperties{
+		RequirePass:              opts.RequirePass,
+		Databases:                opts.Databases,
+		Dir:                      opts.Dir,
+		AppendOnly:               opts.AppendOnly,
+		AppendFilename:           opts.AppendFilename,
+		AppendFsync:              opts.AppendFsync,
+		AutoAofRewriteMinSize:    opts.AutoAofRewriteMinSize,
+		AutoAofRewritePercentage: opts.AutoAofRewritePercentage,
+		Self:                     opts.Self,
+		Peers:                    opts.Peers,
+		LoadModules:              opts.LoadModules,
+		TLSCertFile:              opts.TLSCertFile,
+		TLSKeyFile:               opts.TLSKeyFile,
+		TLSCACertFile:            opts.TLSCACertFile,
+		TLSAuthClients:           opts.TLSAuthClients,
+		TLSCluster:               opts.TLSCluster,
+	}
+	if properties.AppendFilename == "" {
+		properties.AppendFilename = "appendOnly.aof"
+	}
+	if properties.AppendFsync == "" {
+		properties.AppendFsync = "everysec"
+	}
+	if properties.AutoAofRewriteMinSize == "" {
+		properties.AutoAofRewriteMinSize = "64mb"
+	}
+	if properties.AutoAofRewritePercentage == 0 {
+		properties.AutoAofRewritePercentage = 100
+	}
+	return &Server{properties: properties, httpAddr: opts.HTTPAddr, tlsAddr: opts.TLSAddr}
+}
+
+// Serve accepts connections on listener until ctx is cancelled or the listener fails,
+// and tls connections on TLSAddr and http requests on HTTPAddr if set.
+// It returns after every connection is closed and the aof file is flushed.
+// A server can only be served once.
+func (server *Server) Serve(ctx context.Context, listener net.Listener) error {
+	err := errors.New("server is already served")
+	server.serveOnce.Do(func() {
+		err = server.serve(ctx, listener)
+	})
+	return err
+}
+
+// serve opens the database and runs the accept loop
+func (server *Server) serve(ctx context.Context, listener net.Listener) error {
+	if server.properties.Dir != "" {
+		if err := os.MkdirAll(server.properties.Dir, 0755); err != nil {
+			_ = listener.Close()
+			return err
+		}
+	}
+	listeners := []net.Listener{listener}
+	var certs *tcp.Certificates
+	if server.tlsAddr != "" {
+		var err error
+		if certs, err = tcp.LoadCertificates(tcp.MakeTLSConfig(server.properties)); err != nil {
+			_ = listener.Close()
+			return err
+		}
+		tlsListener, err := net.Listen("tcp", server.tlsAddr)
+		if err != nil {
+			_ = listener.Close()
+			return err
+		}
+		listeners = append(listeners, tls.NewListener(tlsListener, certs.ServerConfig()))
+	}
+	var httpListener net.Listener
+	if server.httpAddr != "" {
+		var err error
+		if httpListener, err = net.Listen("tcp", server.httpAddr); err != nil {
+			closeListeners(listeners)
+			return err
+		}
+	}
+	respHandler := handler.MakeHandler(server.properties)
+	server.mutex.Lock()
+	server.certs, server.handler = certs, respHandler
+	server.mutex.Unlock()
+	if httpListener != nil {
+		// the handler is closed first, it ends the requests still streaming
+		defer tcp.ServeHTTP(httpListener, respHandler).Close()
+	}
+
+	closeChan := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			close(closeChan)
+		case <-done: // the listener failed, stop watching ctx
+		}
+	}()
+	if err := tcp.ServeListeners(listeners, respHandler, closeChan); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// ReloadCertificates reloads the certificates of the tls listener and the ones dialing the peers,
+// the next handshakes use them. It is what SIGHUP does to a standalone server.
+func (server *Server) ReloadCertificates() error {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.handler == nil {
+		return errors.New("server is not served")
+	}
+	return tcp.ReloadCertificates(server.certs, server.handler)
+}
+
+// closeListeners closes the listeners of a server which fails to start
+func closeListeners(listeners []net.Listener) {
+	for _, listener := range listeners {
+		_ = listener.Close()
+	}
+}
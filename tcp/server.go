@@ -2,74 +2,258 @@ package tcp
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"go-redis/interface/tcp"
 	"go-redis/lib/logger"
+	"go-redis/lib/sync/atomic"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 )
 
 type Config struct {
-	Addr string
+	Addr string // address of the plain tcp listener, empty to only serve tls
+
+	TLSAddr string        // address of the tls listener, empty to disable tls
+	TLS     *Certificates // certificates of the tls listener
+
+	UnixSocket     string      // path of the unix socket, empty to disable it
+	UnixSocketPerm os.FileMode // permissions of the socket file, 0 keeps the default ones
+
+	HTTPAddr string // address of the http listener, empty to disable it, the handler must be an http.Handler
 }
 
-// ListenAndServeWithSignal starts a tcp server
+// ListenAndServeWithSignal starts a tcp server, a tls server if TLSAddr is set, a unix socket server if UnixSocket is set
+// and an http server if HTTPAddr is set. SIGHUP and SIGUSR1 reload the tls certificates, the other signals close the server.
 func ListenAndServeWithSignal(cfg *Config, handler tcp.Handler) error {
-	listener, err := net.Listen("tcp", cfg.Addr)
-	if err != nil {
-		return err
+	var listeners []net.Listener
+	if cfg.Addr != "" {
+		listener, err := net.Listen("tcp", cfg.Addr)
+		if err != nil {
+			return err
+		}
+		logger.Info("Starting server on", cfg.Addr)
+		listeners = append(listeners, listener)
+	}
+	if cfg.TLSAddr != "" {
+		listener, err := net.Listen("tcp", cfg.TLSAddr)
+		if err != nil {
+			closeListeners(listeners)
+			return err
+		}
+		logger.Info("Starting tls server on", cfg.TLSAddr)
+		listeners = append(listeners, tls.NewListener(listener, cfg.TLS.ServerConfig()))
+	}
+	if cfg.UnixSocket != "" {
+		listener, err := listenUnix(cfg.UnixSocket, cfg.UnixSocketPerm)
+		if err != nil {
+			closeListeners(listeners)
+			return err
+		}
+		logger.Info("Starting server on unix socket", cfg.UnixSocket)
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 {
+		return errors.New("no listener configured, set port, tls-port or unixsocket")
 	}
+	if cfg.HTTPAddr != "" {
+		httpHandler, ok := handler.(http.Handler)
+		if !ok {
+			closeListeners(listeners)
+			return errors.New("the handler does not serve http")
+		}
+		listener, err := net.Listen("tcp", cfg.HTTPAddr)
+		if err != nil {
+			closeListeners(listeners)
+			return err
+		}
+		logger.Info("Starting http server on", cfg.HTTPAddr)
+		// the handler is closed first, it ends the requests still streaming
+		defer ServeHTTP(listener, httpHandler).Close()
+	}
+
 	closeChan := make(chan struct{})
 	// when the system signal is received, close the listener
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT)
+	signal.Notify(sigChan, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT)
+	go func() {
+		for sig := range sigChan {
+			switch sig {
+			case syscall.SIGHUP, syscall.SIGUSR1:
+				if err := ReloadCertificates(cfg.TLS, handler); err != nil {
+					logger.Error("failed to reload tls certificates: " + err.Error())
+				} else {
+					logger.Info("tls certificates reloaded")
+				}
+			case syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT:
+				close(closeChan)
+				return
+			}
+		}
+	}()
+
+	return ServeListeners(listeners, handler, closeChan)
+}
+
+const (
+	httpReadHeaderTimeout = 10 * time.Second // a client must send its headers in time, or it holds a connection for nothing
+	httpIdleTimeout       = time.Minute      // how long a kept-alive connection waits for its next request
+)
+
+// ServeHTTP serves the requests of handler on listener in the background, until the returned server is closed.
+// There is no read or write timeout, the subscriptions stream their messages for as long as the client stays.
+func ServeHTTP(listener net.Listener, handler http.Handler) *http.Server {
+	httpServer := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		IdleTimeout:       httpIdleTimeout,
+	}
 	go func() {
-		sig := <-sigChan
-		switch sig {
-		case syscall.SIGHUP, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT:
-			closeChan <- struct{}{}
+		if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("http server stopped: " + err.Error())
 		}
 	}()
+	return httpServer
+}
 
-	logger.Info("Starting server on", cfg.Addr)
-	ListenAndServe(listener, handler, closeChan)
-	return nil
+// ReloadCertificates reloads the certificates of the tls listener, nil if there is none, and the ones of the handler
+func ReloadCertificates(certs *Certificates, handler tcp.Handler) error {
+	var errs []error
+	if certs != nil {
+		if err := certs.Reload(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if reloader, ok := handler.(tcp.CertificateReloader); ok {
+		if err := reloader.ReloadCertificates(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// listenUnix listens on the unix socket at path, the socket file is removed when the listener is closed
+func listenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	// a socket file left by a process that did not shut down cleanly would make the listen fail
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(true)
+	if perm != 0 {
+		if err := os.Chmod(path, perm); err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
 }
 
 // ListenAndServe accepts connections on the Listener
-func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan <-chan struct{}) {
-	// User manually close the server
+func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan <-chan struct{}) error {
+	return ServeListeners([]net.Listener{listener}, handler, closeChan)
+}
+
+// ServeListeners accepts connections on every listener, until closeChan is signaled or a listener is closed.
+// Other accept errors, like EMFILE or ECONNABORTED, are retried after a growing delay as net/http does.
+// It returns after every connection is closed, the error is the one of a listener closed by someone else if any.
+func ServeListeners(listeners []net.Listener, handler tcp.Handler, closeChan <-chan struct{}) error {
+	// the server is closed by the user, or by a client if the handler supports it
+	var shutdown <-chan struct{}
+	if notifier, ok := handler.(tcp.ShutdownNotifier); ok {
+		shutdown = notifier.ShutdownRequested()
+	}
+	var closing atomic.Boolean
+	done := make(chan struct{})
+	defer close(done)
 	go func() {
-		// block until closeChan is signaled
-		<-closeChan
-		close(listener, handler)
+		// block until closeChan is signaled, or the listeners stopped by themselves
+		select {
+		case <-closeChan:
+		case <-shutdown:
+		case <-done:
+			return
+		}
+		closing.Set(true)
+		closeListeners(listeners)
 	}()
 
-	defer close(listener, handler)
 	ctx := context.Background()
 	// use wait group to wait all go routine to exit
 	waitDone := sync.WaitGroup{}
-	for {
-		conn, err := listener.Accept()
-		if err != nil {
-			break
-		}
-		logger.Info("Accepted connection from", conn.RemoteAddr().String())
-		waitDone.Add(1)
-		go func() {
-			// use defer to prevent wait group not executed if goroutine panic
-			defer func() {
-				waitDone.Done()
-			}()
-			handler.Handle(ctx, conn)
-		}()
+	acceptDone := sync.WaitGroup{}
+	var serveErr error
+	var failOnce sync.Once
+	for _, listener := range listeners {
+		acceptDone.Add(1)
+		go func(listener net.Listener) {
+			defer acceptDone.Done()
+			var retryDelay time.Duration
+			for {
+				conn, err := listener.Accept()
+				if err != nil && !errors.Is(err, net.ErrClosed) && !closing.Get() {
+					retryDelay = nextAcceptRetryDelay(retryDelay)
+					logger.Warn("accept error on " + listener.Addr().String() + ": " + err.Error() +
+						", retrying in " + retryDelay.String())
+					time.Sleep(retryDelay)
+					continue
+				}
+				retryDelay = 0
+				if err != nil {
+					// one listener closed stops the others
+					failOnce.Do(func() {
+						if !closing.Get() {
+							serveErr = err
+						}
+						closing.Set(true)
+						closeListeners(listeners)
+					})
+					return
+				}
+				// a refused connection costs no goroutine
+				if limiter, ok := handler.(tcp.ConnectionLimiter); ok && !limiter.Admit(conn) {
+					continue
+				}
+				logger.Info("Accepted connection from", conn.RemoteAddr().String(), "on", listener.Addr().String())
+				waitDone.Add(1)
+				go func() {
+					// use defer to prevent wait group not executed if goroutine panic
+					defer func() {
+						waitDone.Done()
+					}()
+					handler.Handle(ctx, conn)
+				}()
+			}
+		}(listener)
 	}
+	acceptDone.Wait()
+	// closing the handler closes the connections, so their goroutines can end
+	_ = handler.Close()
 	waitDone.Wait()
+	return serveErr
 }
 
-func close(listener net.Listener, handler tcp.Handler) {
-	_ = listener.Close()
-	_ = handler.Close()
+// nextAcceptRetryDelay doubles the delay before the next accept, from 5 milliseconds up to a second
+func nextAcceptRetryDelay(delay time.Duration) time.Duration {
+	if delay == 0 {
+		return 5 * time.Millisecond
+	}
+	if delay *= 2; delay > time.Second {
+		return time.Second
+	}
+	return delay
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, listener := range listeners {
+		_ = listener.Close()
+	}
 }
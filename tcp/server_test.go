@@ -0,0 +1,79 @@
+package tcp
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyListener fails its first accepts like a process out of file descriptors
+type flakyListener struct {
+	net.Listener
+	mutex    sync.Mutex
+	failures int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	l.mutex.Lock()
+	if l.failures > 0 {
+		l.failures--
+		l.mutex.Unlock()
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", syscall.EMFILE)}
+	}
+	l.mutex.Unlock()
+	return l.Listener.Accept()
+}
+
+// recordingHandler closes the connections it handles and reports them
+type recordingHandler struct {
+	handled chan struct{}
+}
+
+func (h *recordingHandler) Handle(_ context.Context, conn net.Conn) {
+	_ = conn.Close()
+	h.handled <- struct{}{}
+}
+
+func (h *recordingHandler) Close() error {
+	return nil
+}
+
+func TestServeListenersRetriesAcceptErrors(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &recordingHandler{handled: make(chan struct{}, 1)}
+	closeChan := make(chan struct{})
+	served := make(chan error, 1)
+	go func() {
+		served <- ServeListeners([]net.Listener{&flakyListener{Listener: listener, failures: 3}}, handler, closeChan)
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	select {
+	case <-handler.handled:
+	case err := <-served:
+		t.Fatalf("the server stopped on a temporary accept error: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the connection was not handled")
+	}
+
+	close(closeChan)
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("ServeListeners = %v after close, want nil", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the server did not stop")
+	}
+}
@@ -0,0 +1,132 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"go-redis/config"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HandshakeTimeout bounds the tls handshake of a client, the client holds one of the maxclients slots meanwhile
+const HandshakeTimeout = 10 * time.Second
+
+// TLSConfig configures the tls listener and the tls connections to the cluster peers
+type TLSConfig struct {
+	CertFile    string
+	KeyFile     string
+	CACertFile  string
+	AuthClients string // "yes" requires a client certificate, "optional" verifies it if given, "no" ignores it
+}
+
+// MakeTLSConfig returns the tls settings of the server properties
+func MakeTLSConfig(properties *config.ServerProperties) TLSConfig {
+	return TLSConfig{
+		CertFile:    properties.TLSCertFile,
+		KeyFile:     properties.TLSKeyFile,
+		CACertFile:  properties.TLSCACertFile,
+		AuthClients: properties.TLSAuthClients,
+	}
+}
+
+// Certificates holds the key pair and the CA of a TLSConfig, they are reloaded by Reload
+type Certificates struct {
+	config TLSConfig
+
+	mutex  sync.RWMutex
+	cert   *tls.Certificate
+	caPool *x509.CertPool // nil if no CA is set
+}
+
+// LoadCertificates reads the certificates of cfg, their owner reloads them with Reload
+func LoadCertificates(cfg TLSConfig) (*Certificates, error) {
+	certs := &Certificates{config: cfg}
+	if err := certs.Reload(); err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+// Reload reads the certificate files again, the previous certificates are kept if a file is invalid
+func (certs *Certificates) Reload() error {
+	if certs.config.CertFile == "" || certs.config.KeyFile == "" {
+		return errors.New("tls-cert-file and tls-key-file must be set")
+	}
+	cert, err := tls.LoadX509KeyPair(certs.config.CertFile, certs.config.KeyFile)
+	if err != nil {
+		return err
+	}
+	var caPool *x509.CertPool
+	if certs.config.CACertFile != "" {
+		pem, err := os.ReadFile(certs.config.CACertFile)
+		if err != nil {
+			return err
+		}
+		caPool = x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificate found in " + certs.config.CACertFile)
+		}
+	}
+	certs.mutex.Lock()
+	certs.cert, certs.caPool = &cert, caPool
+	certs.mutex.Unlock()
+	return nil
+}
+
+// current returns the certificates in use
+func (certs *Certificates) current() (*tls.Certificate, *x509.CertPool) {
+	certs.mutex.RLock()
+	defer certs.mutex.RUnlock()
+	return certs.cert, certs.caPool
+}
+
+// ServerConfig returns the config of a tls listener, each handshake uses the latest certificates
+func (certs *Certificates) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, caPool := certs.current()
+			serverConfig := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientCAs:    caPool,
+			}
+			switch strings.ToLower(certs.config.AuthClients) {
+			case "no":
+				serverConfig.ClientAuth = tls.NoClientCert
+			case "optional":
+				serverConfig.ClientAuth = tls.VerifyClientCertIfGiven
+			default: // clients must authenticate by default, like redis
+				serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return serverConfig, nil
+		},
+	}
+}
+
+// ClientConfig returns the config dialing a tls server with the latest certificates,
+// the certificate of the server is verified with the CA and presented to it as the client certificate
+func (certs *Certificates) ClientConfig() *tls.Config {
+	cert, caPool := certs.current()
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*cert},
+		RootCAs:      caPool,
+	}
+}
+
+// Handshake completes the tls handshake of conn within HandshakeTimeout, a connection which is not tls is left as is
+func Handshake(ctx context.Context, conn net.Conn) error {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, HandshakeTimeout)
+	defer cancel()
+	return tlsConn.HandshakeContext(ctx)
+}